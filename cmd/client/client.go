@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
+
+	"github.com/cedric-parisi/payment-api/internal/config"
+	"github.com/cedric-parisi/payment-api/internal/repository"
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+)
+
+const (
+	connectionString = "host=%s port=%s user=%s dbname=%s password=%s sslmode=disable"
+)
+
+// client registers an API client and prints its credentials
+// It bootstraps the first admin client, the next ones can be managed through /auth/clients
+func main() {
+	name := flag.String("name", "", "name of the client")
+	organisation := flag.String("organisation", "", "id of the organisation the client acts for")
+	scope := flag.String("scope", auth.ScopeAdmin, "scopes granted to the client separated by spaces")
+	flag.Parse()
+
+	// setup config
+	cfg := config.SetConfiguration()
+
+	// open connection to db
+	db, err := gorm.Open("postgres", fmt.Sprintf(connectionString, cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbName, cfg.DbPassword))
+	if err != nil {
+		log.Fatal("could not open db connection: ", err)
+	}
+	defer db.Close()
+
+	clientRepository := repository.NewClientRepository(db, repository.Options{
+		WriteTimeout: cfg.DbWriteTimeout,
+	})
+	key := []byte(cfg.JwtSigningKey)
+	authSvc := auth.NewService(500, key, func(*jwt.Token) (interface{}, error) { return key, nil }, clientRepository)
+
+	client := &auth.Client{
+		Name:           *name,
+		OrganisationID: *organisation,
+		Scope:          *scope,
+	}
+	secret, err := authSvc.CreateClient(context.Background(), client)
+	if err != nil {
+		log.Fatal("could not register client: ", err)
+	}
+
+	// the secret is not stored, it cannot be displayed again
+	fmt.Fprintf(os.Stdout, "client_id: %s\nclient_secret: %s\n", client.ID, secret)
+}
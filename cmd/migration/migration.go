@@ -1,59 +1,109 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"time"
+	"strconv"
 
 	"github.com/cedric-parisi/payment-api/internal/config"
-	"github.com/jinzhu/gorm"
+	"github.com/cedric-parisi/payment-api/internal/migration"
 
-	"github.com/cedric-parisi/payment-api/internal/models"
-
-	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/lib/pq"
 )
 
 const (
 	connectionString = "host=%s port=%s user=%s dbname=%s password=%s sslmode=disable"
+
+	usage = `usage: migration [-dir migrations] <command>
+
+commands:
+  up      apply every pending migration
+  down    revert the last applied migration
+  to N    apply or revert migrations until version N is the last applied, 0 reverts everything
+  status  list the migrations and when they were applied
+`
 )
 
 func main() {
-	// Marshal the mock.json file into payments
-	mockFile, err := os.Open("mock.json")
-	if err != nil {
-		log.Fatal("could not open mock.json: ", err)
+	dir := flag.String("dir", "migrations", "directory of the migration files")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
 	}
-
-	var dest struct {
-		Data []*models.Payment `json:"data"`
-	}
-	if err := json.NewDecoder(mockFile).Decode(&dest); err != nil {
-		log.Fatal("could not decode mockFile: ", err)
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	for _, p := range dest.Data {
-		p.CreatedAt = time.Now().UTC()
+	migrations, err := migration.Load(*dir)
+	if err != nil {
+		log.Fatal("could not load migrations: ", err)
 	}
 
 	// setup config
 	cfg := config.SetConfiguration()
 
 	// open connection to db
-	db, err := gorm.Open("postgres", fmt.Sprintf(connectionString, cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbName, cfg.DbPassword))
+	db, err := sql.Open("postgres", fmt.Sprintf(connectionString, cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbName, cfg.DbPassword))
 	if err != nil {
 		log.Fatal("could not open db connection: ", err)
 	}
 	defer db.Close()
 
-	db.LogMode(true)
+	migrator := migration.NewMigrator(db, migrations)
+	ctx := context.Background()
+
+	var steps []migration.Step
+	switch cmd := flag.Arg(0); cmd {
+	case "up":
+		steps, err = migrator.Up(ctx)
+	case "down":
+		steps, err = migrator.Down(ctx)
+	case "to":
+		version, convErr := strconv.Atoi(flag.Arg(1))
+		if flag.NArg() != 2 || convErr != nil {
+			flag.Usage()
+			os.Exit(2)
+		}
+		steps, err = migrator.To(ctx, version)
+	case "status":
+		printStatus(ctx, migrator)
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 
-	// create/update schemas according to struct defintions
-	db.AutoMigrate(&models.Payment{}, &models.Attribute{}, &models.BeneficiaryParty{}, &models.ChargesInformation{}, &models.DebtorParty{}, &models.Fx{}, &models.SenderCharge{}, &models.SponsorParty{})
+	for _, step := range steps {
+		action := "applied"
+		if step.Reverted {
+			action = "reverted"
+		}
+		log.Printf("%s %04d_%s", action, step.Version, step.Name)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(steps) == 0 {
+		log.Print("schema is up to date")
+	}
+}
 
-	// insert mock data
-	for _, p := range dest.Data {
-		db.Create(p)
+func printStatus(ctx context.Context, migrator *migration.Migrator) {
+	states, err := migrator.Status(ctx)
+	if err != nil {
+		log.Fatal("could not read the migrations status: ", err)
+	}
+	for _, state := range states {
+		applied := "pending"
+		if state.AppliedAt != nil {
+			applied = "applied at " + state.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		fmt.Printf("%04d_%s\t%s\n", state.Version, state.Name, applied)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/cedric-parisi/payment-api/docs"
 	"github.com/cedric-parisi/payment-api/internal/config"
+	"github.com/cedric-parisi/payment-api/internal/models"
 
 	"github.com/cedric-parisi/payment-api/internal/payments"
 	"github.com/cedric-parisi/payment-api/internal/repository"
@@ -53,6 +55,11 @@ func main() {
 	// Setup configuration
 	cfg := config.SetConfiguration()
 
+	fxTolerances, err := models.ParseFxTolerances(cfg.FxTolerances)
+	if err != nil {
+		log.Fatalf("could not read fx tolerances: %s", err.Error())
+	}
+
 	// Init DB connection
 	db, err := gorm.Open("postgres", fmt.Sprintf(connectionString, cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbName, cfg.DbPassword))
 	if err != nil {
@@ -79,27 +86,50 @@ func main() {
 	signal.Notify(stopChan, os.Interrupt)
 
 	// Init HTTP server
+	// Requests contexts derive from requestsCtx, canceled when the graceful period is over
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	srv := &http.Server{
 		Addr:         ":" + cfg.AppPort,
 		ReadTimeout:  httpReadTimeout,
 		WriteTimeout: httpWriteTimeout,
+		BaseContext:  func(net.Listener) context.Context { return requestsCtx },
 	}
 
-	// Dummy authentication service
+	options := repository.Options{
+		LogMode:      cfg.DbLogMode,
+		ReadTimeout:  cfg.DbReadTimeout,
+		WriteTimeout: cfg.DbWriteTimeout,
+	}
+
+	// Authentication service, tokens are issued to the registered API clients
 	key := []byte(cfg.JwtSigningKey)
 	keyFunc := func(*jwt.Token) (interface{}, error) {
 		return key, nil
 	}
-	authSvc := auth.NewService(500, key, keyFunc)
+	authSvc := auth.NewService(500, key, keyFunc, repository.NewClientRepository(db, options))
 
 	// Middleware that will check jwt validity
-	JWTMiddleware := kitjwt.NewParser(keyFunc, jwt.SigningMethodHS256, kitjwt.StandardClaimsFactory)
+	JWTMiddleware := kitjwt.NewParser(keyFunc, jwt.SigningMethodHS256, auth.ClaimsFactory)
 
 	// payment resource endpoints
 	var paymentEndpoints payments.Endpoints
 	{
-		repository := repository.NewPaymentRepository(db)
-		service := payments.NewService(repository)
+		paymentRepository := repository.NewPaymentRepository(db, options)
+		idempotencyRepository := repository.NewIdempotencyRepository(db, options)
+		auditRepository := repository.NewAuditRepository(db, options)
+		unitOfWork := repository.NewUnitOfWork(db, options)
+		deletePolicy := payments.DefaultDeletePolicy
+		if cfg.DeleteMaxAge > 0 {
+			deletePolicy = payments.DeletePolicies(deletePolicy, payments.RefuseOlderThan(cfg.DeleteMaxAge))
+		}
+		service := payments.NewService(paymentRepository, idempotencyRepository, auditRepository, unitOfWork, payments.Options{
+			PurgeRetention:            cfg.PurgeRetention,
+			DeletePolicy:              deletePolicy,
+			IdempotencyReservationTTL: cfg.IdempotencyReservationTTL,
+			FxTolerances:              fxTolerances,
+			Logger:                    errorLogger,
+		})
 		paymentEndpoints = payments.MakeEndpoints(service, tracer, JWTMiddleware)
 	}
 
@@ -114,8 +144,8 @@ func main() {
 				tracer,
 				paymentEndpoints))
 
-			// authentication endpoint to receive a JWT
-			mux.Handle("/auth/", auth.MakeAuthHandler(authSvc, errorLogger, tracer))
+			// authentication endpoints to receive a JWT and manage the API clients
+			mux.Handle("/auth/", auth.MakeAuthHandler(authSvc, JWTMiddleware, errorLogger, tracer))
 			// For liveness probe
 			mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
 			// Expose metrics endpoint
@@ -140,6 +170,8 @@ func main() {
 	// Graceful shutdown
 	log.Print("shutting down...")
 	if err := srv.Shutdown(ctx); err != nil {
+		// cancel the queries of the requests still running
+		cancelRequests()
 		log.Fatal(err)
 	}
 
@@ -90,7 +90,7 @@ const (
 		"amount": "356",
 		"beneficiary_party": {
 			"account_name": "C Parisi",
-			"account_number": "5431230",
+			"account_number": "05431230",
 			"account_number_code": "BBAN",
 			"account_type": 1,
 			"address": "10 Avenue de Rome",
@@ -111,7 +111,7 @@ const (
 		"currency": "GBP",
 		"debtor_party": {
 			"account_name": "G Orwell",
-			"account_number": "GB29XABC10161234567801",
+			"account_number": "GB80XABC20330134567801",
 			"account_number_code": "IBAN",
 			"address": "18 Westside",
 			"bank_id": "203301",
@@ -122,7 +122,7 @@ const (
 		"fx": {
 			"contract_reference": "CP123",
 			"exchange_rate": "1.00000",
-			"original_amount": "190.42",
+			"original_amount": "356.00",
 			"original_currency": "EUR"
 		},
 		"numeric_reference": "1002001",
@@ -144,7 +144,7 @@ const (
 	updateRequest = `{
 		"id": "216d4da9-e59a-4cc6-8df3-3da6e7580b77",
 		"type": "Payment",
-		"version": 1,
+		"version": 0,
 		"organisation_id": "743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb",
 		"attributes": {
 			"id": "08be82ea-d433-4db7-9924-a057450d082b",
@@ -179,7 +179,7 @@ const (
 			"debtor_party": {
 				"attribute_id": "08be82ea-d433-4db7-9924-a057450d082b",
 				"account_name": "EJ Brown Black",
-				"account_number": "GB29XABC10161234567801",
+				"account_number": "GB80XABC20330134567801",
 				"account_number_code": "IBAN",
 				"address": "10 Debtor Crescent Sourcetown NE1",
 				"bank_id": "203301",
@@ -190,7 +190,7 @@ const (
 			"fx": {
 				"attribute_id": "08be82ea-d433-4db7-9924-a057450d082b",
 				"contract_reference": "FX123",
-				"exchange_rate": "2.00000",
+				"exchange_rate": "0.50000",
 				"original_amount": "200.42",
 				"original_currency": "USD"
 			},
@@ -220,9 +220,9 @@ func getToken() string {
 	token := struct {
 		Token string `json:"token"`
 	}{}
-	resp, _ := http.Post(baseURL+"/auth/", "application/json", strings.NewReader(`{
-		"id":"cedric",
-		"secret":"secret"
+	resp, _ := http.Post(baseURL+"/auth/token", "application/json", strings.NewReader(`{
+		"client_id":"cedric",
+		"client_secret":"secret"
 	}`))
 	defer resp.Body.Close()
 
@@ -324,6 +324,7 @@ func Test_GetPayment(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			client.Get(fmt.Sprintf("/payments/%s", tt.id)).
+				SetHeader("Authorization", fmt.Sprintf("Bearer %s", getToken())).
 				Expect(t).
 				Status(tt.expectedStatusCode).
 				JSONSchema(tt.expectedSchema).
@@ -345,7 +346,7 @@ func Test_GetFilteredPayment(t *testing.T) {
 			params: map[string]string{
 				"offset": "0",
 				"limit":  "2",
-				"sort":   "-views",
+				"sort":   "-created_at",
 			},
 			expectedStatusCode: http.StatusOK,
 			expectedSchema:     filteredPaymentsSchema,
@@ -354,6 +355,7 @@ func Test_GetFilteredPayment(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			client.Get("/payments/").
+				SetHeader("Authorization", fmt.Sprintf("Bearer %s", getToken())).
 				Params(tt.params).
 				Expect(t).
 				Status(tt.expectedStatusCode).
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cedric-parisi/payment-api/internal/config"
+	"github.com/jinzhu/gorm"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/internal/payments"
+	"github.com/cedric-parisi/payment-api/internal/repository"
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+)
+
+const (
+	connectionString = "host=%s port=%s user=%s dbname=%s password=%s sslmode=disable"
+
+	// development client, its secret is only meant for local development and integration tests
+	devClientID       = "cedric"
+	devClientSecret   = "secret"
+	devOrganisationID = "743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb"
+)
+
+// seed inserts the payments of mock.json and registers the development client
+// for local development and integration tests
+// The schema must be migrated first, see cmd/migration
+func main() {
+	// Marshal the mock.json file into payments
+	mockFile, err := os.Open("mock.json")
+	if err != nil {
+		log.Fatal("could not open mock.json: ", err)
+	}
+
+	var dest struct {
+		Data []*models.Payment `json:"data"`
+	}
+	if err := json.NewDecoder(mockFile).Decode(&dest); err != nil {
+		log.Fatal("could not decode mockFile: ", err)
+	}
+
+	for _, p := range dest.Data {
+		p.CreatedAt = time.Now().UTC()
+	}
+
+	// setup config
+	cfg := config.SetConfiguration()
+
+	// open connection to db
+	db, err := gorm.Open("postgres", fmt.Sprintf(connectionString, cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbName, cfg.DbPassword))
+	if err != nil {
+		log.Fatal("could not open db connection: ", err)
+	}
+	defer db.Close()
+
+	options := repository.Options{
+		LogMode:      true,
+		WriteTimeout: cfg.DbWriteTimeout,
+	}
+
+	// register the development client
+	clientRepository := repository.NewClientRepository(db, options)
+	if err := clientRepository.InsertClient(context.Background(), &auth.Client{
+		ID:             devClientID,
+		Name:           "development",
+		OrganisationID: devOrganisationID,
+		Scope:          strings.Join([]string{auth.ScopePaymentsRead, auth.ScopePaymentsWrite, auth.ScopePaymentsDelete}, " "),
+		SecretHash:     auth.HashSecret(devClientSecret),
+		CreatedAt:      time.Now().UTC(),
+	}); err != nil {
+		log.Printf("could not register client %s: %s", devClientID, err)
+	}
+
+	// insert mock data
+	paymentRepository := repository.NewPaymentRepository(db, options)
+	for _, p := range dest.Data {
+		// the repository only inserts the payments of the organisation of the context
+		ctx := payments.WithOrganisation(context.Background(), p.OrganisationID)
+		if err := paymentRepository.InsertPayment(ctx, p); err != nil {
+			log.Printf("could not insert payment %s: %s", p.ID, err)
+		}
+	}
+}
@@ -4,10 +4,19 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+const (
+	defaultDbReadTimeout  = 5 * time.Second
+	defaultDbWriteTimeout = 10 * time.Second
+	defaultPurgeRetention = 30 * 24 * time.Hour
+
+	defaultIdempotencyReservationTTL = time.Minute
+)
+
 // Config ...
 type Config struct {
 	AppPort string
@@ -18,8 +27,22 @@ type Config struct {
 	DbPassword string
 	DbName     string
 	DbLogMode  bool
+	// DbReadTimeout bounds every read query, DbWriteTimeout every write transaction
+	DbReadTimeout  time.Duration
+	DbWriteTimeout time.Duration
 
 	JwtSigningKey string
+
+	// PurgeRetention is how long a deleted payment is kept before it can be purged
+	PurgeRetention time.Duration
+	// IdempotencyReservationTTL is how long an Idempotency-Key stays reserved for a request that never completes
+	IdempotencyReservationTTL time.Duration
+	// DeleteMaxAge refuses the deletion of the payments created longer ago, 0 for no limit
+	DeleteMaxAge time.Duration
+
+	// FxTolerances overrides the rounding tolerance of fx conversions per currency pair,
+	// e.g. USDGBP=0.05,EURJPY=2, see models.ParseFxTolerances
+	FxTolerances string
 }
 
 // SetConfiguration reads config from env var
@@ -32,6 +55,28 @@ func SetConfiguration() Config {
 	dbLogMode := false
 	dbLogMode, _ = strconv.ParseBool(os.Getenv("DB_LOG_MODE"))
 
+	dbReadTimeout, err := time.ParseDuration(os.Getenv("DB_READ_TIMEOUT"))
+	if err != nil {
+		dbReadTimeout = defaultDbReadTimeout
+	}
+	dbWriteTimeout, err := time.ParseDuration(os.Getenv("DB_WRITE_TIMEOUT"))
+	if err != nil {
+		dbWriteTimeout = defaultDbWriteTimeout
+	}
+
+	purgeRetention, err := time.ParseDuration(os.Getenv("PURGE_RETENTION"))
+	if err != nil || purgeRetention < 0 {
+		purgeRetention = defaultPurgeRetention
+	}
+
+	idempotencyReservationTTL, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_RESERVATION_TTL"))
+	if err != nil || idempotencyReservationTTL <= 0 {
+		idempotencyReservationTTL = defaultIdempotencyReservationTTL
+	}
+
+	// no limit unless set
+	deleteMaxAge, _ := time.ParseDuration(os.Getenv("DELETE_MAX_AGE"))
+
 	return Config{
 		AppPort: os.Getenv("APP_PORT"),
 
@@ -42,6 +87,15 @@ func SetConfiguration() Config {
 		DbName:     os.Getenv("DB_NAME"),
 		DbLogMode:  dbLogMode,
 
+		DbReadTimeout:  dbReadTimeout,
+		DbWriteTimeout: dbWriteTimeout,
+
 		JwtSigningKey: os.Getenv("JWT_SIGNING_KEY"),
+
+		PurgeRetention:            purgeRetention,
+		IdempotencyReservationTTL: idempotencyReservationTTL,
+		DeleteMaxAge:              deleteMaxAge,
+
+		FxTolerances: os.Getenv("FX_TOLERANCES"),
 	}
 }
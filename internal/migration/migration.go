@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// fileName matches the migration files, e.g. 0001_create_payments.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change and the statements reverting it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads the migrations of the directory ordered by version
+// Every migration needs both an up and a down file, other files are ignored
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	// an empty file is a valid migration, presence is tracked per direction
+	found := map[int]map[string]bool{}
+	for _, f := range files {
+		match := fileName.FindStringSubmatch(f.Name())
+		if f.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid version in %s", f.Name())
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+			found[version] = map[string]bool{}
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("version %d is used by %s and %s", version, m.Name, match[2])
+		}
+
+		stmts, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		found[version][match[3]] = true
+		if match[3] == "up" {
+			m.Up = string(stmts)
+		} else {
+			m.Down = string(stmts)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !found[m.Version]["up"] || !found[m.Version]["down"] {
+			return nil, fmt.Errorf("migration %d_%s needs an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
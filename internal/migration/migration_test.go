@@ -0,0 +1,110 @@
+// +build !integration
+
+package migration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    []Migration
+		wantErr bool
+	}{
+		{
+			name: "migrations are ordered by version",
+			files: map[string]string{
+				"0002_add_index.up.sql":      "CREATE INDEX",
+				"0002_add_index.down.sql":    "DROP INDEX",
+				"0001_create_table.up.sql":   "CREATE TABLE",
+				"0001_create_table.down.sql": "DROP TABLE",
+				"README.md":                  "ignored",
+			},
+			want: []Migration{
+				{Version: 1, Name: "create_table", Up: "CREATE TABLE", Down: "DROP TABLE"},
+				{Version: 2, Name: "add_index", Up: "CREATE INDEX", Down: "DROP INDEX"},
+			},
+		},
+		{
+			name: "empty down file is valid",
+			files: map[string]string{
+				"0001_backfill.up.sql":   "UPDATE",
+				"0001_backfill.down.sql": "",
+			},
+			want: []Migration{
+				{Version: 1, Name: "backfill", Up: "UPDATE"},
+			},
+		},
+		{
+			name: "missing down file",
+			files: map[string]string{
+				"0001_create_table.up.sql": "CREATE TABLE",
+			},
+			wantErr: true,
+		},
+		{
+			name: "version used twice",
+			files: map[string]string{
+				"0001_create_table.up.sql":   "CREATE TABLE",
+				"0001_create_table.down.sql": "DROP TABLE",
+				"0001_add_index.up.sql":      "CREATE INDEX",
+				"0001_add_index.down.sql":    "DROP INDEX",
+			},
+			wantErr: true,
+		},
+		{
+			name: "version 0 is reserved",
+			files: map[string]string{
+				"0000_create_table.up.sql":   "CREATE TABLE",
+				"0000_create_table.down.sql": "DROP TABLE",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			dir, err := ioutil.TempDir("", "migrations")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, content := range tt.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Act
+			got, err := Load(dir)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_Repository(t *testing.T) {
+	got, err := Load("../../migrations")
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for i, m := range got {
+		if m.Version != i+1 {
+			t.Errorf("Load() version %d_%s, want %d", m.Version, m.Name, i+1)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version integer PRIMARY KEY,
+	name text NOT NULL,
+	applied_at timestamp with time zone NOT NULL DEFAULT now()
+)`
+	selectApplied = `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`
+	insertApplied = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	deleteApplied = `DELETE FROM schema_migrations WHERE version = $1`
+	lock          = `SELECT pg_advisory_lock($1)`
+	unlock        = `SELECT pg_advisory_unlock($1)`
+
+	// lockKey identifies the advisory lock held by a migrator while it runs
+	lockKey = 4275307187
+)
+
+// Step is a migration run by the migrator, Reverted is true when it was reverted
+type Step struct {
+	Migration
+	Reverted bool
+}
+
+// State is a migration known by the migrator or recorded in schema_migrations
+// AppliedAt is nil for a pending migration, a migration applied without
+// its files has no statements
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies and reverts migrations, the applied versions are
+// recorded in the schema_migrations table
+// Each migration runs in its own transaction with its record
+// A migrator holds an advisory lock while it runs, so that migrators
+// started together, e.g. by replicas, run one after the other
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator ...
+func NewMigrator(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) ([]Step, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the last applied migration
+func (m *Migrator) Down(ctx context.Context) (steps []Step, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return nil
+		}
+		last := applied[len(applied)-1]
+		steps, err = m.run(ctx, conn, []Step{{Migration: last.Migration, Reverted: true}})
+		return err
+	})
+	return steps, err
+}
+
+// To reverts the applied migrations above version, newest first,
+// then applies the pending migrations up to version, oldest first
+// Version 0 reverts every migration
+func (m *Migrator) To(ctx context.Context, version int) (steps []Step, err error) {
+	if version != 0 && m.find(version) == nil {
+		return nil, fmt.Errorf("unknown migration %d", version)
+	}
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var pending []Step
+		isApplied := map[int]bool{}
+		for i := len(applied) - 1; i >= 0; i-- {
+			isApplied[applied[i].Version] = true
+			if applied[i].Version > version {
+				pending = append(pending, Step{Migration: applied[i].Migration, Reverted: true})
+			}
+		}
+		for _, migration := range m.migrations {
+			if migration.Version <= version && !isApplied[migration.Version] {
+				pending = append(pending, Step{Migration: migration})
+			}
+		}
+		steps, err = m.run(ctx, conn, pending)
+		return err
+	})
+	return steps, err
+}
+
+// Status returns the known and the applied migrations ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	var applied []State
+	err := m.locked(ctx, func(conn *sql.Conn) (err error) {
+		applied, err = m.applied(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(m.migrations))
+	i := 0
+	for _, migration := range m.migrations {
+		for ; i < len(applied) && applied[i].Version < migration.Version; i++ {
+			states = append(states, applied[i])
+		}
+		state := State{Migration: migration}
+		if i < len(applied) && applied[i].Version == migration.Version {
+			state.AppliedAt = applied[i].AppliedAt
+			i++
+		}
+		states = append(states, state)
+	}
+	return append(states, applied[i:]...), nil
+}
+
+// locked runs fn on a connection holding the advisory lock of the migrators
+// The lock belongs to the session, the statements of fn must go through the connection
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, lock, lockKey); err != nil {
+		return fmt.Errorf("could not lock the migrations: %s", err)
+	}
+	// the lock is released even when ctx is done, the connection goes back to the pool
+	defer conn.ExecContext(context.Background(), unlock, lockKey)
+
+	return fn(conn)
+}
+
+// applied returns the applied migrations ordered by version
+// with the statements of their files when they are known
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) ([]State, error) {
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return nil, fmt.Errorf("could not create schema_migrations: %s", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, selectApplied)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []State
+	for rows.Next() {
+		var state State
+		var appliedAt time.Time
+		if err := rows.Scan(&state.Version, &state.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		if known := m.find(state.Version); known != nil {
+			state.Migration = *known
+		}
+		state.AppliedAt = &appliedAt
+		applied = append(applied, state)
+	}
+	return applied, rows.Err()
+}
+
+// run runs the steps in order and stops at the first failure
+// The steps run before the failure are returned
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, steps []Step) ([]Step, error) {
+	for i, step := range steps {
+		if step.Reverted && m.find(step.Version) == nil {
+			return steps[:i], fmt.Errorf("no down migration for version %d_%s", step.Version, step.Name)
+		}
+		if err := m.runStep(ctx, conn, step); err != nil {
+			return steps[:i], fmt.Errorf("migration %d_%s failed: %s", step.Version, step.Name, err)
+		}
+	}
+	return steps, nil
+}
+
+func (m *Migrator) runStep(ctx context.Context, conn *sql.Conn, step Step) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmts, record, args := step.Up, insertApplied, []interface{}{step.Version, step.Name}
+	if step.Reverted {
+		stmts, record, args = step.Down, deleteApplied, []interface{}{step.Version}
+	}
+	if strings.TrimSpace(stmts) != "" {
+		if _, err = tx.ExecContext(ctx, stmts); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// +build !integration
+
+package migration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "create_table", Up: "CREATE TABLE t", Down: "DROP TABLE t"},
+	{Version: 2, Name: "add_index", Up: "CREATE INDEX i", Down: "DROP INDEX i"},
+}
+
+func expectLock(m sqlmock.Sqlmock) {
+	m.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectUnlock(m sqlmock.Sqlmock) {
+	m.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectApplied(m sqlmock.Sqlmock, versions ...int) {
+	m.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, v := range versions {
+		name := "unknown"
+		for _, migration := range testMigrations {
+			if migration.Version == v {
+				name = migration.Name
+			}
+		}
+		rows.AddRow(v, name, time.Now())
+	}
+	m.ExpectQuery(`SELECT version, name, applied_at FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func expectUp(m sqlmock.Sqlmock, migration Migration) {
+	m.ExpectBegin()
+	m.ExpectExec(migration.Up).WillReturnResult(sqlmock.NewResult(0, 0))
+	m.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(migration.Version, migration.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectCommit()
+}
+
+func expectDown(m sqlmock.Sqlmock, migration Migration) {
+	m.ExpectBegin()
+	m.ExpectExec(migration.Down).WillReturnResult(sqlmock.NewResult(0, 0))
+	m.ExpectExec(`DELETE FROM schema_migrations`).WithArgs(migration.Version).WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectCommit()
+}
+
+func TestMigrator(t *testing.T) {
+	tests := []struct {
+		name      string
+		run       func(m *Migrator) ([]Step, error)
+		want      []Step
+		wantErr   bool
+		unlocked  bool
+		mockCalls func(m sqlmock.Sqlmock)
+	}{
+		{
+			name: "up applies every pending migration in order",
+			run:  func(m *Migrator) ([]Step, error) { return m.Up(context.Background()) },
+			want: []Step{{Migration: testMigrations[0]}, {Migration: testMigrations[1]}},
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m)
+				expectUp(m, testMigrations[0])
+				expectUp(m, testMigrations[1])
+			},
+		},
+		{
+			name: "up skips the applied migrations",
+			run:  func(m *Migrator) ([]Step, error) { return m.Up(context.Background()) },
+			want: []Step{{Migration: testMigrations[1]}},
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m, 1)
+				expectUp(m, testMigrations[1])
+			},
+		},
+		{
+			name: "up on an up to date schema does nothing",
+			run:  func(m *Migrator) ([]Step, error) { return m.Up(context.Background()) },
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m, 1, 2)
+			},
+		},
+		{
+			name: "down reverts the last applied migration",
+			run:  func(m *Migrator) ([]Step, error) { return m.Down(context.Background()) },
+			want: []Step{{Migration: testMigrations[1], Reverted: true}},
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m, 1, 2)
+				expectDown(m, testMigrations[1])
+			},
+		},
+		{
+			name: "down without applied migration does nothing",
+			run:  func(m *Migrator) ([]Step, error) { return m.Down(context.Background()) },
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m)
+			},
+		},
+		{
+			name:    "down fails on an applied migration without files",
+			run:     func(m *Migrator) ([]Step, error) { return m.Down(context.Background()) },
+			want:    []Step{},
+			wantErr: true,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m, 1, 2, 3)
+			},
+		},
+		{
+			name: "to 0 reverts every migration newest first",
+			run:  func(m *Migrator) ([]Step, error) { return m.To(context.Background(), 0) },
+			want: []Step{{Migration: testMigrations[1], Reverted: true}, {Migration: testMigrations[0], Reverted: true}},
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m, 1, 2)
+				expectDown(m, testMigrations[1])
+				expectDown(m, testMigrations[0])
+			},
+		},
+		{
+			name: "to applies the pending migrations up to the version",
+			run:  func(m *Migrator) ([]Step, error) { return m.To(context.Background(), 1) },
+			want: []Step{{Migration: testMigrations[0]}},
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m)
+				expectUp(m, testMigrations[0])
+			},
+		},
+		{
+			name:      "to an unknown version",
+			run:       func(m *Migrator) ([]Step, error) { return m.To(context.Background(), 3) },
+			wantErr:   true,
+			unlocked:  true,
+			mockCalls: func(m sqlmock.Sqlmock) {},
+		},
+		{
+			name:     "nothing runs without the lock",
+			run:      func(m *Migrator) ([]Step, error) { return m.Up(context.Background()) },
+			wantErr:  true,
+			unlocked: true,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectExec(`SELECT pg_advisory_lock`).WillReturnError(errors.New("failed"))
+			},
+		},
+		{
+			name:    "failed migration is rolled back and stops the run",
+			run:     func(m *Migrator) ([]Step, error) { return m.Up(context.Background()) },
+			want:    []Step{{Migration: testMigrations[0]}},
+			wantErr: true,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				expectApplied(m)
+				expectUp(m, testMigrations[0])
+				m.ExpectBegin()
+				m.ExpectExec(testMigrations[1].Up).WillReturnError(errors.New("failed"))
+				m.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, mock, _ := sqlmock.New()
+			if !tt.unlocked {
+				expectLock(mock)
+			}
+			tt.mockCalls(mock)
+			if !tt.unlocked {
+				expectUnlock(mock)
+			}
+			migrator := NewMigrator(db, testMigrations)
+
+			// Act
+			got, err := tt.run(migrator)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Migrator error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMigrator_Status(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	expectLock(mock)
+	expectApplied(mock, 1, 3)
+	expectUnlock(mock)
+	migrator := NewMigrator(db, testMigrations)
+
+	got, err := migrator.Status(context.Background())
+
+	assert.NoError(t, err)
+	if assert.Len(t, got, 3) {
+		assert.Equal(t, 1, got[0].Version)
+		assert.NotNil(t, got[0].AppliedAt)
+		assert.Equal(t, 2, got[1].Version)
+		assert.Nil(t, got[1].AppliedAt)
+		assert.Equal(t, 3, got[2].Version)
+		assert.Equal(t, "unknown", got[2].Name)
+		assert.NotNil(t, got[2].AppliedAt)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
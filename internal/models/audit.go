@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/pkg/patch"
+)
+
+// Audit actions, one per mutation of a payment
+const (
+	AuditCreate     = "create"
+	AuditUpdate     = "update"
+	AuditPatch      = "patch"
+	AuditDelete     = "delete"
+	AuditTransition = "transition"
+	AuditRestore    = "restore"
+	AuditPurge      = "purge"
+)
+
+// AuditEntry records a mutation of a payment
+// Entries are only appended, the storage refuses to update or delete them
+type AuditEntry struct {
+	ID        uuid.UUID `json:"id" gorm:"primary_key"`
+	PaymentID uuid.UUID `json:"payment_id"`
+	// OrganisationID is the organisation of the payment, only its members read the entry
+	OrganisationID uuid.UUID `json:"organisation_id"`
+	Action         string    `json:"action"`
+	// Actor is the subject of the token of the request
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id"`
+	// Version is the version of the payment after the mutation
+	Version   int       `json:"version"`
+	Changes   Changes   `json:"changes" gorm:"type:jsonb"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Changes are the differences between the JSON representations
+// of the payment before and after a mutation
+type Changes []patch.Change
+
+// Value stores the changes as a JSON array
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	raw, err := json.Marshal([]patch.Change(c))
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// Scan reads the changes from a JSON array
+func (c *Changes) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into changes", src)
+	}
+	return json.Unmarshal(raw, (*[]patch.Change)(c))
+}
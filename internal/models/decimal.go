@@ -0,0 +1,138 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var decimalRegex = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Decimal is an exact decimal number, e.g. an amount or an exchange rate
+// It keeps the scale it was written with, 5.00 is read and written back as 5.00
+// On the wire it is a JSON string as plain strings were, the empty string
+// being an unset decimal, and it is stored as a NUMERIC, NULL when unset
+type Decimal struct {
+	// text is the decimal as parsed, empty when unset
+	text string
+}
+
+// ParseDecimal reads a decimal such as 100.21 or -2, the empty string is an unset decimal
+// Exponents, signs other than a leading minus and thousands separators are rejected
+func ParseDecimal(s string) (Decimal, error) {
+	if s == "" {
+		return Decimal{}, nil
+	}
+	if !decimalRegex.MatchString(s) {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	return Decimal{text: s}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics on an invalid decimal
+// It is meant for constants and tests
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// IsSet returns false for an unset decimal
+func (d Decimal) IsSet() bool {
+	return d.text != ""
+}
+
+// String returns the decimal as written, the empty string when unset
+func (d Decimal) String() string {
+	return d.text
+}
+
+// Scale returns the number of digits after the decimal point
+func (d Decimal) Scale() int {
+	if i := strings.IndexByte(d.text, '.'); i >= 0 {
+		return len(d.text) - i - 1
+	}
+	return 0
+}
+
+// Rat returns the exact value of the decimal, 0 when unset
+func (d Decimal) Rat() *big.Rat {
+	r := new(big.Rat)
+	if d.IsSet() {
+		r.SetString(d.text)
+	}
+	return r
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the decimal, 0 when unset
+func (d Decimal) Sign() int {
+	return d.Rat().Sign()
+}
+
+// Cmp compares the values of the decimals regardless of their scales
+// It returns -1 if d < o, 0 if d == o and +1 if d > o
+func (d Decimal) Cmp(o Decimal) int {
+	return d.Rat().Cmp(o.Rat())
+}
+
+// MarshalJSON writes the decimal as a JSON string
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.text)
+}
+
+// UnmarshalJSON reads a decimal from a JSON string, null and "" are unset decimals
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("decimal must be a string, got %s", data)
+	}
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value stores the decimal as a NUMERIC
+func (d Decimal) Value() (driver.Value, error) {
+	if !d.IsSet() {
+		return nil, nil
+	}
+	return d.text, nil
+}
+
+// Scan reads a NUMERIC column
+func (d *Decimal) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("cannot scan %T into a decimal", src)
+	}
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
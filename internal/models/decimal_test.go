@@ -0,0 +1,105 @@
+// +build !integration
+
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantScale int
+		wantErr   bool
+	}{
+		{name: "integer", value: "100", wantScale: 0},
+		{name: "decimal keeps its scale", value: "5.00", wantScale: 2},
+		{name: "negative decimal", value: "-2.5", wantScale: 1},
+		{name: "empty is unset", value: ""},
+		{name: "letters", value: "abc", wantErr: true},
+		{name: "exponent", value: "1e3", wantErr: true},
+		{name: "thousands separator", value: "1,000.00", wantErr: true},
+		{name: "missing integer part", value: ".5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDecimal(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDecimal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, tt.value, got.String())
+			assert.Equal(t, tt.wantScale, got.Scale())
+		})
+	}
+}
+
+func TestDecimal_Cmp(t *testing.T) {
+	assert.Equal(t, 0, MustParseDecimal("5").Cmp(MustParseDecimal("5.00")))
+	assert.Equal(t, -1, MustParseDecimal("9.99").Cmp(MustParseDecimal("10")))
+	assert.Equal(t, 1, MustParseDecimal("0.1").Cmp(MustParseDecimal("-1")))
+	assert.Equal(t, 0, Decimal{}.Cmp(MustParseDecimal("0")))
+}
+
+func TestDecimal_JSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    string
+		wantErr bool
+	}{
+		{name: "string round trips with its scale", json: `"200.420"`, want: `"200.420"`},
+		{name: "empty string is unset", json: `""`, want: `""`},
+		{name: "null is unset", json: `null`, want: `""`},
+		{name: "number is rejected", json: `200.42`, wantErr: true},
+		{name: "invalid decimal is rejected", json: `"abc"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Decimal
+			err := json.Unmarshal([]byte(tt.json), &d)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decimal.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := json.Marshal(d)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestDecimal_Scan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Decimal
+		wantErr bool
+	}{
+		{name: "numeric column", src: []byte("5.00"), want: MustParseDecimal("5.00")},
+		{name: "null column", src: nil, want: Decimal{}},
+		{name: "integer", src: int64(42), want: MustParseDecimal("42")},
+		{name: "unsupported type", src: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Decimal
+			err := got.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decimal.Scan() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
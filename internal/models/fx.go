@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// FxTolerances holds the rounding tolerance of the conversions per currency pair
+// A pair is the original currency followed by the payment currency, e.g. USDGBP
+// A pair without tolerance accepts a difference of one minor unit of the payment currency
+type FxTolerances map[string]Decimal
+
+// ParseFxTolerances reads tolerances formatted as PAIR=TOLERANCE separated by commas,
+// e.g. USDGBP=0.05,EURJPY=2
+func ParseFxTolerances(s string) (FxTolerances, error) {
+	tolerances := FxTolerances{}
+	if strings.TrimSpace(s) == "" {
+		return tolerances, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || len(parts[0]) != 6 || !IsCurrency(parts[0][:3]) || !IsCurrency(parts[0][3:]) {
+			return nil, fmt.Errorf("invalid fx tolerance %q, expected a pair of currencies such as USDGBP=0.01", entry)
+		}
+		tolerance, err := ParseDecimal(parts[1])
+		if err != nil || !tolerance.IsSet() || tolerance.Sign() < 0 {
+			return nil, fmt.Errorf("invalid fx tolerance %q, expected a positive decimal", entry)
+		}
+		tolerances[parts[0]] = tolerance
+	}
+	return tolerances, nil
+}
+
+// tolerance returns the tolerance of the conversion from original to currency
+func (t FxTolerances) tolerance(original, currency string) (Decimal, bool) {
+	if tolerance, ok := t[original+currency]; ok {
+		return tolerance, true
+	}
+	units, ok := MinorUnits(currency)
+	if !ok {
+		return Decimal{}, false
+	}
+	if units == 0 {
+		return Decimal{text: "1"}, true
+	}
+	return Decimal{text: "0." + strings.Repeat("0", units-1) + "1"}, true
+}
+
+// validateConversion checks the attribute amount is the original amount
+// converted at the exchange rate, within the tolerance of the currency pair
+// The conversion is only checked when every figure of it is present and valid,
+// the other validations report the missing and invalid ones
+func (f *Fx) validateConversion(v *validator, path string, amount Decimal, currency string) {
+	if f.OriginalCurrency != "" && f.OriginalCurrency == currency {
+		v.add(path+".fx.original_currency", "must differ from the payment currency %s", currency)
+		return
+	}
+	if !amount.IsSet() || !f.OriginalAmount.IsSet() || !f.ExchangeRate.IsSet() ||
+		amount.Sign() < 0 || f.OriginalAmount.Sign() < 0 || f.ExchangeRate.Sign() < 0 ||
+		!IsCurrency(f.OriginalCurrency) {
+		return
+	}
+	tolerance, ok := v.fxTolerances.tolerance(f.OriginalCurrency, currency)
+	if !ok {
+		return
+	}
+
+	converted := new(big.Rat).Mul(f.OriginalAmount.Rat(), f.ExchangeRate.Rat())
+	diff := new(big.Rat).Sub(amount.Rat(), converted)
+	if diff.Abs(diff).Cmp(tolerance.Rat()) > 0 {
+		units, _ := MinorUnits(currency)
+		v.add(path+".amount", "must be %s %s × %s = %s %s within %s, got %s",
+			f.OriginalAmount, f.OriginalCurrency, f.ExchangeRate, converted.FloatString(units), currency,
+			tolerance, amount)
+	}
+}
@@ -0,0 +1,138 @@
+// +build !integration
+
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFx_validateConversion(t *testing.T) {
+	tests := []struct {
+		name       string
+		tolerances FxTolerances
+		payment    func(p *Payment)
+		wantFields []string
+	}{
+		{
+			name:    "amount is the converted original amount",
+			payment: func(p *Payment) {},
+		},
+		{
+			name: "rounding within one minor unit is accepted",
+			payment: func(p *Payment) {
+				p.Attribute.Amount = MustParseDecimal("100.22")
+			},
+		},
+		{
+			name: "amount differs from the converted original amount",
+			payment: func(p *Payment) {
+				p.Attribute.Amount = MustParseDecimal("400.84")
+			},
+			wantFields: []string{"attributes.amount"},
+		},
+		{
+			name:       "tolerance of the currency pair is used",
+			tolerances: FxTolerances{"USDGBP": MustParseDecimal("0.50")},
+			payment: func(p *Payment) {
+				p.Attribute.Amount = MustParseDecimal("100.60")
+			},
+		},
+		{
+			name:       "tolerance of another pair is not used",
+			tolerances: FxTolerances{"EURGBP": MustParseDecimal("0.50")},
+			payment: func(p *Payment) {
+				p.Attribute.Amount = MustParseDecimal("100.60")
+			},
+			wantFields: []string{"attributes.amount"},
+		},
+		{
+			name: "original currency is the payment currency",
+			payment: func(p *Payment) {
+				p.Attribute.Fx.OriginalCurrency = "GBP"
+			},
+			wantFields: []string{"attributes.fx.original_currency"},
+		},
+		{
+			name: "incomplete conversion is not checked",
+			payment: func(p *Payment) {
+				p.Attribute.Fx.ExchangeRate = Decimal{}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			p := newValidPayment(uuid.New())
+			tt.payment(p)
+
+			// Act
+			err := p.Validate(tt.tolerances)
+
+			// Assert
+			if tt.wantFields == nil {
+				assert.NoError(t, err)
+				return
+			}
+			errs, ok := err.(ValidationErrors)
+			if !assert.True(t, ok, "expected ValidationErrors, got %T", err) {
+				return
+			}
+			var fields []string
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			assert.Equal(t, tt.wantFields, fields)
+		})
+	}
+}
+
+func TestParseFxTolerances(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    FxTolerances
+		wantErr bool
+	}{
+		{
+			name:  "no tolerance",
+			value: "",
+			want:  FxTolerances{},
+		},
+		{
+			name:  "tolerances of several pairs",
+			value: "USDGBP=0.05, EURJPY=2",
+			want: FxTolerances{
+				"USDGBP": MustParseDecimal("0.05"),
+				"EURJPY": MustParseDecimal("2"),
+			},
+		},
+		{
+			name:    "unknown currency",
+			value:   "USDXXX=0.05",
+			wantErr: true,
+		},
+		{
+			name:    "negative tolerance",
+			value:   "USDGBP=-1",
+			wantErr: true,
+		},
+		{
+			name:    "missing tolerance",
+			value:   "USDGBP",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFxTolerances(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseFxTolerances() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey records a request sent with an Idempotency-Key header
+// so that a retry replays the original response instead of executing again
+// Keys are scoped to the organisation of the caller
+type IdempotencyKey struct {
+	OrganisationID uuid.UUID `gorm:"primary_key"`
+	Key            string    `gorm:"primary_key"`
+	// Fingerprint identifies the request body the key was first used with
+	Fingerprint string `gorm:"not null"`
+	// Response is the JSON response body, empty while the request is being processed
+	Response string `gorm:"type:text"`
+	// Token identifies the reservation of the request processing the key
+	// A request only completes or releases the key while it still holds its reservation
+	Token     uuid.UUID
+	CreatedAt time.Time
+}
@@ -1,7 +1,7 @@
 package models
 
 import (
-	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,23 +17,56 @@ const (
 	WithdrawType = "Withdraw"
 )
 
+// Status is the lifecycle state of a payment
+type Status string
+
+const (
+	// StatusPending is the state of a newly created payment
+	StatusPending Status = "pending"
+	// StatusSubmitted is the state of a payment sent for processing
+	StatusSubmitted Status = "submitted"
+	// StatusAccepted is the state of a payment accepted by the scheme
+	StatusAccepted Status = "accepted"
+	// StatusSettled is the state of a payment whose funds moved
+	StatusSettled Status = "settled"
+	// StatusRejected is the state of a payment refused by the scheme
+	StatusRejected Status = "rejected"
+	// StatusCancelled is the state of a payment withdrawn before settlement
+	StatusCancelled Status = "cancelled"
+)
+
+// Statuses lists every payment status
+var Statuses = []Status{StatusPending, StatusSubmitted, StatusAccepted, StatusSettled, StatusRejected, StatusCancelled}
+
+// IsValid reports whether the status is a known one
+func (s Status) IsValid() bool {
+	for _, status := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // Payment define a payment
 type Payment struct {
 	ID             uuid.UUID  `json:"id" gorm:"primary_key"`
 	Type           Type       `json:"type"`
+	Status         Status     `json:"status" gorm:"not null;default:'pending'"`
 	Version        int        `json:"version"`
 	OrganisationID uuid.UUID  `json:"organisation_id"`
 	Attribute      *Attribute `json:"attributes"`
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      *time.Time `json:"updated_at"`
-	DeletedAt      *time.Time `json:"-"`
+	// DeletedAt is only set on the deleted payments listed with include_deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 // Attribute ...
 type Attribute struct {
 	ID                   uuid.UUID           `json:"id" gorm:"primary_key"`
 	PaymentID            uuid.UUID           `json:"payment_id" gorm:"foreign_key"`
-	Amount               string              `json:"amount"`
+	Amount               Decimal             `json:"amount" gorm:"type:numeric"`
 	BeneficiaryParty     *BeneficiaryParty   `json:"beneficiary_party"`
 	ChargesInformation   *ChargesInformation `json:"charges_information"`
 	Currency             string              `json:"currency"`
@@ -49,19 +82,22 @@ type Attribute struct {
 	SchemePaymentSubType string              `json:"scheme_payment_sub_type"`
 	SchemePaymentType    string              `json:"scheme_payment_type"`
 	SponsorParty         *SponsorParty       `json:"sponsor_party"`
+	// DeletedAt is the one of the payment, children are deleted and restored with it
+	DeletedAt *time.Time `json:"-"`
 }
 
 // BeneficiaryParty ...
 type BeneficiaryParty struct {
-	AttributeID       uuid.UUID `json:"attribute_id" gorm:"foreign_key"`
-	AccountName       string    `json:"account_name"`
-	AccountNumber     string    `json:"account_number"`
-	AccountNumberCode string    `json:"account_number_code"`
-	AccountType       int       `json:"account_type"`
-	Address           string    `json:"address"`
-	BankID            string    `json:"bank_id"`
-	BankIDCode        string    `json:"bank_id_code"`
-	Name              string    `json:"name"`
+	AttributeID       uuid.UUID  `json:"attribute_id" gorm:"foreign_key"`
+	AccountName       string     `json:"account_name"`
+	AccountNumber     string     `json:"account_number"`
+	AccountNumberCode string     `json:"account_number_code"`
+	AccountType       int        `json:"account_type"`
+	Address           string     `json:"address"`
+	BankID            string     `json:"bank_id"`
+	BankIDCode        string     `json:"bank_id_code"`
+	Name              string     `json:"name"`
+	DeletedAt         *time.Time `json:"-"`
 }
 
 // ChargesInformation ...
@@ -70,61 +106,164 @@ type ChargesInformation struct {
 	AttributeID             uuid.UUID       `json:"attribute_id" gorm:"foreign_key"`
 	BearerCode              string          `json:"bearer_code"`
 	SenderCharges           []*SenderCharge `json:"sender_charges"`
-	ReceiverChargesAmount   string          `json:"receiver_charges_amount"`
+	ReceiverChargesAmount   Decimal         `json:"receiver_charges_amount" gorm:"type:numeric"`
 	ReceiverChargesCurrency string          `json:"receiver_charges_currency"`
+	DeletedAt               *time.Time      `json:"-"`
 }
 
 // SenderCharge ...
 type SenderCharge struct {
-	ChargesInformationID uuid.UUID `json:"charges_information_id" gorm:"foreign_key"`
-	Amount               string    `json:"amount"`
-	Currency             string    `json:"currency"`
+	ChargesInformationID uuid.UUID  `json:"charges_information_id" gorm:"foreign_key"`
+	Amount               Decimal    `json:"amount" gorm:"type:numeric"`
+	Currency             string     `json:"currency"`
+	DeletedAt            *time.Time `json:"-"`
 }
 
 // DebtorParty ...
 type DebtorParty struct {
-	AttributeID       uuid.UUID `json:"attribute_id" gorm:"foreign_key"`
-	AccountName       string    `json:"account_name"`
-	AccountNumber     string    `json:"account_number"`
-	AccountNumberCode string    `json:"account_number_code"`
-	Address           string    `json:"address"`
-	BankID            string    `json:"bank_id"`
-	BankIDCode        string    `json:"bank_id_code"`
-	Name              string    `json:"name"`
+	AttributeID       uuid.UUID  `json:"attribute_id" gorm:"foreign_key"`
+	AccountName       string     `json:"account_name"`
+	AccountNumber     string     `json:"account_number"`
+	AccountNumberCode string     `json:"account_number_code"`
+	Address           string     `json:"address"`
+	BankID            string     `json:"bank_id"`
+	BankIDCode        string     `json:"bank_id_code"`
+	Name              string     `json:"name"`
+	DeletedAt         *time.Time `json:"-"`
 }
 
 // Fx ...
 type Fx struct {
-	AttributeID       uuid.UUID `json:"attribute_id" gorm:"foreign_key"`
-	ContractReference string    `json:"contract_reference"`
-	ExchangeRate      string    `json:"exchange_rate"`
-	OriginalAmount    string    `json:"original_amount"`
-	OriginalCurrency  string    `json:"original_currency"`
+	AttributeID       uuid.UUID  `json:"attribute_id" gorm:"foreign_key"`
+	ContractReference string     `json:"contract_reference"`
+	ExchangeRate      Decimal    `json:"exchange_rate" gorm:"type:numeric"`
+	OriginalAmount    Decimal    `json:"original_amount" gorm:"type:numeric"`
+	OriginalCurrency  string     `json:"original_currency"`
+	DeletedAt         *time.Time `json:"-"`
 }
 
 // SponsorParty ...
 type SponsorParty struct {
-	AttributeID   uuid.UUID `json:"attribute_id" gorm:"foreign_key"`
-	AccountNumber string    `json:"account_number"`
-	BankID        string    `json:"bank_id"`
-	BankIDCode    string    `json:"bank_id_code"`
+	AttributeID   uuid.UUID  `json:"attribute_id" gorm:"foreign_key"`
+	AccountNumber string     `json:"account_number"`
+	BankID        string     `json:"bank_id"`
+	BankIDCode    string     `json:"bank_id_code"`
+	DeletedAt     *time.Time `json:"-"`
 }
 
 // Validate ensures that the payment is valid
-func (p *Payment) Validate() error {
+// The fx conversion is checked within the given tolerances, see FxTolerances
+// Returns ValidationErrors listing every invalid field
+func (p *Payment) Validate(fxTolerances FxTolerances) error {
+	v := &validator{fxTolerances: fxTolerances}
+
 	if p.Type != PaymentType && p.Type != WithdrawType {
-		return errors.New("invalid payment type")
+		v.add("type", "must be one of %s, %s, got %q", PaymentType, WithdrawType, p.Type)
+	}
+
+	if p.Status != "" && !p.Status.IsValid() {
+		v.add("status", "must be one of %v, got %q", Statuses, p.Status)
+	}
+
+	if p.OrganisationID == uuid.Nil {
+		v.add("organisation_id", "is required")
+	}
+
+	if p.Version < 0 {
+		v.add("version", "must be positive, got %d", p.Version)
 	}
 
 	if p.Attribute == nil {
-		return errors.New("attribute is required")
+		v.add("attributes", "is required")
+		return v.err()
 	}
 
 	if p.ID != p.Attribute.PaymentID {
-		return errors.New("attribute and payment not related")
+		v.add("attributes.payment_id", "must match the payment id")
+	}
+
+	p.Attribute.validate(v, "attributes")
+
+	return v.err()
+}
+
+func (a *Attribute) validate(v *validator, path string) {
+	if v.requiredDecimal(path+".amount", a.Amount) {
+		v.money(path+".amount", a.Amount, a.Currency)
+	}
+	if v.required(path+".currency", a.Currency) {
+		v.currency(path+".currency", a.Currency)
+	}
+	if v.required(path+".processing_date", a.ProcessingDate) {
+		v.date(path+".processing_date", a.ProcessingDate)
 	}
+	v.numeric(path+".numeric_reference", a.NumericReference)
 
-	// TODO validate all fields
+	if a.BeneficiaryParty != nil {
+		a.BeneficiaryParty.validate(v, path+".beneficiary_party")
+	}
+	if a.ChargesInformation != nil {
+		a.ChargesInformation.validate(v, path+".charges_information")
+	}
+	if a.DebtorParty != nil {
+		a.DebtorParty.validate(v, path+".debtor_party")
+	}
+	if a.Fx != nil {
+		a.Fx.validate(v, path+".fx")
+		a.Fx.validateConversion(v, path, a.Amount, a.Currency)
+	}
+	if a.SponsorParty != nil {
+		a.SponsorParty.validate(v, path+".sponsor_party")
+	}
+}
+
+func (b *BeneficiaryParty) validate(v *validator, path string) {
+	v.oneOf(path+".account_number_code", b.AccountNumberCode, accountNumberCodes)
+	v.oneOfInt(path+".account_type", b.AccountType, accountTypes)
+	v.oneOf(path+".bank_id_code", b.BankIDCode, bankIDCodes)
+	v.bankAccount(path, b.AccountNumber, b.AccountNumberCode, b.BankID, b.BankIDCode)
+}
+
+func (c *ChargesInformation) validate(v *validator, path string) {
+	v.oneOf(path+".bearer_code", c.BearerCode, bearerCodes)
+
+	for i, s := range c.SenderCharges {
+		if s == nil {
+			v.add(fmt.Sprintf("%s.sender_charges[%d]", path, i), "must not be null")
+			continue
+		}
+		s.validate(v, fmt.Sprintf("%s.sender_charges[%d]", path, i))
+	}
+
+	v.money(path+".receiver_charges_amount", c.ReceiverChargesAmount, c.ReceiverChargesCurrency)
+	v.currency(path+".receiver_charges_currency", c.ReceiverChargesCurrency)
+	if c.ReceiverChargesAmount.IsSet() {
+		v.required(path+".receiver_charges_currency", c.ReceiverChargesCurrency)
+	}
+}
+
+func (s *SenderCharge) validate(v *validator, path string) {
+	if v.requiredDecimal(path+".amount", s.Amount) {
+		v.money(path+".amount", s.Amount, s.Currency)
+	}
+	if v.required(path+".currency", s.Currency) {
+		v.currency(path+".currency", s.Currency)
+	}
+}
+
+func (d *DebtorParty) validate(v *validator, path string) {
+	v.oneOf(path+".account_number_code", d.AccountNumberCode, accountNumberCodes)
+	v.oneOf(path+".bank_id_code", d.BankIDCode, bankIDCodes)
+	v.bankAccount(path, d.AccountNumber, d.AccountNumberCode, d.BankID, d.BankIDCode)
+}
+
+func (f *Fx) validate(v *validator, path string) {
+	v.positive(path+".exchange_rate", f.ExchangeRate)
+	v.money(path+".original_amount", f.OriginalAmount, f.OriginalCurrency)
+	v.currency(path+".original_currency", f.OriginalCurrency)
+}
 
-	return nil
+func (s *SponsorParty) validate(v *validator, path string) {
+	v.oneOf(path+".bank_id_code", s.BankIDCode, bankIDCodes)
+	v.bankAccount(path, s.AccountNumber, "", s.BankID, s.BankIDCode)
 }
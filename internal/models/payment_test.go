@@ -6,58 +6,252 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 )
 
+func newValidPayment(id uuid.UUID) *Payment {
+	return &Payment{
+		ID:             id,
+		Type:           PaymentType,
+		OrganisationID: uuid.New(),
+		Attribute: &Attribute{
+			PaymentID: id,
+			Amount:    MustParseDecimal("100.21"),
+			BeneficiaryParty: &BeneficiaryParty{
+				AccountNumber:     "31926819",
+				AccountNumberCode: "BBAN",
+				BankID:            "403000",
+				BankIDCode:        "GBDSC",
+			},
+			ChargesInformation: &ChargesInformation{
+				BearerCode: "SHAR",
+				SenderCharges: []*SenderCharge{
+					{Amount: MustParseDecimal("5.00"), Currency: "GBP"},
+					{Amount: MustParseDecimal("10.00"), Currency: "USD"},
+				},
+				ReceiverChargesAmount:   MustParseDecimal("1.00"),
+				ReceiverChargesCurrency: "USD",
+			},
+			Currency: "GBP",
+			DebtorParty: &DebtorParty{
+				AccountNumberCode: "IBAN",
+				BankIDCode:        "GBDSC",
+			},
+			Fx: &Fx{
+				ExchangeRate:     MustParseDecimal("0.50000"),
+				OriginalAmount:   MustParseDecimal("200.42"),
+				OriginalCurrency: "USD",
+			},
+			NumericReference: "1002001",
+			ProcessingDate:   "2017-01-18",
+			SponsorParty: &SponsorParty{
+				BankIDCode: "GBDSC",
+			},
+		},
+	}
+}
+
 func TestPayment_Validate(t *testing.T) {
 	pID := uuid.New()
 	tests := []struct {
 		name    string
-		payment *Payment
+		payment func() *Payment
 		wantErr bool
 	}{
 		{
-			name: "payment is valid",
-			payment: &Payment{
-				ID:   pID,
-				Type: PaymentType,
-				Attribute: &Attribute{
-					PaymentID: pID,
-				},
+			name:    "payment is valid",
+			payment: func() *Payment { return newValidPayment(pID) },
+		},
+		{
+			name: "payment without optional parties is valid",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.BeneficiaryParty = nil
+				p.Attribute.ChargesInformation = nil
+				p.Attribute.DebtorParty = nil
+				p.Attribute.Fx = nil
+				p.Attribute.SponsorParty = nil
+				return p
 			},
 		},
 		{
 			name: "payment is invalid due to wrong type",
-			payment: &Payment{
-				ID:   pID,
-				Type: "wrong_type",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Type = "wrong_type"
+				return p
 			},
 			wantErr: true,
 		},
 		{
 			name: "payment is invalid due to missing attribute",
-			payment: &Payment{
-				ID:   pID,
-				Type: PaymentType,
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute = nil
+				return p
 			},
 			wantErr: true,
 		},
 		{
 			name: "payment is invalid due to unrelated attribute",
-			payment: &Payment{
-				ID:   pID,
-				Type: PaymentType,
-				Attribute: &Attribute{
-					PaymentID: uuid.New(),
-				},
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.PaymentID = uuid.New()
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is invalid due to missing organisation",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.OrganisationID = uuid.Nil
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is invalid due to malformed processing date",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.ProcessingDate = "18/01/2017"
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is valid with the minor units of its currency",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.Amount = MustParseDecimal("100.215")
+				p.Attribute.Currency = "BHD"
+				p.Attribute.Fx = nil
+				return p
+			},
+		},
+		{
+			name: "payment is invalid due to more decimal places than the currency",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.Amount = MustParseDecimal("100.21")
+				p.Attribute.Currency = "JPY"
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is invalid due to missing amount",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.Amount = Decimal{}
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is invalid due to sender charge precision",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.ChargesInformation.SenderCharges[0].Amount = MustParseDecimal("5.001")
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is valid with consistent bank accounts",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.DebtorParty.AccountNumber = "GB29NWBK60161331926819"
+				p.Attribute.DebtorParty.BankID = "601613"
+				p.Attribute.SponsorParty.AccountNumber = "56781234"
+				p.Attribute.SponsorParty.BankID = "123123"
+				return p
+			},
+		},
+		{
+			name: "payment is invalid due to IBAN checksum",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.DebtorParty.AccountNumber = "GB28NWBK60161331926819"
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is invalid due to sort code not matching the IBAN",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.DebtorParty.AccountNumber = "GB29NWBK60161331926819"
+				p.Attribute.DebtorParty.BankID = "403000"
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is invalid due to malformed UK account number",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.BeneficiaryParty.AccountNumber = "3192681"
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is invalid due to malformed BIC",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.SponsorParty.BankIDCode = "SWBIC"
+				p.Attribute.SponsorParty.BankID = "NWBK"
+				return p
+			},
+			wantErr: true,
+		},
+		{
+			name: "payment is invalid due to unknown bearer code",
+			payment: func() *Payment {
+				p := newValidPayment(pID)
+				p.Attribute.ChargesInformation.BearerCode = "NONE"
+				return p
 			},
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.payment.Validate(); (err != nil) != tt.wantErr {
+			if err := tt.payment().Validate(nil); (err != nil) != tt.wantErr {
 				t.Errorf("Payment.Validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestPayment_Validate_ListsEveryField(t *testing.T) {
+	// Arrange
+	pID := uuid.New()
+	p := newValidPayment(pID)
+	p.Attribute.Amount = MustParseDecimal("-1")
+	p.Attribute.Currency = "XXX1"
+	p.Attribute.BeneficiaryParty.AccountNumberCode = "SWIFT"
+	p.Attribute.ChargesInformation.SenderCharges[1].Currency = ""
+	p.Attribute.Fx.ExchangeRate = MustParseDecimal("-2")
+
+	// Act
+	err := p.Validate(nil)
+
+	// Assert
+	errs, ok := err.(ValidationErrors)
+	if !assert.True(t, ok, "expected ValidationErrors, got %T", err) {
+		return
+	}
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	assert.Equal(t, []string{
+		"attributes.amount",
+		"attributes.currency",
+		"attributes.beneficiary_party.account_number_code",
+		"attributes.charges_information.sender_charges[1].currency",
+		"attributes.fx.exchange_rate",
+	}, fields)
+}
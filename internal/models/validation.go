@@ -0,0 +1,176 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cedric-parisi/payment-api/pkg/validation"
+)
+
+const (
+	// processingDateLayout is the expected format of Attribute.ProcessingDate
+	processingDateLayout = "2006-01-02"
+)
+
+var (
+	numericRegex = regexp.MustCompile(`^[0-9]+$`)
+
+	accountNumberCodes = []string{"BBAN", "IBAN"}
+	bankIDCodes        = []string{"GBDSC", "SWBIC", "DEBLZ"}
+	bearerCodes        = []string{"SHAR", "BEN", "OUR", "CRED", "DEBT"}
+	accountTypes       = []int{0, 1}
+)
+
+// FieldError describes why a field is invalid
+// Field is the JSON path of the field, e.g. attributes.beneficiary_party.bank_id
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every invalid field of a resource
+type ValidationErrors []FieldError
+
+// Error returns all the field errors in a single string
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, f := range v {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validator accumulates field errors while walking a resource
+type validator struct {
+	errs         ValidationErrors
+	fxTolerances FxTolerances
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns nil when no field error was found
+// so that the result can be compared to nil by callers
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func (v *validator) required(field, value string) bool {
+	if value == "" {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) requiredDecimal(field string, value Decimal) bool {
+	if !value.IsSet() {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) positive(field string, value Decimal) {
+	if value.Sign() < 0 {
+		v.add(field, "must be a positive decimal number, got %q", value)
+	}
+}
+
+// money checks the amount is positive and has no more decimal places
+// than the minor units of its currency, e.g. 2 for GBP and 0 for JPY
+// The currency itself is checked by currency
+func (v *validator) money(field string, amount Decimal, currency string) {
+	if amount.Sign() < 0 {
+		v.add(field, "must be a positive decimal number, got %q", amount)
+		return
+	}
+	if units, ok := MinorUnits(currency); ok && amount.Scale() > units {
+		v.add(field, "must have at most %d decimal places in %s, got %q", units, currency, amount)
+	}
+}
+
+func (v *validator) numeric(field, value string) {
+	if value != "" && !numericRegex.MatchString(value) {
+		v.add(field, "must only contain digits, got %q", value)
+	}
+}
+
+func (v *validator) currency(field, value string) {
+	if value != "" && !IsCurrency(value) {
+		v.add(field, "must be an ISO 4217 currency code, got %q", value)
+	}
+}
+
+func (v *validator) date(field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := time.Parse(processingDateLayout, value); err != nil {
+		v.add(field, "must be a date formatted as YYYY-MM-DD, got %q", value)
+	}
+}
+
+// bankAccount checks the bank id against its code, the account number against
+// its code and, for an IBAN, that the bank id designates the bank of the IBAN
+// A BBAN is only checked for UK banks, identified by a sort code
+func (v *validator) bankAccount(path, number, numberCode, bankID, bankIDCode string) {
+	bankIDValid := bankID != ""
+	if bankIDValid {
+		if err := validation.BankID(bankIDCode, bankID); err != nil {
+			v.add(path+".bank_id", "%s, got %q", err, bankID)
+			bankIDValid = false
+		}
+	}
+	if number == "" {
+		return
+	}
+
+	switch {
+	case numberCode == "IBAN":
+		if err := validation.IBAN(number); err != nil {
+			v.add(path+".account_number", "%s, got %q", err, number)
+			return
+		}
+		if !bankIDValid {
+			return
+		}
+		if err := validation.IBANBankID(number, bankIDCode, bankID); err != nil {
+			v.add(path+".bank_id", "%s, got %q", err, bankID)
+		}
+	case bankIDCode == validation.BankIDSortCode:
+		if err := validation.UKAccountNumber(number); err != nil {
+			v.add(path+".account_number", "%s, got %q", err, number)
+		}
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed []string) {
+	if value == "" {
+		return
+	}
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) oneOfInt(field string, value int, allowed []int) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(field, "must be one of %v, got %d", allowed, value)
+}
@@ -0,0 +1,156 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+	"github.com/cedric-parisi/payment-api/pkg/patch"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 255
+
+	readHistoryFailedCode = "read_payment_history_failed"
+)
+
+// AuditRepository stores the audit entries of the payments
+// Entries are appended within the unit of work of the mutation they record
+type AuditRepository interface {
+	AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	// GetAuditEntries returns the entries of a payment, oldest first
+	GetAuditEntries(ctx context.Context, paymentID string) ([]*models.AuditEntry, error)
+}
+
+// requestIDToContext moves the X-Request-ID header into the context
+// A request without a usable id gets a new one
+func requestIDToContext(ctx context.Context, r *http.Request) context.Context {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		id = uuid.New().String()
+	}
+	return context.WithValue(ctx, ContextKeyRequestID, id)
+}
+
+// requestIDToHTTP sends the id of the request back to the client
+func requestIDToHTTP(ctx context.Context, w http.ResponseWriter) context.Context {
+	if id := requestIDFromContext(ctx); id != "" {
+		w.Header().Set(requestIDHeader, id)
+	}
+	return ctx
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ContextKeyRequestID).(string)
+	return id
+}
+
+// actorFromContext returns the subject of the token checked by the JWT middleware
+func actorFromContext(ctx context.Context) string {
+	switch claims := ctx.Value(kitjwt.JWTClaimsContextKey).(type) {
+	case *auth.Claims:
+		return claims.Subject
+	case *jwt.StandardClaims:
+		return claims.Subject
+	case jwt.MapClaims:
+		sub, _ := claims["sub"].(string)
+		return sub
+	}
+	return ""
+}
+
+// snapshot is the JSON representation of the payment compared by the audit entries
+// It must be taken before the mutation, the repositories update the payment they save
+func snapshot(payment *models.Payment) []byte {
+	if payment == nil {
+		return []byte("{}")
+	}
+	raw, _ := json.Marshal(payment)
+	return raw
+}
+
+// record appends the audit entry of a mutation of the payment to the audit log of the unit of work
+// before and after are the snapshots of the payment around the mutation
+func record(ctx context.Context, r Repositories, action string, payment *models.Payment, before, after []byte) error {
+	changes, err := patch.Diff(before, after)
+	if err != nil {
+		return errorhandling.Internal(persistFailedCode, err)
+	}
+
+	err = r.Audit.AppendAuditEntry(ctx, &models.AuditEntry{
+		ID:             uuid.New(),
+		PaymentID:      payment.ID,
+		OrganisationID: payment.OrganisationID,
+		Action:         action,
+		Actor:          actorFromContext(ctx),
+		RequestID:      requestIDFromContext(ctx),
+		Version:        payment.Version,
+		Changes:        models.Changes(changes),
+		CreatedAt:      time.Now().UTC(),
+	})
+	if err != nil {
+		return storageError(persistFailedCode, err)
+	}
+	return nil
+}
+
+// mutate runs fn in a unit of work so that a mutation and its audit entry are saved together
+// Errors of the unit of work itself, e.g. on commit, are not api errors yet
+func (s *service) mutate(ctx context.Context, fn func(r Repositories) error) error {
+	err := s.unitOfWork.Do(ctx, fn)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(kithttp.StatusCoder); !ok {
+		return storageError(persistFailedCode, err)
+	}
+	return err
+}
+
+// GetPaymentHistory returns the audit entries of a payment, oldest first
+// The history of a deleted payment can still be read
+// The history of a payment of another organisation is not found
+// A payment recorded before the audit has an empty history
+func (s *service) GetPaymentHistory(ctx context.Context, id string) ([]*models.AuditEntry, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errorhandling.InvalidRequest(invalidPaymentCode, err)
+	}
+
+	entries, err := s.audit.GetAuditEntries(ctx, id)
+	if err != nil {
+		return nil, storageError(readHistoryFailedCode, err)
+	}
+	if len(entries) > 0 {
+		return entries, nil
+	}
+	if err := s.checkPaymentExists(ctx, id); err != nil {
+		return nil, err
+	}
+	return []*models.AuditEntry{}, nil
+}
+
+// checkPaymentExists looks the payment up among the stored and the deleted ones
+func (s *service) checkPaymentExists(ctx context.Context, id string) error {
+	_, err := s.repository.GetPayment(ctx, id)
+	if err == ErrNotFound {
+		_, err = s.repository.GetDeletedPayment(ctx, id)
+	}
+	switch err {
+	case nil:
+		return nil
+	case ErrNotFound:
+		return errorhandling.NotFound(invalidPaymentCode, fmt.Errorf("could not find %s", id))
+	}
+	return storageError(readPaymentFailedCode, err)
+}
@@ -0,0 +1,344 @@
+// +build !integration
+
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_requestIDToContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{
+			name:   "id of the client is kept",
+			header: "f3b2e6a1",
+			want:   "f3b2e6a1",
+		},
+		{
+			name: "missing id is generated",
+		},
+		{
+			name:   "too long id is replaced",
+			header: strings.Repeat("a", maxRequestIDLength+1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/payments/", nil)
+			if tt.header != "" {
+				r.Header.Set(requestIDHeader, tt.header)
+			}
+
+			got := requestIDFromContext(requestIDToContext(callerContext(), r))
+
+			if tt.want != "" {
+				assert.Equal(t, tt.want, got)
+				return
+			}
+			_, err := uuid.Parse(got)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_actorFromContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims interface{}
+		want   string
+	}{
+		{
+			name:   "standard claims",
+			claims: &jwt.StandardClaims{Subject: "ops"},
+			want:   "ops",
+		},
+		{
+			name:   "map claims",
+			claims: jwt.MapClaims{"sub": "ops"},
+			want:   "ops",
+		},
+		{
+			name: "no claims",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := callerContext()
+			if tt.claims != nil {
+				ctx = context.WithValue(ctx, kitjwt.JWTClaimsContextKey, tt.claims)
+			}
+			assert.Equal(t, tt.want, actorFromContext(ctx))
+		})
+	}
+}
+
+func Test_service_audit(t *testing.T) {
+	pID := uuid.New()
+	ctx := context.WithValue(callerContext(), kitjwt.JWTClaimsContextKey, &jwt.StandardClaims{Subject: "ops"})
+	ctx = context.WithValue(ctx, ContextKeyRequestID, "f3b2e6a1")
+	stored := func() *models.Payment {
+		return &models.Payment{
+			ID:             pID,
+			Type:           models.PaymentType,
+			Status:         models.StatusPending,
+			Version:        1,
+			OrganisationID: testOrganisationID,
+			Attribute: &models.Attribute{
+				PaymentID:      pID,
+				Amount:         models.MustParseDecimal("100.21"),
+				Currency:       "GBP",
+				Reference:      "old",
+				ProcessingDate: "2017-01-18",
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		mutate      func(s Service) error
+		mockCalls   func(m *MockPaymentRepository)
+		wantAction  string
+		wantVersion int
+		wantChanges []string
+	}{
+		{
+			name: "create",
+			mutate: func(s Service) error {
+				_, err := s.CreatePayment(ctx, newCreatePaymentRequest())
+				return err
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("InsertPayment", mock.Anything, mock.Anything).Return(nil)
+			},
+			wantAction:  models.AuditCreate,
+			wantChanges: []string{"/attributes", "/created_at", "/id", "/organisation_id", "/status", "/type", "/updated_at", "/version"},
+		},
+		{
+			name: "update",
+			mutate: func(s Service) error {
+				payment := stored()
+				payment.Attribute.Reference = "new"
+				return s.UpdatePayment(ctx, payment)
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					args.Get(1).(*models.Payment).Version++
+				})
+			},
+			wantAction:  models.AuditUpdate,
+			wantVersion: 2,
+			// the children of an updated payment are stored again with new ids
+			wantChanges: []string{"/attributes/id", "/attributes/reference", "/updated_at", "/version"},
+		},
+		{
+			name: "delete",
+			mutate: func(s Service) error {
+				return s.DeletePayment(ctx, pID.String())
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+				m.On("DeletePayment", mock.Anything, mock.Anything).Return(nil)
+			},
+			wantAction:  models.AuditDelete,
+			wantVersion: 1,
+			wantChanges: []string{"/attributes", "/created_at", "/id", "/organisation_id", "/status", "/type", "/updated_at", "/version"},
+		},
+		{
+			name: "transition",
+			mutate: func(s Service) error {
+				_, err := s.TransitionPayment(ctx, pID.String(), models.StatusSubmitted)
+				return err
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+				m.On("UpdatePaymentStatus", mock.Anything, mock.Anything, models.StatusSubmitted).Return(nil).Run(func(args mock.Arguments) {
+					p := args.Get(1).(*models.Payment)
+					p.Status = models.StatusSubmitted
+					p.Version++
+				})
+			},
+			wantAction:  models.AuditTransition,
+			wantVersion: 2,
+			wantChanges: []string{"/status", "/version"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			var got *models.AuditEntry
+			mockAudit := &MockAuditRepository{}
+			mockAudit.On("AppendAuditEntry", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				got = args.Get(1).(*models.AuditEntry)
+			})
+			s := &service{
+				repository: mockRepo,
+				unitOfWork: newAuditedUnitOfWork(mockRepo, nil, mockAudit),
+			}
+
+			// Act
+			err := tt.mutate(s)
+
+			// Assert
+			if !assert.NoError(t, err) || !assert.NotNil(t, got) {
+				return
+			}
+			assert.Equal(t, tt.wantAction, got.Action)
+			assert.Equal(t, "ops", got.Actor)
+			assert.Equal(t, "f3b2e6a1", got.RequestID)
+			assert.Equal(t, tt.wantVersion, got.Version)
+			var paths []string
+			for _, c := range got.Changes {
+				paths = append(paths, c.Path)
+			}
+			assert.Equal(t, tt.wantChanges, paths)
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo, mockAudit))
+		})
+	}
+}
+
+func Test_service_audit_Failure(t *testing.T) {
+	// Arrange
+	mockRepo := &MockPaymentRepository{}
+	mockRepo.On("InsertPayment", mock.Anything, mock.Anything).Return(nil)
+	mockAudit := &MockAuditRepository{}
+	mockAudit.On("AppendAuditEntry", mock.Anything, mock.Anything).Return(errors.New("failed"))
+	s := &service{
+		repository: mockRepo,
+		unitOfWork: newAuditedUnitOfWork(mockRepo, nil, mockAudit),
+	}
+
+	// Act
+	_, err := s.CreatePayment(callerContext(), newCreatePaymentRequest())
+
+	// Assert, the unit of work rolls the payment back
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusInternalServerError, err.(kithttp.StatusCoder).StatusCode())
+	}
+}
+
+func Test_service_GetPaymentHistory(t *testing.T) {
+	pID := uuid.New()
+	entries := []*models.AuditEntry{{ID: uuid.New(), PaymentID: pID, Action: models.AuditCreate}}
+
+	tests := []struct {
+		name       string
+		id         string
+		mockCalls  func(m *MockAuditRepository, r *MockPaymentRepository)
+		want       []*models.AuditEntry
+		wantStatus int
+	}{
+		{
+			name: "history found",
+			id:   pID.String(),
+			mockCalls: func(m *MockAuditRepository, r *MockPaymentRepository) {
+				m.On("GetAuditEntries", mock.Anything, pID.String()).Return(entries, nil)
+			},
+			want: entries,
+		},
+		{
+			name:       "invalid id",
+			id:         "1234",
+			mockCalls:  func(m *MockAuditRepository, r *MockPaymentRepository) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "no history of a stored payment",
+			id:   pID.String(),
+			mockCalls: func(m *MockAuditRepository, r *MockPaymentRepository) {
+				m.On("GetAuditEntries", mock.Anything, pID.String()).Return([]*models.AuditEntry{}, nil)
+				r.On("GetPayment", mock.Anything, pID.String()).Return(&models.Payment{ID: pID}, nil)
+			},
+			want: []*models.AuditEntry{},
+		},
+		{
+			name: "no history of a deleted payment",
+			id:   pID.String(),
+			mockCalls: func(m *MockAuditRepository, r *MockPaymentRepository) {
+				m.On("GetAuditEntries", mock.Anything, pID.String()).Return(nil, nil)
+				r.On("GetPayment", mock.Anything, pID.String()).Return(nil, ErrNotFound)
+				r.On("GetDeletedPayment", mock.Anything, pID.String()).Return(&models.Payment{ID: pID}, nil)
+			},
+			want: []*models.AuditEntry{},
+		},
+		{
+			name: "no payment",
+			id:   pID.String(),
+			mockCalls: func(m *MockAuditRepository, r *MockPaymentRepository) {
+				m.On("GetAuditEntries", mock.Anything, pID.String()).Return([]*models.AuditEntry{}, nil)
+				r.On("GetPayment", mock.Anything, pID.String()).Return(nil, ErrNotFound)
+				r.On("GetDeletedPayment", mock.Anything, pID.String()).Return(nil, ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "payment lookup error",
+			id:   pID.String(),
+			mockCalls: func(m *MockAuditRepository, r *MockPaymentRepository) {
+				m.On("GetAuditEntries", mock.Anything, pID.String()).Return([]*models.AuditEntry{}, nil)
+				r.On("GetPayment", mock.Anything, pID.String()).Return(nil, errors.New("failed"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "repository error",
+			id:   pID.String(),
+			mockCalls: func(m *MockAuditRepository, r *MockPaymentRepository) {
+				m.On("GetAuditEntries", mock.Anything, pID.String()).Return(nil, errors.New("failed"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockAudit := &MockAuditRepository{}
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockAudit, mockRepo)
+			s := &service{
+				audit:      mockAudit,
+				repository: mockRepo,
+			}
+
+			// Act
+			got, err := s.GetPaymentHistory(callerContext(), tt.id)
+
+			// Assert
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockAudit, mockRepo))
+		})
+	}
+}
+
+func TestGetPaymentHistoryResponse(t *testing.T) {
+	raw, err := json.Marshal(GetPaymentHistoryResponse{Entries: []*models.AuditEntry{}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"results":[]}`, string(raw))
+}
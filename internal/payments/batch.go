@@ -0,0 +1,198 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+)
+
+// BatchMode tells what a batch does when some of its items fail
+type BatchMode string
+
+const (
+	// BatchAtomic saves every item of the batch or none of them
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort saves the valid items and reports the failed ones
+	BatchBestEffort BatchMode = "best_effort"
+
+	maxBatchSize = 1000
+
+	invalidBatchCode = "invalid_batch"
+	batchAbortedCode = "batch_aborted"
+)
+
+// IsValid reports whether the mode is a known one
+func (m BatchMode) IsValid() bool {
+	return m == BatchAtomic || m == BatchBestEffort
+}
+
+// BatchResult is the outcome of an item of a batch
+// Err holds the api error of a failed item
+type BatchResult struct {
+	Index   int
+	Status  int
+	ID      uuid.UUID
+	Version int
+	Err     error
+}
+
+func (b *BatchResult) succeed(status int, payment *models.Payment) {
+	b.Status = status
+	b.ID = payment.ID
+	b.Version = payment.Version
+}
+
+func (b *BatchResult) fail(err error) {
+	b.Status = http.StatusInternalServerError
+	if sc, ok := err.(kithttp.StatusCoder); ok {
+		b.Status = sc.StatusCode()
+	}
+	b.Err = err
+}
+
+// MarshalJSON writes the index and status of the item with either the id and version
+// of the saved payment or the body of the api error
+func (b BatchResult) MarshalJSON() ([]byte, error) {
+	if b.Err == nil {
+		return json.Marshal(map[string]interface{}{
+			"index":   b.Index,
+			"status":  b.Status,
+			"id":      b.ID,
+			"version": b.Version,
+		})
+	}
+
+	// the body of an api error is an object with a single error member
+	body := map[string]interface{}{}
+	if raw, err := json.Marshal(b.Err); err != nil || json.Unmarshal(raw, &body) != nil || body["error"] == nil {
+		body = map[string]interface{}{"error": map[string]string{"message": b.Err.Error()}}
+	}
+	body["index"] = b.Index
+	body["status"] = b.Status
+	return json.Marshal(body)
+}
+
+// batchOperation is what a batch does with each of its payments
+// prepare checks a payment without the storage, save stores it with the given repository
+type batchOperation struct {
+	status  int
+	prepare func(payment *models.Payment) error
+	save    func(ctx context.Context, r Repositories, payment *models.Payment) error
+}
+
+// CreatePayments creates each payment as CreatePayment does
+// Idempotency keys are not supported on batches
+func (s *service) CreatePayments(ctx context.Context, payments []*models.Payment, mode BatchMode) ([]BatchResult, error) {
+	return s.runBatch(ctx, payments, mode, batchOperation{
+		status:  http.StatusCreated,
+		prepare: s.prepareCreate,
+		save:    insertPayment,
+	})
+}
+
+// UpdatePayments updates each payment as UpdatePayment does
+// The version of every payment must match the stored one
+func (s *service) UpdatePayments(ctx context.Context, payments []*models.Payment, mode BatchMode) ([]BatchResult, error) {
+	return s.runBatch(ctx, payments, mode, batchOperation{
+		status:  http.StatusOK,
+		prepare: s.prepareUpdate,
+		save: func(ctx context.Context, r Repositories, payment *models.Payment) error {
+			return savePayment(ctx, r, payment, models.AuditUpdate)
+		},
+	})
+}
+
+// runBatch prepares every payment then saves the valid ones
+// In best effort mode each payment is saved in its own transaction
+// In atomic mode nothing is saved unless every payment is valid, then all the
+// payments are saved in one transaction, the items that were not saved because
+// another one failed are reported as aborted
+func (s *service) runBatch(ctx context.Context, payments []*models.Payment, mode BatchMode, op batchOperation) ([]BatchResult, error) {
+	if !mode.IsValid() {
+		return nil, errorhandling.InvalidRequest(invalidBatchCode, fmt.Errorf("unknown batch mode %s", mode))
+	}
+	if len(payments) == 0 || len(payments) > maxBatchSize {
+		return nil, errorhandling.InvalidRequest(invalidBatchCode, fmt.Errorf("a batch must hold between 1 and %d payments", maxBatchSize))
+	}
+
+	results := make([]BatchResult, len(payments))
+	valid := true
+	for i, p := range payments {
+		results[i].Index = i
+		if p == nil {
+			results[i].fail(errorhandling.InvalidRequest(invalidPaymentCode, errors.New("payment is null")))
+			valid = false
+			continue
+		}
+		if err := op.prepare(p); err != nil {
+			results[i].fail(err)
+			valid = false
+		}
+	}
+
+	if mode == BatchBestEffort {
+		for i, p := range payments {
+			if results[i].Err != nil {
+				continue
+			}
+			err := s.mutate(ctx, func(r Repositories) error {
+				return op.save(ctx, r, p)
+			})
+			if err != nil {
+				results[i].fail(err)
+				continue
+			}
+			results[i].succeed(op.status, p)
+		}
+		return results, nil
+	}
+
+	if !valid {
+		abortBatch(results)
+		return results, nil
+	}
+	failed := false
+	err := s.unitOfWork.Do(ctx, func(r Repositories) error {
+		for i, p := range payments {
+			if err := op.save(ctx, r, p); err != nil {
+				results[i].fail(err)
+				failed = true
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// the transaction itself failed, e.g. on commit
+		if !failed {
+			for i := range results {
+				results[i].fail(storageError(persistFailedCode, err))
+			}
+			return results, nil
+		}
+		abortBatch(results)
+		return results, nil
+	}
+	for i, p := range payments {
+		results[i].succeed(op.status, p)
+	}
+	return results, nil
+}
+
+// abortBatch reports the items that did not fail as aborted
+func abortBatch(results []BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].fail(errorhandling.FailedDependency(batchAbortedCode,
+				errors.New("not saved as another payment of the atomic batch failed")))
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// +build !integration
+
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_service_CreatePayments(t *testing.T) {
+	invalid := func() *models.Payment {
+		p := newCreatePaymentRequest()
+		p.Type = "unknown payment type"
+		return p
+	}
+	tests := []struct {
+		name         string
+		payments     []*models.Payment
+		mode         BatchMode
+		wantErr      bool
+		wantStatuses []int
+		mockCalls    func(m *MockPaymentRepository)
+	}{
+		{
+			name:         "atomic batch success",
+			payments:     []*models.Payment{newCreatePaymentRequest(), newCreatePaymentRequest()},
+			mode:         BatchAtomic,
+			wantStatuses: []int{http.StatusCreated, http.StatusCreated},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("InsertPayment", mock.Anything, mock.Anything).Return(nil).Twice()
+			},
+		},
+		{
+			name:         "atomic batch aborted due to invalid payment",
+			payments:     []*models.Payment{newCreatePaymentRequest(), invalid()},
+			mode:         BatchAtomic,
+			wantStatuses: []int{http.StatusFailedDependency, http.StatusBadRequest},
+			mockCalls:    func(m *MockPaymentRepository) {},
+		},
+		{
+			name:         "atomic batch aborted due to repository error",
+			payments:     []*models.Payment{newCreatePaymentRequest(), newCreatePaymentRequest(), newCreatePaymentRequest()},
+			mode:         BatchAtomic,
+			wantStatuses: []int{http.StatusFailedDependency, http.StatusInternalServerError, http.StatusFailedDependency},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("InsertPayment", mock.Anything, mock.Anything).Return(nil).Once()
+				m.On("InsertPayment", mock.Anything, mock.Anything).Return(errors.New("failed")).Once()
+			},
+		},
+		{
+			name:         "best effort batch saves the valid payments",
+			payments:     []*models.Payment{newCreatePaymentRequest(), invalid(), nil, newCreatePaymentRequest()},
+			mode:         BatchBestEffort,
+			wantStatuses: []int{http.StatusCreated, http.StatusBadRequest, http.StatusBadRequest, http.StatusInternalServerError},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("InsertPayment", mock.Anything, mock.Anything).Return(nil).Once()
+				m.On("InsertPayment", mock.Anything, mock.Anything).Return(errors.New("failed")).Once()
+			},
+		},
+		{
+			name:      "batch failed due to unknown mode",
+			payments:  []*models.Payment{newCreatePaymentRequest()},
+			mode:      "sometimes",
+			wantErr:   true,
+			mockCalls: func(m *MockPaymentRepository) {},
+		},
+		{
+			name:      "batch failed due to empty batch",
+			mode:      BatchAtomic,
+			wantErr:   true,
+			mockCalls: func(m *MockPaymentRepository) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			s := &service{
+				repository: mockRepo,
+				unitOfWork: newUnitOfWork(mockRepo, nil),
+			}
+
+			// Act
+			got, err := s.CreatePayments(callerContext(), tt.payments, tt.mode)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.CreatePayments() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			statuses := make([]int, 0, len(got))
+			for i, r := range got {
+				assert.Equal(t, i, r.Index)
+				assert.Equal(t, r.Status == http.StatusCreated, r.Err == nil)
+				assert.Equal(t, r.Status == http.StatusCreated, r.ID != uuid.Nil)
+				statuses = append(statuses, r.Status)
+			}
+			if !tt.wantErr {
+				assert.Equal(t, tt.wantStatuses, statuses)
+			}
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
+
+func Test_service_UpdatePayments(t *testing.T) {
+	newPayment := func() *models.Payment {
+		id := uuid.New()
+		return &models.Payment{
+			ID:             id,
+			Type:           models.PaymentType,
+			Version:        1,
+			OrganisationID: testOrganisationID,
+			Attribute: &models.Attribute{
+				PaymentID:      id,
+				Amount:         models.MustParseDecimal("100.21"),
+				Currency:       "GBP",
+				ProcessingDate: "2017-01-18",
+			},
+		}
+	}
+	tests := []struct {
+		name         string
+		mode         BatchMode
+		wantStatuses []int
+		mockCalls    func(m *MockPaymentRepository)
+	}{
+		{
+			name:         "atomic batch success",
+			mode:         BatchAtomic,
+			wantStatuses: []int{http.StatusOK, http.StatusOK},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, mock.Anything).Return(&models.Payment{}, nil)
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(nil).Twice()
+			},
+		},
+		{
+			name:         "atomic batch aborted due to stale version",
+			mode:         BatchAtomic,
+			wantStatuses: []int{http.StatusConflict, http.StatusFailedDependency},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, mock.Anything).Return(&models.Payment{}, nil)
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(ErrVersionConflict).Once()
+			},
+		},
+		{
+			name:         "best effort batch reports missing payments",
+			mode:         BatchBestEffort,
+			wantStatuses: []int{http.StatusNotFound, http.StatusOK},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, mock.Anything).Return(&models.Payment{}, nil)
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(ErrNotFound).Once()
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			s := &service{
+				repository: mockRepo,
+				unitOfWork: newUnitOfWork(mockRepo, nil),
+			}
+
+			// Act
+			got, err := s.UpdatePayments(callerContext(), []*models.Payment{newPayment(), newPayment()}, tt.mode)
+
+			// Assert
+			assert.NoError(t, err)
+			statuses := make([]int, 0, len(got))
+			for _, r := range got {
+				statuses = append(statuses, r.Status)
+			}
+			assert.Equal(t, tt.wantStatuses, statuses)
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
+
+func TestBatchResult_MarshalJSON(t *testing.T) {
+	id := uuid.MustParse("3578205f-aeb3-444a-a42f-d47298b6eb8b")
+	got, err := json.Marshal(BatchResult{Index: 0, Status: http.StatusCreated, ID: id})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"index":0,"status":201,"id":"3578205f-aeb3-444a-a42f-d47298b6eb8b","version":0}`, string(got))
+
+	r := BatchResult{Index: 1}
+	r.fail(invalidPayment(models.ValidationErrors{{Field: "type", Message: "is invalid"}}))
+	got, err = json.Marshal(r)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"index":1,"status":400,"error":{"code":"invalid_payment","message":"payment validation failed","details":[{"field":"type","message":"is invalid"}]}}`, string(got))
+
+	r = BatchResult{Index: 2}
+	r.fail(errors.New("failed"))
+	got, err = json.Marshal(r)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"index":2,"status":500,"error":{"message":"failed"}}`, string(got))
+}
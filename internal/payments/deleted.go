@@ -0,0 +1,123 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+)
+
+const (
+	// maxPurgeSize bounds the payments removed by a purge, so that its transaction stays short
+	maxPurgeSize = 1000
+
+	deleteRefusedCode = "payment_delete_refused"
+)
+
+// DeletePolicy can refuse the deletion of a payment, the error explains why
+// now is the time of the deletion
+type DeletePolicy func(payment *models.Payment, now time.Time) error
+
+// DefaultDeletePolicy refuses the deletion of the settled payments, their funds already moved
+var DefaultDeletePolicy = RefuseStatuses(models.StatusSettled)
+
+// RefuseStatuses refuses the deletion of the payments in one of the statuses
+func RefuseStatuses(statuses ...models.Status) DeletePolicy {
+	return func(payment *models.Payment, now time.Time) error {
+		for _, status := range statuses {
+			if payment.Status == status {
+				return fmt.Errorf("payment %s is %s and cannot be deleted", payment.ID, status)
+			}
+		}
+		return nil
+	}
+}
+
+// RefuseOlderThan refuses the deletion of the payments created more than age ago
+func RefuseOlderThan(age time.Duration) DeletePolicy {
+	return func(payment *models.Payment, now time.Time) error {
+		if now.Sub(payment.CreatedAt) > age {
+			return fmt.Errorf("payment %s was created more than %s ago and cannot be deleted", payment.ID, age)
+		}
+		return nil
+	}
+}
+
+// DeletePolicies refuses the deletions refused by any of the policies
+func DeletePolicies(policies ...DeletePolicy) DeletePolicy {
+	return func(payment *models.Payment, now time.Time) error {
+		for _, policy := range policies {
+			if err := policy(payment, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// RestorePayment undeletes a deleted payment along with its attribute and children
+// The version of the payment is incremented
+func (s *service) RestorePayment(ctx context.Context, id string) (*models.Payment, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errorhandling.InvalidRequest(invalidPaymentCode, err)
+	}
+
+	var restored *models.Payment
+	err := s.mutate(ctx, func(r Repositories) error {
+		payment, err := r.Payments.GetDeletedPayment(ctx, id)
+		if err != nil {
+			if err == ErrNotFound {
+				return errorhandling.NotFound(invalidPaymentCode, fmt.Errorf("could not find deleted payment %s", id))
+			}
+			return storageError(readPaymentFailedCode, err)
+		}
+		before := snapshot(payment)
+
+		if err := r.Payments.RestorePayment(ctx, payment); err != nil {
+			switch err {
+			case ErrNotFound:
+				return errorhandling.NotFound(invalidPaymentCode, fmt.Errorf("could not find deleted payment %s", id))
+			case ErrVersionConflict:
+				return errorhandling.Conflict(staleVersionCode, fmt.Errorf("payment %s was modified concurrently", id))
+			}
+			return storageError(persistFailedCode, err)
+		}
+		restored = payment
+		return record(ctx, r, models.AuditRestore, payment, before, snapshot(payment))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// PurgePayments removes for good up to maxPurgeSize payments deleted for longer than the retention
+// Returns the number of purged payments, a purge is repeated until it returns 0
+// Their audit history is kept
+// Only the payments of the organisation of the caller are purged
+func (s *service) PurgePayments(ctx context.Context) (int, error) {
+	deletedBefore := time.Now().UTC().Add(-s.purgeRetention)
+
+	purged := 0
+	err := s.mutate(ctx, func(r Repositories) error {
+		payments, err := r.Payments.PurgePayments(ctx, deletedBefore, maxPurgeSize)
+		if err != nil {
+			return storageError(persistFailedCode, err)
+		}
+		for _, p := range payments {
+			if err := record(ctx, r, models.AuditPurge, p, snapshot(p), snapshot(nil)); err != nil {
+				return err
+			}
+		}
+		purged = len(payments)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
@@ -0,0 +1,304 @@
+// +build !integration
+
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_service_RestorePayment(t *testing.T) {
+	pID := uuid.New()
+	deletedAt := time.Now().UTC()
+	deleted := func() *models.Payment {
+		return &models.Payment{ID: pID, Version: 1, DeletedAt: &deletedAt}
+	}
+
+	tests := []struct {
+		name        string
+		id          string
+		mockCalls   func(m *MockPaymentRepository)
+		wantVersion int
+		wantStatus  int
+	}{
+		{
+			name: "restore payment success",
+			id:   pID.String(),
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetDeletedPayment", mock.Anything, pID.String()).Return(deleted(), nil)
+				m.On("RestorePayment", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					p := args.Get(1).(*models.Payment)
+					p.DeletedAt = nil
+					p.Version++
+				})
+			},
+			wantVersion: 2,
+		},
+		{
+			name:       "restore payment failed due to invalid id",
+			id:         "1234",
+			mockCalls:  func(m *MockPaymentRepository) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "restore payment failed as the payment is not deleted",
+			id:   pID.String(),
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetDeletedPayment", mock.Anything, pID.String()).Return(nil, ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "restore payment failed due to concurrent change",
+			id:   pID.String(),
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetDeletedPayment", mock.Anything, pID.String()).Return(deleted(), nil)
+				m.On("RestorePayment", mock.Anything, mock.Anything).Return(ErrVersionConflict)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "restore payment failed due to repository error",
+			id:   pID.String(),
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetDeletedPayment", mock.Anything, pID.String()).Return(nil, errors.New("failed"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			s := &service{
+				repository: mockRepo,
+				unitOfWork: newUnitOfWork(mockRepo, nil),
+			}
+
+			// Act
+			got, err := s.RestorePayment(callerContext(), tt.id)
+
+			// Assert
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Nil(t, got.DeletedAt)
+			assert.Equal(t, tt.wantVersion, got.Version)
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
+
+func Test_service_DeletePayment(t *testing.T) {
+	pID := uuid.New()
+	stored := func(status models.Status) *models.Payment {
+		return &models.Payment{ID: pID, Version: 1, Status: status, CreatedAt: time.Now().UTC()}
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		policy     DeletePolicy
+		mockCalls  func(m *MockPaymentRepository)
+		wantStatus int
+	}{
+		{
+			name:   "delete payment success",
+			id:     pID.String(),
+			policy: DefaultDeletePolicy,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(models.StatusPending), nil)
+				m.On("DeletePayment", mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:       "delete payment failed due to invalid id",
+			id:         "1234",
+			policy:     DefaultDeletePolicy,
+			mockCalls:  func(m *MockPaymentRepository) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "delete payment failed as the payment does not exist",
+			id:     pID.String(),
+			policy: DefaultDeletePolicy,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(nil, ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "delete payment refused as the payment is settled",
+			id:     pID.String(),
+			policy: DefaultDeletePolicy,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(models.StatusSettled), nil)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   "delete payment refused as the payment is too old",
+			id:     pID.String(),
+			policy: RefuseOlderThan(-time.Hour),
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(models.StatusPending), nil)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   "delete payment failed due to concurrent change",
+			id:     pID.String(),
+			policy: DefaultDeletePolicy,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(models.StatusPending), nil)
+				m.On("DeletePayment", mock.Anything, mock.Anything).Return(ErrVersionConflict)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   "delete payment failed due to repository error",
+			id:     pID.String(),
+			policy: DefaultDeletePolicy,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(models.StatusPending), nil)
+				m.On("DeletePayment", mock.Anything, mock.Anything).Return(errors.New("failed"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			s := &service{
+				repository:   mockRepo,
+				unitOfWork:   newUnitOfWork(mockRepo, nil),
+				deletePolicy: tt.policy,
+			}
+
+			// Act
+			err := s.DeletePayment(callerContext(), tt.id)
+
+			// Assert
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
+
+func TestDeletePolicies(t *testing.T) {
+	now := time.Now().UTC()
+	policy := DeletePolicies(DefaultDeletePolicy, RefuseOlderThan(24*time.Hour))
+
+	tests := []struct {
+		name    string
+		payment *models.Payment
+		wantErr bool
+	}{
+		{
+			name:    "recent pending payment is allowed",
+			payment: &models.Payment{Status: models.StatusPending, CreatedAt: now.Add(-time.Hour)},
+		},
+		{
+			name:    "settled payment is refused",
+			payment: &models.Payment{Status: models.StatusSettled, CreatedAt: now.Add(-time.Hour)},
+			wantErr: true,
+		},
+		{
+			name:    "old payment is refused",
+			payment: &models.Payment{Status: models.StatusPending, CreatedAt: now.Add(-48 * time.Hour)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy(tt.payment, now)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func Test_service_PurgePayments(t *testing.T) {
+	retention := 24 * time.Hour
+	purged := []*models.Payment{{ID: uuid.New()}, {ID: uuid.New()}}
+
+	tests := []struct {
+		name       string
+		mockCalls  func(m *MockPaymentRepository)
+		want       int
+		wantStatus int
+	}{
+		{
+			name: "payments deleted before the retention are purged",
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("PurgePayments", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+					return time.Since(before) >= retention && time.Since(before) < retention+time.Minute
+				}), maxPurgeSize).Return(purged, nil)
+			},
+			want: 2,
+		},
+		{
+			name: "nothing to purge",
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("PurgePayments", mock.Anything, mock.Anything, maxPurgeSize).Return(nil, nil)
+			},
+		},
+		{
+			name: "repository error",
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("PurgePayments", mock.Anything, mock.Anything, maxPurgeSize).Return(nil, errors.New("failed"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			mockAudit := newAuditRepository()
+			s := &service{
+				repository:     mockRepo,
+				unitOfWork:     newAuditedUnitOfWork(mockRepo, nil, mockAudit),
+				purgeRetention: retention,
+			}
+
+			// Act
+			got, err := s.PurgePayments(callerContext())
+
+			// Assert
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			// every purged payment keeps a trace in the audit log
+			mockAudit.AssertNumberOfCalls(t, "AppendAuditEntry", tt.want)
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
 	"github.com/cedric-parisi/payment-api/pkg/utils"
 
 	"github.com/go-kit/kit/endpoint"
@@ -18,19 +20,43 @@ type Endpoints struct {
 	CreatePayment       endpoint.Endpoint
 	UpdatePayment       endpoint.Endpoint
 	GetPayment          endpoint.Endpoint
+	GetPaymentHistory   endpoint.Endpoint
 	GetFilteredPayments endpoint.Endpoint
 	DeletePayment       endpoint.Endpoint
+	TransitionPayment   endpoint.Endpoint
+	PatchPayment        endpoint.Endpoint
+	CreatePayments      endpoint.Endpoint
+	UpdatePayments      endpoint.Endpoint
+	ExportPayments      endpoint.Endpoint
+	RestorePayment      endpoint.Endpoint
+	PurgePayments       endpoint.Endpoint
 }
 
 // MakeEndpoints create endpoits
-// With tracing and auth middleware
+// With tracing and auth middleware, every endpoint requires the scope of its operation
+// Every request is scoped to the organisation of its token
 func MakeEndpoints(service Service, tracer opentracing.Tracer, JWTMiddleware endpoint.Middleware) Endpoints {
+	authorized := func(scope string) endpoint.Middleware {
+		return endpoint.Chain(JWTMiddleware, auth.ScopeMiddleware(scope), OrganisationMiddleware())
+	}
+	read := authorized(auth.ScopePaymentsRead)
+	write := authorized(auth.ScopePaymentsWrite)
+	deletion := authorized(auth.ScopePaymentsDelete)
+	admin := authorized(auth.ScopeAdmin)
 	return Endpoints{
-		CreatePayment:       kitopentracing.TraceServer(tracer, "create_payment")(JWTMiddleware(MakeCreatePaymentEndpoint(service))),
-		UpdatePayment:       kitopentracing.TraceServer(tracer, "update_payment")(JWTMiddleware(MakeUpdatePaymentEndpoint(service))),
-		GetPayment:          kitopentracing.TraceServer(tracer, "get_payment")(MakeGetPaymentEndpoint(service)),
-		GetFilteredPayments: kitopentracing.TraceServer(tracer, "get_filtered-payments")(MakeGetFilteredPaymentsEndpoint(service)),
-		DeletePayment:       kitopentracing.TraceServer(tracer, "delete_payment")(JWTMiddleware(MakeDeletePaymentEndpoint(service))),
+		CreatePayment:       kitopentracing.TraceServer(tracer, "create_payment")(write(MakeCreatePaymentEndpoint(service))),
+		UpdatePayment:       kitopentracing.TraceServer(tracer, "update_payment")(write(MakeUpdatePaymentEndpoint(service))),
+		GetPayment:          kitopentracing.TraceServer(tracer, "get_payment")(read(MakeGetPaymentEndpoint(service))),
+		GetPaymentHistory:   kitopentracing.TraceServer(tracer, "get_payment_history")(read(MakeGetPaymentHistoryEndpoint(service))),
+		GetFilteredPayments: kitopentracing.TraceServer(tracer, "get_filtered-payments")(read(MakeGetFilteredPaymentsEndpoint(service))),
+		DeletePayment:       kitopentracing.TraceServer(tracer, "delete_payment")(deletion(MakeDeletePaymentEndpoint(service))),
+		TransitionPayment:   kitopentracing.TraceServer(tracer, "transition_payment")(write(MakeTransitionPaymentEndpoint(service))),
+		PatchPayment:        kitopentracing.TraceServer(tracer, "patch_payment")(write(MakePatchPaymentEndpoint(service))),
+		CreatePayments:      kitopentracing.TraceServer(tracer, "create_payments")(write(MakeCreatePaymentsEndpoint(service))),
+		UpdatePayments:      kitopentracing.TraceServer(tracer, "update_payments")(write(MakeUpdatePaymentsEndpoint(service))),
+		ExportPayments:      kitopentracing.TraceServer(tracer, "export_payments")(read(MakeExportPaymentsEndpoint(service))),
+		RestorePayment:      kitopentracing.TraceServer(tracer, "restore_payment")(deletion(MakeRestorePaymentEndpoint(service))),
+		PurgePayments:       kitopentracing.TraceServer(tracer, "purge_payments")(admin(MakePurgePaymentsEndpoint(service))),
 	}
 }
 
@@ -66,6 +92,19 @@ func MakeCreatePaymentEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+// UpdatePaymentResponse represents the response of a payment update request
+// Contains the version of the payment after the update
+type UpdatePaymentResponse struct {
+	Version int
+}
+
+// Headers will set ETag header with the new version of the payment
+func (u UpdatePaymentResponse) Headers() http.Header {
+	return http.Header{
+		"Etag": []string{ETag(u.Version)},
+	}
+}
+
 // MakeUpdatePaymentEndpoint ...
 func MakeUpdatePaymentEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -75,7 +114,21 @@ func MakeUpdatePaymentEndpoint(s Service) endpoint.Endpoint {
 			return nil, err
 		}
 
-		return nil, nil
+		return UpdatePaymentResponse{
+			Version: req.Version,
+		}, nil
+	}
+}
+
+// GetPaymentResponse represents the response body for a payment request
+type GetPaymentResponse struct {
+	models.Payment
+}
+
+// Headers will set ETag header with the version of the payment
+func (g GetPaymentResponse) Headers() http.Header {
+	return http.Header{
+		"Etag": []string{ETag(g.Version)},
 	}
 }
 
@@ -83,7 +136,33 @@ func MakeUpdatePaymentEndpoint(s Service) endpoint.Endpoint {
 func MakeGetPaymentEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		id := request.(string)
-		return s.GetPayment(ctx, id)
+		res, err := s.GetPayment(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return GetPaymentResponse{
+			Payment: *res,
+		}, nil
+	}
+}
+
+// GetPaymentHistoryResponse represents the response body for a payment history request
+// Contains the audit entries of the payment, oldest first
+type GetPaymentHistoryResponse struct {
+	Entries []*models.AuditEntry `json:"results"`
+}
+
+// MakeGetPaymentHistoryEndpoint ...
+func MakeGetPaymentHistoryEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id := request.(string)
+		res, err := s.GetPaymentHistory(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return GetPaymentHistoryResponse{
+			Entries: res,
+		}, nil
 	}
 }
 
@@ -107,3 +186,176 @@ func MakeDeletePaymentEndpoint(s Service) endpoint.Endpoint {
 		return nil, nil
 	}
 }
+
+// TransitionPaymentRequest represents a request to move a payment to another status
+type TransitionPaymentRequest struct {
+	ID     string
+	Status models.Status
+}
+
+// MakeTransitionPaymentEndpoint ...
+func MakeTransitionPaymentEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(TransitionPaymentRequest)
+		res, err := s.TransitionPayment(ctx, req.ID, req.Status)
+		if err != nil {
+			return nil, err
+		}
+		return GetPaymentResponse{
+			Payment: *res,
+		}, nil
+	}
+}
+
+// MakeRestorePaymentEndpoint ...
+func MakeRestorePaymentEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id := request.(string)
+		res, err := s.RestorePayment(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return GetPaymentResponse{
+			Payment: *res,
+		}, nil
+	}
+}
+
+// PurgePaymentsResponse represents the response body for a purge request
+type PurgePaymentsResponse struct {
+	Purged int `json:"purged"`
+}
+
+// MakePurgePaymentsEndpoint ...
+func MakePurgePaymentsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		purged, err := s.PurgePayments(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return PurgePaymentsResponse{
+			Purged: purged,
+		}, nil
+	}
+}
+
+// PatchPaymentRequest represents a request to partially update a payment
+type PatchPaymentRequest struct {
+	ID    string
+	Patch Patch
+}
+
+// MakePatchPaymentEndpoint ...
+func MakePatchPaymentEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(PatchPaymentRequest)
+		res, err := s.PatchPayment(ctx, req.ID, req.Patch)
+		if err != nil {
+			return nil, err
+		}
+		return GetPaymentResponse{
+			Payment: *res,
+		}, nil
+	}
+}
+
+// BatchRequest represents a request to create or update several payments
+type BatchRequest struct {
+	Payments []*models.Payment
+	Mode     BatchMode
+}
+
+// BatchResponse represents the response body of a batch request
+// Contains the result of every item, in the order of the request
+type BatchResponse struct {
+	Mode      BatchMode     `json:"mode"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+	// success is the status code when every item succeeded
+	success int
+}
+
+// StatusCode will set the success status code when every item succeeded and 207 otherwise
+func (b BatchResponse) StatusCode() int {
+	if b.Failed > 0 {
+		return http.StatusMultiStatus
+	}
+	return b.success
+}
+
+func newBatchResponse(mode BatchMode, results []BatchResult, success int) BatchResponse {
+	res := BatchResponse{
+		Mode:    mode,
+		Results: results,
+		success: success,
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			res.Failed++
+		} else {
+			res.Succeeded++
+		}
+	}
+	return res
+}
+
+// MakeCreatePaymentsEndpoint ...
+func MakeCreatePaymentsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BatchRequest)
+		res, err := s.CreatePayments(ctx, req.Payments, req.Mode)
+		if err != nil {
+			return nil, err
+		}
+		return newBatchResponse(req.Mode, res, http.StatusCreated), nil
+	}
+}
+
+// MakeUpdatePaymentsEndpoint ...
+func MakeUpdatePaymentsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BatchRequest)
+		res, err := s.UpdatePayments(ctx, req.Payments, req.Mode)
+		if err != nil {
+			return nil, err
+		}
+		return newBatchResponse(req.Mode, res, http.StatusOK), nil
+	}
+}
+
+// ExportPaymentsRequest represents a request to export the payments matching a filter
+type ExportPaymentsRequest struct {
+	Filter *utils.Filter
+	Format ExportFormat
+}
+
+// ExportPaymentsResponse represents the response of an export request
+// The payments are read while the response is written, Export calls fn with each of them
+type ExportPaymentsResponse struct {
+	Format ExportFormat
+	Export func(ctx context.Context, fn func(payment *models.Payment) error) error
+}
+
+// MakeExportPaymentsEndpoint ...
+// Export runs with the context of the encoder, the organisation of the request is set on it again
+func MakeExportPaymentsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ExportPaymentsRequest)
+		organisationID, ok := OrganisationFromContext(ctx)
+		if !ok {
+			return nil, errorhandling.Forbidden(forbiddenCode, ErrNoOrganisation)
+		}
+		return ExportPaymentsResponse{
+			Format: req.Format,
+			Export: func(ctx context.Context, fn func(payment *models.Payment) error) error {
+				return s.ExportPayments(WithOrganisation(ctx, organisationID), req.Filter, fn)
+			},
+		}, nil
+	}
+}
+
+// ETag builds the entity tag of a payment from its version
+func ETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
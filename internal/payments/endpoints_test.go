@@ -117,7 +117,7 @@ func TestMakeUpdatePaymentEndpoint(t *testing.T) {
 			svc := &MockService{}
 			tt.mockCalls(svc)
 			endpoint := MakeUpdatePaymentEndpoint(svc)
-			resp, err := endpoint(context.Background(), &models.Payment{})
+			resp, err := endpoint(context.Background(), &models.Payment{Version: 3})
 
 			// Assert
 			assert.NotNil(t, endpoint)
@@ -126,12 +126,27 @@ func TestMakeUpdatePaymentEndpoint(t *testing.T) {
 				return
 			}
 			if !tt.wantErr {
-				assert.Nil(t, resp)
+				assert.Equal(t, UpdatePaymentResponse{Version: 3}, resp)
 			}
 		})
 	}
 }
 
+func TestGetPaymentResponse_Headers(t *testing.T) {
+	// Arrange
+	g := GetPaymentResponse{
+		Payment: models.Payment{
+			Version: 4,
+		},
+	}
+
+	// Act
+	got := g.Headers()
+
+	// Assert
+	assert.Equal(t, http.Header{"Etag": []string{`"4"`}}, got)
+}
+
 func TestMakeGetPaymentEndpoint(t *testing.T) {
 	svc := &MockService{}
 	svc.On("GetPayment", mock.Anything, mock.Anything).Return(&models.Payment{}, nil)
@@ -198,3 +213,47 @@ func TestMakeDeletePaymentEndpoint(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeCreatePaymentsEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		results    []BatchResult
+		err        error
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name:       "every payment created",
+			results:    []BatchResult{{Index: 0, Status: http.StatusCreated}, {Index: 1, Status: http.StatusCreated}},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "some payments failed",
+			results:    []BatchResult{{Index: 0, Status: http.StatusCreated}, {Index: 1, Status: http.StatusBadRequest, Err: errors.New("failed")}},
+			wantStatus: http.StatusMultiStatus,
+		},
+		{
+			name:    "batch refused",
+			err:     errors.New("failed"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockService{}
+			svc.On("CreatePayments", mock.Anything, mock.Anything, BatchBestEffort).Return(tt.results, tt.err)
+			endpoint := MakeCreatePaymentsEndpoint(svc)
+			resp, err := endpoint(context.Background(), BatchRequest{Mode: BatchBestEffort})
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MakeCreatePaymentsEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.Equal(t, tt.wantStatus, resp.(BatchResponse).StatusCode())
+				assert.Equal(t, len(tt.results), resp.(BatchResponse).Succeeded+resp.(BatchResponse).Failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package payments
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+	"github.com/cedric-parisi/payment-api/pkg/utils"
+)
+
+// ExportFormat is the representation of the exported payments
+type ExportFormat string
+
+const (
+	// ExportCSV writes a header line then one line per payment, the nested fields are flattened
+	ExportCSV ExportFormat = "csv"
+	// ExportNDJSON writes one JSON payment per line
+	ExportNDJSON ExportFormat = "ndjson"
+
+	// exportFlushSize is the number of payments written between two flushes of the response
+	exportFlushSize = 100
+	// exportStatusTrailer tells whether the export completed, as the status code is sent with the first line
+	exportStatusTrailer = "X-Export-Status"
+)
+
+// exportContentTypes maps the export formats to their media type
+var exportContentTypes = map[ExportFormat]string{
+	ExportCSV:    "text/csv; charset=utf-8",
+	ExportNDJSON: ndjsonMediaType,
+}
+
+// exportColumn is a column of the CSV export
+// Its name is the JSON path of the field, as in validation errors
+type exportColumn struct {
+	name  string
+	value func(p *models.Payment) string
+}
+
+var exportColumns = []exportColumn{
+	{"id", func(p *models.Payment) string { return p.ID.String() }},
+	{"type", func(p *models.Payment) string { return string(p.Type) }},
+	{"status", func(p *models.Payment) string { return string(p.Status) }},
+	{"version", func(p *models.Payment) string { return strconv.Itoa(p.Version) }},
+	{"organisation_id", func(p *models.Payment) string { return p.OrganisationID.String() }},
+	{"created_at", func(p *models.Payment) string { return p.CreatedAt.Format(time.RFC3339) }},
+	{"updated_at", func(p *models.Payment) string {
+		if p.UpdatedAt == nil {
+			return ""
+		}
+		return p.UpdatedAt.Format(time.RFC3339)
+	}},
+	{"deleted_at", func(p *models.Payment) string {
+		if p.DeletedAt == nil {
+			return ""
+		}
+		return p.DeletedAt.Format(time.RFC3339)
+	}},
+	{"attributes.amount", attributeColumn(func(a *models.Attribute) string { return a.Amount.String() })},
+	{"attributes.currency", attributeColumn(func(a *models.Attribute) string { return a.Currency })},
+	{"attributes.processing_date", attributeColumn(func(a *models.Attribute) string { return a.ProcessingDate })},
+	{"attributes.payment_scheme", attributeColumn(func(a *models.Attribute) string { return a.PaymentScheme })},
+	{"attributes.payment_type", attributeColumn(func(a *models.Attribute) string { return a.PaymentType })},
+	{"attributes.payment_purpose", attributeColumn(func(a *models.Attribute) string { return a.PaymentPurpose })},
+	{"attributes.scheme_payment_type", attributeColumn(func(a *models.Attribute) string { return a.SchemePaymentType })},
+	{"attributes.scheme_payment_sub_type", attributeColumn(func(a *models.Attribute) string { return a.SchemePaymentSubType })},
+	{"attributes.reference", attributeColumn(func(a *models.Attribute) string { return a.Reference })},
+	{"attributes.end_to_end_reference", attributeColumn(func(a *models.Attribute) string { return a.EndToEndReference })},
+	{"attributes.numeric_reference", attributeColumn(func(a *models.Attribute) string { return a.NumericReference })},
+	{"attributes.beneficiary_party.name", beneficiaryKey(func(b *models.BeneficiaryParty) string { return b.Name })},
+	{"attributes.beneficiary_party.address", beneficiaryKey(func(b *models.BeneficiaryParty) string { return b.Address })},
+	{"attributes.beneficiary_party.account_name", beneficiaryKey(func(b *models.BeneficiaryParty) string { return b.AccountName })},
+	{"attributes.beneficiary_party.account_number", beneficiaryKey(func(b *models.BeneficiaryParty) string { return b.AccountNumber })},
+	{"attributes.beneficiary_party.account_number_code", beneficiaryKey(func(b *models.BeneficiaryParty) string { return b.AccountNumberCode })},
+	{"attributes.beneficiary_party.account_type", beneficiaryKey(func(b *models.BeneficiaryParty) string { return strconv.Itoa(b.AccountType) })},
+	{"attributes.beneficiary_party.bank_id", beneficiaryKey(func(b *models.BeneficiaryParty) string { return b.BankID })},
+	{"attributes.beneficiary_party.bank_id_code", beneficiaryKey(func(b *models.BeneficiaryParty) string { return b.BankIDCode })},
+	{"attributes.debtor_party.name", debtorKey(func(d *models.DebtorParty) string { return d.Name })},
+	{"attributes.debtor_party.address", debtorKey(func(d *models.DebtorParty) string { return d.Address })},
+	{"attributes.debtor_party.account_name", debtorKey(func(d *models.DebtorParty) string { return d.AccountName })},
+	{"attributes.debtor_party.account_number", debtorKey(func(d *models.DebtorParty) string { return d.AccountNumber })},
+	{"attributes.debtor_party.account_number_code", debtorKey(func(d *models.DebtorParty) string { return d.AccountNumberCode })},
+	{"attributes.debtor_party.bank_id", debtorKey(func(d *models.DebtorParty) string { return d.BankID })},
+	{"attributes.debtor_party.bank_id_code", debtorKey(func(d *models.DebtorParty) string { return d.BankIDCode })},
+	{"attributes.sponsor_party.account_number", sponsorKey(func(s *models.SponsorParty) string { return s.AccountNumber })},
+	{"attributes.sponsor_party.bank_id", sponsorKey(func(s *models.SponsorParty) string { return s.BankID })},
+	{"attributes.sponsor_party.bank_id_code", sponsorKey(func(s *models.SponsorParty) string { return s.BankIDCode })},
+	{"attributes.fx.contract_reference", fxKey(func(f *models.Fx) string { return f.ContractReference })},
+	{"attributes.fx.exchange_rate", fxKey(func(f *models.Fx) string { return f.ExchangeRate.String() })},
+	{"attributes.fx.original_amount", fxKey(func(f *models.Fx) string { return f.OriginalAmount.String() })},
+	{"attributes.fx.original_currency", fxKey(func(f *models.Fx) string { return f.OriginalCurrency })},
+	{"attributes.charges_information.bearer_code", chargesKey(func(c *models.ChargesInformation) string { return c.BearerCode })},
+	{"attributes.charges_information.receiver_charges_amount", chargesKey(func(c *models.ChargesInformation) string { return c.ReceiverChargesAmount.String() })},
+	{"attributes.charges_information.receiver_charges_currency", chargesKey(func(c *models.ChargesInformation) string { return c.ReceiverChargesCurrency })},
+	// the sender charges are joined in a single column, e.g. 5.00 GBP;10.00 USD
+	{"attributes.charges_information.sender_charges", chargesKey(func(c *models.ChargesInformation) string {
+		charges := make([]string, 0, len(c.SenderCharges))
+		for _, s := range c.SenderCharges {
+			charges = append(charges, s.Amount.String()+" "+s.Currency)
+		}
+		return strings.Join(charges, ";")
+	})},
+}
+
+// attributeColumn is empty for a payment without attributes
+func attributeColumn(value func(a *models.Attribute) string) func(p *models.Payment) string {
+	return func(p *models.Payment) string {
+		if p.Attribute == nil {
+			return ""
+		}
+		return value(p.Attribute)
+	}
+}
+
+func beneficiaryKey(value func(b *models.BeneficiaryParty) string) func(p *models.Payment) string {
+	return attributeColumn(func(a *models.Attribute) string {
+		if a.BeneficiaryParty == nil {
+			return ""
+		}
+		return value(a.BeneficiaryParty)
+	})
+}
+
+func debtorKey(value func(d *models.DebtorParty) string) func(p *models.Payment) string {
+	return attributeColumn(func(a *models.Attribute) string {
+		if a.DebtorParty == nil {
+			return ""
+		}
+		return value(a.DebtorParty)
+	})
+}
+
+func sponsorKey(value func(s *models.SponsorParty) string) func(p *models.Payment) string {
+	return attributeColumn(func(a *models.Attribute) string {
+		if a.SponsorParty == nil {
+			return ""
+		}
+		return value(a.SponsorParty)
+	})
+}
+
+func fxKey(value func(f *models.Fx) string) func(p *models.Payment) string {
+	return attributeColumn(func(a *models.Attribute) string {
+		if a.Fx == nil {
+			return ""
+		}
+		return value(a.Fx)
+	})
+}
+
+func chargesKey(value func(c *models.ChargesInformation) string) func(p *models.Payment) string {
+	return attributeColumn(func(a *models.Attribute) string {
+		if a.ChargesInformation == nil {
+			return ""
+		}
+		return value(a.ChargesInformation)
+	})
+}
+
+// ExportPayments calls fn with every payment matching the filter, in the order of its sorting
+// The payments are read by pages of maxLimit in cursor mode, so that a page is
+// held in memory at most and each read is bounded by the read timeout
+// The limit, offset and cursor of the filter are ignored
+func (s *service) ExportPayments(ctx context.Context, filter *utils.Filter, fn func(payment *models.Payment) error) error {
+	page := *filter
+	page.Limit = maxLimit
+	page.Offset = 0
+	page.Cursor = &utils.Cursor{}
+
+	for {
+		// the client left or the request timed out between two pages
+		switch ctx.Err() {
+		case context.Canceled:
+			return storageError(readPaymentFailedCode, ErrCanceled)
+		case context.DeadlineExceeded:
+			return storageError(readPaymentFailedCode, ErrTimeout)
+		}
+
+		payments, _, err := s.repository.GetFilteredPayments(ctx, &page)
+		if err != nil {
+			return storageError(readPaymentFailedCode, err)
+		}
+		for _, p := range payments {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+
+		if page.Cursor = nextCursor(&page, payments); page.Cursor == nil {
+			return nil
+		}
+	}
+}
+
+// csvRecord flattens the payment in the order of exportColumns
+// Values starting like a formula are prefixed with a quote so that spreadsheets do not evaluate them
+func csvRecord(p *models.Payment) []string {
+	record := make([]string, 0, len(exportColumns))
+	for _, c := range exportColumns {
+		v := c.value(p)
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			v = "'" + v
+		}
+		record = append(record, v)
+	}
+	return record
+}
+
+// exportWriter writes the payments in the export format
+// The headers are sent with the first payment, so that a failure before it
+// is still reported with an error status code
+type exportWriter struct {
+	w       http.ResponseWriter
+	format  ExportFormat
+	csv     *csv.Writer
+	json    *json.Encoder
+	started bool
+	written int
+}
+
+func (e *exportWriter) start() error {
+	e.started = true
+	e.w.Header().Set("Content-Type", exportContentTypes[e.format])
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, resourceName, e.format))
+	e.w.Header().Set("Trailer", exportStatusTrailer)
+	e.w.WriteHeader(http.StatusOK)
+
+	if e.format == ExportNDJSON {
+		e.json = json.NewEncoder(e.w)
+		return nil
+	}
+	e.csv = csv.NewWriter(e.w)
+	header := make([]string, 0, len(exportColumns))
+	for _, c := range exportColumns {
+		header = append(header, c.name)
+	}
+	return e.csv.Write(header)
+}
+
+func (e *exportWriter) write(p *models.Payment) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if e.format == ExportNDJSON {
+		err = e.json.Encode(p)
+	} else {
+		err = e.csv.Write(csvRecord(p))
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.written++; e.written%exportFlushSize == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// encodeExportResponse streams the exported payments
+// Once the first payment is sent, a failure can only be reported in the X-Export-Status trailer,
+// which is complete when every payment was sent
+func encodeExportResponse(logger kitlog.Logger) func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		res := response.(ExportPaymentsResponse)
+		e := &exportWriter{w: w, format: res.Format}
+
+		err := res.Export(ctx, e.write)
+		if err == nil && !e.started {
+			err = e.start()
+		}
+		if err == nil {
+			err = e.flush()
+		}
+		if err != nil && !e.started {
+			// nothing was sent, the error encoder reports the error
+			return err
+		}
+		if err != nil {
+			errorhandling.Log(ctx, err, logger)
+			w.Header().Set(exportStatusTrailer, "failed")
+			return nil
+		}
+		w.Header().Set(exportStatusTrailer, "complete")
+		return nil
+	}
+}
@@ -0,0 +1,350 @@
+// +build !integration
+
+package payments
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+	"github.com/cedric-parisi/payment-api/pkg/utils"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newExportedPayments(n int) []*models.Payment {
+	payments := make([]*models.Payment, 0, n)
+	for i := 0; i < n; i++ {
+		payments = append(payments, &models.Payment{
+			ID:        uuid.New(),
+			CreatedAt: time.Date(2019, 1, 1, 0, 0, i, 0, time.UTC),
+		})
+	}
+	return payments
+}
+
+func Test_service_ExportPayments(t *testing.T) {
+	full := newExportedPayments(maxLimit)
+	last := newExportedPayments(3)
+	tests := []struct {
+		name      string
+		ctx       func() context.Context
+		fnErr     error
+		want      int
+		wantErr   bool
+		mockCalls func(m *MockPaymentRepository)
+	}{
+		{
+			name: "every page is read",
+			ctx:  context.Background,
+			want: maxLimit + 3,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetFilteredPayments", mock.Anything, mock.MatchedBy(func(f *utils.Filter) bool {
+					return f.Cursor.IsZero() && f.Limit == maxLimit && len(f.Predicates) == 1
+				})).Return(full, 0, nil).Once()
+				m.On("GetFilteredPayments", mock.Anything, mock.MatchedBy(func(f *utils.Filter) bool {
+					return f.Cursor.ID == full[maxLimit-1].ID.String()
+				})).Return(last, 0, nil).Once()
+			},
+		},
+		{
+			name:    "export stopped by fn",
+			ctx:     context.Background,
+			fnErr:   errors.New("client left"),
+			wantErr: true,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetFilteredPayments", mock.Anything, mock.Anything).Return(last, 0, nil).Once()
+			},
+		},
+		{
+			name:    "export failed due to repository error",
+			ctx:     context.Background,
+			wantErr: true,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetFilteredPayments", mock.Anything, mock.Anything).Return(nil, 0, errors.New("failed")).Once()
+			},
+		},
+		{
+			name: "export failed due to canceled context",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(callerContext())
+				cancel()
+				return ctx
+			},
+			wantErr:   true,
+			mockCalls: func(m *MockPaymentRepository) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			s := &service{
+				repository: mockRepo,
+			}
+			filter := &utils.Filter{
+				Limit:      10,
+				Offset:     20,
+				Sorting:    []utils.Sort{{Field: "created_at"}},
+				Predicates: []utils.Predicate{{Field: "currency", Operator: utils.Eq, Values: []string{"GBP"}}},
+			}
+
+			// Act
+			got := 0
+			err := s.ExportPayments(tt.ctx(), filter, func(p *models.Payment) error {
+				got++
+				return tt.fnErr
+			})
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.ExportPayments() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
+
+func Test_csvRecord(t *testing.T) {
+	p := &models.Payment{
+		ID: uuid.MustParse("3578205f-aeb3-444a-a42f-d47298b6eb8b"),
+		Attribute: &models.Attribute{
+			Amount:    models.MustParseDecimal("100.21"),
+			Reference: "=HYPERLINK(\"http://evil\")",
+			BeneficiaryParty: &models.BeneficiaryParty{
+				Name: "Wilfred Jeremiah Owens",
+			},
+			ChargesInformation: &models.ChargesInformation{
+				SenderCharges: []*models.SenderCharge{
+					{Amount: models.MustParseDecimal("5.00"), Currency: "GBP"},
+					{Amount: models.MustParseDecimal("10.00"), Currency: "USD"},
+				},
+			},
+		},
+	}
+	record := csvRecord(p)
+	assert.Len(t, record, len(exportColumns))
+
+	values := map[string]string{}
+	for i, c := range exportColumns {
+		values[c.name] = record[i]
+	}
+	assert.Equal(t, "3578205f-aeb3-444a-a42f-d47298b6eb8b", values["id"])
+	assert.Equal(t, "100.21", values["attributes.amount"])
+	assert.Equal(t, "'=HYPERLINK(\"http://evil\")", values["attributes.reference"])
+	assert.Equal(t, "Wilfred Jeremiah Owens", values["attributes.beneficiary_party.name"])
+	assert.Equal(t, "", values["attributes.debtor_party.name"])
+	assert.Equal(t, "5.00 GBP;10.00 USD", values["attributes.charges_information.sender_charges"])
+}
+
+func Test_encodeExportResponse(t *testing.T) {
+	payments := newExportedPayments(2)
+	tests := []struct {
+		name        string
+		format      ExportFormat
+		err         error
+		failAfter   int
+		wantErr     bool
+		wantStatus  string
+		wantType    string
+		wantLines   int
+		wantTrailer string
+	}{
+		{
+			name:        "csv export",
+			format:      ExportCSV,
+			failAfter:   -1,
+			wantType:    "text/csv; charset=utf-8",
+			wantLines:   3,
+			wantTrailer: "complete",
+		},
+		{
+			name:        "ndjson export",
+			format:      ExportNDJSON,
+			failAfter:   -1,
+			wantType:    "application/x-ndjson",
+			wantLines:   2,
+			wantTrailer: "complete",
+		},
+		{
+			name:      "failure before the first payment",
+			format:    ExportCSV,
+			err:       errors.New("failed"),
+			failAfter: 0,
+			wantErr:   true,
+		},
+		{
+			name:        "failure after the first payment",
+			format:      ExportNDJSON,
+			err:         errors.New("failed"),
+			failAfter:   1,
+			wantType:    "application/x-ndjson",
+			wantLines:   1,
+			wantTrailer: "failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			response := ExportPaymentsResponse{
+				Format: tt.format,
+				Export: func(ctx context.Context, fn func(payment *models.Payment) error) error {
+					for i, p := range payments {
+						if i == tt.failAfter {
+							return tt.err
+						}
+						if err := fn(p); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			}
+
+			err := encodeExportResponse(kitlog.NewNopLogger())(callerContext(), w, response)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("encodeExportResponse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Empty(t, w.Body.String())
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantTrailer, w.Header().Get(exportStatusTrailer))
+			assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), tt.wantLines)
+			if tt.format == ExportCSV {
+				records, err := csv.NewReader(w.Body).ReadAll()
+				assert.NoError(t, err)
+				assert.Equal(t, "id", records[0][0])
+				assert.Equal(t, payments[0].ID.String(), records[1][0])
+			}
+		})
+	}
+}
+
+func Test_decodeExportPaymentsRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		wantFormat ExportFormat
+		wantErr    bool
+	}{
+		{
+			name:       "csv by default",
+			url:        "/payments/export?currency=GBP",
+			wantFormat: ExportCSV,
+		},
+		{
+			name:       "ndjson",
+			url:        "/payments/export?format=ndjson&sort=-created_at",
+			wantFormat: ExportNDJSON,
+		},
+		{
+			name:    "unknown format",
+			url:     "/payments/export?format=xlsx",
+			wantErr: true,
+		},
+		{
+			name:       "unknown params are ignored",
+			url:        "/payments/export?colour=red",
+			wantFormat: ExportCSV,
+		},
+		{
+			name:    "invalid filter value",
+			url:     "/payments/export?amount[gt]=NaN",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeExportPaymentsRequest(callerContext(), httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeExportPaymentsRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Equal(t, http.StatusBadRequest, err.(kithttp.StatusCoder).StatusCode())
+				return
+			}
+			assert.Equal(t, tt.wantFormat, got.(ExportPaymentsRequest).Format)
+		})
+	}
+}
+
+func TestMakePaymentHTTPHandler_Export(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantRows   int
+		mockCalls  func(m *MockPaymentRepository)
+	}{
+		{
+			name:       "export refused without token",
+			wantStatus: http.StatusUnauthorized,
+			mockCalls:  func(m *MockPaymentRepository) {},
+		},
+		{
+			name:       "export refused without the read scope",
+			token:      testToken(t, &auth.Claims{OrganisationID: testOrganisationID.String(), Scope: auth.ScopePaymentsWrite}),
+			wantStatus: http.StatusForbidden,
+			mockCalls:  func(m *MockPaymentRepository) {},
+		},
+		{
+			name:       "export scoped to the organisation of the token",
+			token:      testToken(t, &auth.Claims{OrganisationID: testOrganisationID.String(), Scope: auth.ScopePaymentsRead}),
+			wantStatus: http.StatusOK,
+			wantRows:   3,
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetFilteredPayments", mock.MatchedBy(func(ctx context.Context) bool {
+					organisationID, ok := OrganisationFromContext(ctx)
+					return ok && organisationID == testOrganisationID
+				}), mock.Anything).Return(newExportedPayments(3), 0, nil).Once()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			handler := newTestHTTPHandler(NewService(mockRepo, nil, nil, nil, Options{}))
+			r := httptest.NewRequest(http.MethodGet, "/payments/export?currency=GBP", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(w, r)
+
+			// Assert
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantRows > 0 {
+				records, err := csv.NewReader(w.Body).ReadAll()
+				assert.NoError(t, err)
+				// the header is followed by a row per payment
+				assert.Len(t, records, tt.wantRows+1)
+			}
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
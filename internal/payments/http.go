@@ -4,7 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/cedric-parisi/payment-api/internal/models"
 
@@ -20,8 +25,13 @@ import (
 
 	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
 	"github.com/cedric-parisi/payment-api/pkg/instrumenting"
+	"github.com/cedric-parisi/payment-api/pkg/jsonapi"
+	"github.com/cedric-parisi/payment-api/pkg/patch"
 )
 
+// ndjsonMediaType is the media type of newline delimited JSON
+const ndjsonMediaType = "application/x-ndjson"
+
 // MakePaymentHTTPHandler ...
 func MakePaymentHTTPHandler(errLogger kitlog.Logger, tracer stdopentracing.Tracer, endpoints Endpoints) http.Handler {
 	errLogger = kitlog.With(errLogger, "component", resourceName)
@@ -30,14 +40,20 @@ func MakePaymentHTTPHandler(errLogger kitlog.Logger, tracer stdopentracing.Trace
 		kithttp.ServerBefore(kithttp.PopulateRequestContext),
 		kithttp.ServerErrorEncoder(encodeError(errLogger)),
 		kithttp.ServerBefore(kitjwt.HTTPToContext()),
+		kithttp.ServerBefore(jsonapi.HTTPToContext),
+		kithttp.ServerBefore(requestIDToContext),
+		kithttp.ServerAfter(requestIDToHTTP),
 	}
 
 	createPaymentHandler := instrumenting.Middleware(resourceName, "create-payment",
 		kithttp.NewServer(
 			endpoints.CreatePayment,
 			decodeCreatePaymentRequest,
-			kithttp.EncodeJSONResponse,
-			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+			encodeResponse,
+			append(options,
+				kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)),
+				kithttp.ServerBefore(idempotencyKeyToContext),
+			)...,
 		),
 	)
 
@@ -54,7 +70,7 @@ func MakePaymentHTTPHandler(errLogger kitlog.Logger, tracer stdopentracing.Trace
 		kithttp.NewServer(
 			endpoints.GetPayment,
 			decodeGetPaymentRequest,
-			kithttp.EncodeJSONResponse,
+			encodeResponse,
 			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
 		),
 	)
@@ -63,7 +79,7 @@ func MakePaymentHTTPHandler(errLogger kitlog.Logger, tracer stdopentracing.Trace
 		kithttp.NewServer(
 			endpoints.GetFilteredPayments,
 			decodeGetFilteredPaymentsRequest,
-			kithttp.EncodeJSONResponse,
+			encodeResponse,
 			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
 		),
 	)
@@ -77,13 +93,94 @@ func MakePaymentHTTPHandler(errLogger kitlog.Logger, tracer stdopentracing.Trace
 		),
 	)
 
+	getPaymentHistoryHandler := instrumenting.Middleware(resourceName, "get-payment-history",
+		kithttp.NewServer(
+			endpoints.GetPaymentHistory,
+			decodeGetPaymentRequest,
+			encodeResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+		),
+	)
+
+	restorePaymentHandler := instrumenting.Middleware(resourceName, "restore-payment",
+		kithttp.NewServer(
+			endpoints.RestorePayment,
+			decodeGetPaymentRequest,
+			encodeResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+		),
+	)
+
+	purgePaymentsHandler := instrumenting.Middleware(resourceName, "purge-payments",
+		kithttp.NewServer(
+			endpoints.PurgePayments,
+			kithttp.NopRequestDecoder,
+			encodeResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+		),
+	)
+
+	transitionPaymentHandler := instrumenting.Middleware(resourceName, "transition-payment",
+		kithttp.NewServer(
+			endpoints.TransitionPayment,
+			decodeTransitionPaymentRequest,
+			encodeResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+		),
+	)
+
+	patchPaymentHandler := instrumenting.Middleware(resourceName, "patch-payment",
+		kithttp.NewServer(
+			endpoints.PatchPayment,
+			decodePatchPaymentRequest,
+			encodeResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+		),
+	)
+
+	createPaymentsHandler := instrumenting.Middleware(resourceName, "create-payments",
+		kithttp.NewServer(
+			endpoints.CreatePayments,
+			decodeBatchRequest,
+			encodeResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+		),
+	)
+
+	updatePaymentsHandler := instrumenting.Middleware(resourceName, "update-payments",
+		kithttp.NewServer(
+			endpoints.UpdatePayments,
+			decodeBatchRequest,
+			encodeResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+		),
+	)
+
+	exportPaymentsHandler := instrumenting.Middleware(resourceName, "export-payments",
+		kithttp.NewServer(
+			endpoints.ExportPayments,
+			decodeExportPaymentsRequest,
+			encodeExportResponse(errLogger),
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "payments", errLogger)))...,
+		),
+	)
+
 	r := mux.NewRouter().PathPrefix("/payments/").Subrouter().StrictSlash(true)
 	{
 		r.Handle("/", errorhandling.RecoverFromPanic(errLogger, createPaymentHandler)).Methods(http.MethodPost)
+		// registered before /{id} which would match batch and export
+		r.Handle("/batch", errorhandling.RecoverFromPanic(errLogger, createPaymentsHandler)).Methods(http.MethodPost)
+		r.Handle("/batch", errorhandling.RecoverFromPanic(errLogger, updatePaymentsHandler)).Methods(http.MethodPut)
+		r.Handle("/export", errorhandling.RecoverFromPanic(errLogger, exportPaymentsHandler)).Methods(http.MethodGet)
+		r.Handle("/purge", errorhandling.RecoverFromPanic(errLogger, purgePaymentsHandler)).Methods(http.MethodPost)
 		r.Handle("/{id}", errorhandling.RecoverFromPanic(errLogger, updatePaymentHandler)).Methods(http.MethodPut)
+		r.Handle("/{id}", errorhandling.RecoverFromPanic(errLogger, patchPaymentHandler)).Methods(http.MethodPatch)
 		r.Handle("/{id}", errorhandling.RecoverFromPanic(errLogger, getPaymentHandler)).Methods(http.MethodGet)
+		r.Handle("/{id}/history", errorhandling.RecoverFromPanic(errLogger, getPaymentHistoryHandler)).Methods(http.MethodGet)
 		r.Handle("/", errorhandling.RecoverFromPanic(errLogger, getFilteredPaymentsHandler)).Methods(http.MethodGet)
 		r.Handle("/{id}", errorhandling.RecoverFromPanic(errLogger, deletePaymentHandler)).Methods(http.MethodDelete)
+		r.Handle("/{id}/restore", errorhandling.RecoverFromPanic(errLogger, restorePaymentHandler)).Methods(http.MethodPost)
+		r.Handle("/{id}/{action:submit|accept|settle|reject|cancel}", errorhandling.RecoverFromPanic(errLogger, transitionPaymentHandler)).Methods(http.MethodPost)
 	}
 
 	return r
@@ -92,37 +189,206 @@ func MakePaymentHTTPHandler(errLogger kitlog.Logger, tracer stdopentracing.Trace
 func decodeCreatePaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	req := &models.Payment{}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, errorhandling.Internal(invalidPaymentCode, err)
+		return nil, errorhandling.InvalidRequest(invalidPaymentCode, err)
 	}
 	return req, nil
 }
 
+// idempotencyKeyToContext moves the Idempotency-Key header into the context
+func idempotencyKeyToContext(ctx context.Context, r *http.Request) context.Context {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, ContextKeyIdempotencyKey, key)
+}
+
 func decodeUpdatePaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	id := mux.Vars(r)["id"]
 	req := &models.Payment{}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, errorhandling.Internal(invalidPaymentCode, err)
+		return nil, errorhandling.InvalidRequest(invalidPaymentCode, err)
 	}
 	if id != req.ID.String() {
 		return nil, errorhandling.InvalidRequest(invalidPaymentCode, errors.New("id mismatch"))
 	}
+
+	// If-Match takes precedence over the version of the body
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, err := parseETag(ifMatch)
+		if err != nil {
+			return nil, errorhandling.InvalidRequest(invalidPaymentCode, err)
+		}
+		req.Version = version
+	}
 	return req, nil
 }
 
+// decodePatchPaymentRequest reads a JSON Merge Patch or a JSON Patch, told apart by the Content-Type header
+// The version to patch comes from the If-Match header, the stored one is patched without it
+func decodePatchPaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != patch.MergePatchMediaType && mediaType != patch.JSONPatchMediaType) {
+		return nil, errorhandling.UnsupportedMediaType(unsupportedPatchCode,
+			fmt.Errorf("Content-Type must be %s or %s", patch.MergePatchMediaType, patch.JSONPatchMediaType))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errorhandling.Internal(invalidPatchCode, err)
+	}
+
+	req := PatchPaymentRequest{
+		ID: mux.Vars(r)["id"],
+		Patch: Patch{
+			MediaType: mediaType,
+			Body:      body,
+		},
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, err := parseETag(ifMatch)
+		if err != nil {
+			return nil, errorhandling.InvalidRequest(invalidPaymentCode, err)
+		}
+		req.Patch.Version = &version
+	}
+	return req, nil
+}
+
+// decodeBatchRequest reads the payments of a batch, either a JSON array
+// or, with the application/x-ndjson Content-Type, one payment per line
+// The mode query parameter selects the batch mode, atomic by default
+func decodeBatchRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	req := BatchRequest{Mode: BatchMode(r.URL.Query().Get("mode"))}
+	if req.Mode == "" {
+		req.Mode = BatchAtomic
+	}
+	if !req.Mode.IsValid() {
+		return nil, errorhandling.InvalidRequest(invalidBatchCode,
+			fmt.Errorf("mode must be %s or %s", BatchAtomic, BatchBestEffort))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != ndjsonMediaType {
+		if err := json.NewDecoder(r.Body).Decode(&req.Payments); err != nil {
+			return nil, errorhandling.InvalidRequest(invalidBatchCode, err)
+		}
+		return req, nil
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	for decoder.More() {
+		// stop reading early, the service refuses the batch anyway
+		if len(req.Payments) > maxBatchSize {
+			break
+		}
+		payment := &models.Payment{}
+		if err := decoder.Decode(payment); err != nil {
+			return nil, errorhandling.InvalidRequest(invalidBatchCode, fmt.Errorf("line %d: %s", len(req.Payments)+1, err))
+		}
+		req.Payments = append(req.Payments, payment)
+	}
+	return req, nil
+}
+
+// parseETag extracts the payment version from an entity tag
+func parseETag(etag string) (int, error) {
+	tag := strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	version, err := strconv.Atoi(strings.Trim(tag, `"`))
+	if err != nil {
+		return 0, fmt.Errorf("invalid entity tag %s", etag)
+	}
+	return version, nil
+}
+
 func decodeGetPaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	return mux.Vars(r)["id"], nil
 }
 
 func decodeGetFilteredPaymentsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
-	filter := utils.GetFilter(r.URL.Query())
+	filter, err := utils.GetFilter(r.URL.Query(), FilterFields)
+	if err != nil {
+		return nil, errorhandling.InvalidRequest(invalidCursorCode, err)
+	}
+	if err := filter.Validate(FilterFields); err != nil {
+		return nil, errorhandling.InvalidRequest(invalidFilterCode, err)
+	}
+	if err := filter.ValidateSorting(SortFields); err != nil {
+		return nil, errorhandling.InvalidRequest(invalidSortCode, err)
+	}
+	if raw := r.URL.Query().Get("include_deleted"); raw != "" {
+		if filter.IncludeDeleted, err = strconv.ParseBool(raw); err != nil {
+			return nil, errorhandling.InvalidRequest(invalidFilterCode, fmt.Errorf("include_deleted must be a boolean"))
+		}
+	}
+
+	for _, p := range filter.Predicates {
+		if p.Field != "status" {
+			continue
+		}
+		for _, status := range p.Values {
+			if !models.Status(status).IsValid() {
+				return nil, errorhandling.InvalidRequest(invalidFilterCode, fmt.Errorf("unknown status %s", status))
+			}
+		}
+	}
 	return filter, nil
 }
 
+// decodeExportPaymentsRequest reads the filters and sorting as decodeGetFilteredPaymentsRequest does
+// The format query parameter is csv or ndjson, csv by default
+func decodeExportPaymentsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	format := ExportFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = ExportCSV
+	}
+	if _, ok := exportContentTypes[format]; !ok {
+		return nil, errorhandling.InvalidRequest(invalidFilterCode,
+			fmt.Errorf("format must be %s or %s", ExportCSV, ExportNDJSON))
+	}
+
+	filter, err := decodeGetFilteredPaymentsRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return ExportPaymentsRequest{
+		Filter: filter.(*utils.Filter),
+		Format: format,
+	}, nil
+}
+
+// actions maps the transition endpoints to the status they lead to
+var actions = map[string]models.Status{
+	"submit": models.StatusSubmitted,
+	"accept": models.StatusAccepted,
+	"settle": models.StatusSettled,
+	"reject": models.StatusRejected,
+	"cancel": models.StatusCancelled,
+}
+
+func decodeTransitionPaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	status, ok := actions[vars["action"]]
+	if !ok {
+		return nil, errorhandling.InvalidRequest(invalidPaymentCode, fmt.Errorf("unknown action %s", vars["action"]))
+	}
+	return TransitionPaymentRequest{
+		ID:     vars["id"],
+		Status: status,
+	}, nil
+}
+
 func decodeDeletePaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	return mux.Vars(r)["id"], nil
 }
 
 func encodeEmptyResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if headerer, ok := response.(kithttp.Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
@@ -152,7 +418,9 @@ func encodeError(logger kitlog.Logger) kithttp.ErrorEncoder {
 			errorhandling.Log(ctx, err, logger)
 		}
 
-		// Use JSON default encoder from go-kit
-		kithttp.DefaultErrorEncoder(ctx, err, w)
+		// ServerAfter does not run on errors
+		requestIDToHTTP(ctx, w)
+		// JSON:API errors document or JSON default encoder from go-kit
+		errorhandling.EncodeError(ctx, err, w)
 	}
 }
@@ -12,16 +12,41 @@ import (
 	"testing"
 
 	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+	"github.com/cedric-parisi/payment-api/pkg/jsonapi"
 
 	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/auth"
 	"github.com/cedric-parisi/payment-api/pkg/utils"
+	jwt "github.com/dgrijalva/jwt-go"
 	kitjwt "github.com/go-kit/kit/auth/jwt"
 	kitlog "github.com/go-kit/kit/log"
+	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	stdopentracing "github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 )
 
+// testSigningKey signs the tokens of the handler tests
+var testSigningKey = []byte("payments-test-key")
+
+// newTestHTTPHandler serves the service as main does, with tokens signed by testSigningKey
+func newTestHTTPHandler(service Service) http.Handler {
+	keyFunc := func(*jwt.Token) (interface{}, error) { return testSigningKey, nil }
+	JWTMiddleware := kitjwt.NewParser(keyFunc, jwt.SigningMethodHS256, auth.ClaimsFactory)
+	tracer := stdopentracing.NoopTracer{}
+	return MakePaymentHTTPHandler(kitlog.NewNopLogger(), tracer, MakeEndpoints(service, tracer, JWTMiddleware))
+}
+
+// testToken signs the claims with testSigningKey
+func testToken(t *testing.T, claims *auth.Claims) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
 func Test_decodeCreatePaymentRequest(t *testing.T) {
 	type args struct {
 		ctx context.Context
@@ -74,6 +99,20 @@ func Test_decodeCreatePaymentRequest(t *testing.T) {
 	}
 }
 
+func Test_idempotencyKeyToContext(t *testing.T) {
+	// Arrange
+	r := httptest.NewRequest(http.MethodPost, "/payments/", nil)
+	r.Header.Set("Idempotency-Key", "3d0f6b1c")
+
+	// Act
+	ctx := idempotencyKeyToContext(context.Background(), r)
+	empty := idempotencyKeyToContext(context.Background(), httptest.NewRequest(http.MethodPost, "/payments/", nil))
+
+	// Assert
+	assert.Equal(t, "3d0f6b1c", idempotencyKeyFromContext(ctx))
+	assert.Equal(t, "", idempotencyKeyFromContext(empty))
+}
+
 func Test_decodeUpdatePaymentRequest(t *testing.T) {
 	type args struct {
 		ctx context.Context
@@ -114,6 +153,47 @@ func Test_decodeUpdatePaymentRequest(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "decode update payment request with If-Match ok",
+			args: args{
+				ctx: context.Background(),
+				r: func() *http.Request {
+					r := mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/payments/3578205f-aeb3-444a-a42f-d47298b6eb8b", strings.NewReader(`
+					{
+						"id": "3578205f-aeb3-444a-a42f-d47298b6eb8b",
+						"type": "Payment",
+						"version": 18,
+						"organisation_id": "743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb"
+					}
+					`)), map[string]string{"id": "3578205f-aeb3-444a-a42f-d47298b6eb8b"})
+					r.Header.Set("If-Match", `"12"`)
+					return r
+				}(),
+			},
+			want: &models.Payment{
+				ID:             uuid.MustParse("3578205f-aeb3-444a-a42f-d47298b6eb8b"),
+				Type:           models.PaymentType,
+				Version:        12,
+				OrganisationID: uuid.MustParse("743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb"),
+			},
+		},
+		{
+			name: "decode update payment failed due to malformed If-Match",
+			args: args{
+				ctx: context.Background(),
+				r: func() *http.Request {
+					r := mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/payments/3578205f-aeb3-444a-a42f-d47298b6eb8b", strings.NewReader(`
+					{
+						"id": "3578205f-aeb3-444a-a42f-d47298b6eb8b",
+						"type": "Payment"
+					}
+					`)), map[string]string{"id": "3578205f-aeb3-444a-a42f-d47298b6eb8b"})
+					r.Header.Set("If-Match", `"v12"`)
+					return r
+				}(),
+			},
+			wantErr: true,
+		},
 		{
 			name: "decode update payment failed due to wrong id",
 			args: args{
@@ -208,6 +288,114 @@ func Test_decodeGetFilteredPaymentsRequest(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "get filtered payment request by status ok",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?status=submitted", nil),
+			},
+			want: &utils.Filter{
+				Limit:  100,
+				Offset: 0,
+				Predicates: []utils.Predicate{
+					{Field: "status", Operator: utils.Eq, Values: []string{"submitted"}},
+				},
+			},
+		},
+		{
+			name: "get filtered payment request by attributes ok",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?currency=GBP&amount[gte]=10.5&processing_date[lt]=2017-02-01", nil),
+			},
+			want: &utils.Filter{
+				Limit:  100,
+				Offset: 0,
+				Predicates: []utils.Predicate{
+					{Field: "amount", Operator: utils.Gte, Values: []string{"10.5"}},
+					{Field: "currency", Operator: utils.Eq, Values: []string{"GBP"}},
+					{Field: "processing_date", Operator: utils.Lt, Values: []string{"2017-02-01"}},
+				},
+			},
+		},
+		{
+			name: "get filtered payment request ignores unknown params",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?password=secret&_=1571392800&currency=GBP", nil),
+			},
+			want: &utils.Filter{
+				Limit:  100,
+				Offset: 0,
+				Predicates: []utils.Predicate{
+					{Field: "currency", Operator: utils.Eq, Values: []string{"GBP"}},
+				},
+			},
+		},
+		{
+			name: "get filtered payment request failed due to unknown operator",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?currency[gt]=GBP", nil),
+			},
+			wantErr: true,
+		},
+		{
+			name: "get filtered payment request in cursor mode ok",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?limit=10&cursor=", nil),
+			},
+			want: &utils.Filter{
+				Limit:  10,
+				Offset: 0,
+				Cursor: &utils.Cursor{},
+			},
+		},
+		{
+			name: "get filtered payment request failed due to malformed cursor",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?cursor=abc", nil),
+			},
+			wantErr: true,
+		},
+		{
+			name: "get filtered payment request failed due to unknown sort field",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?sort=-views", nil),
+			},
+			wantErr: true,
+		},
+		{
+			name: "get filtered payment request failed due to unknown status",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?status=lost", nil),
+			},
+			wantErr: true,
+		},
+		{
+			name: "get filtered payment request with deleted payments ok",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?include_deleted=true", nil),
+			},
+			want: &utils.Filter{
+				Limit:          100,
+				Offset:         0,
+				IncludeDeleted: true,
+			},
+		},
+		{
+			name: "get filtered payment request failed due to malformed include_deleted",
+			args: args{
+				ctx: context.Background(),
+				r:   httptest.NewRequest(http.MethodGet, "/payments/?include_deleted=maybe", nil),
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -223,6 +411,173 @@ func Test_decodeGetFilteredPaymentsRequest(t *testing.T) {
 	}
 }
 
+func Test_decodeTransitionPaymentRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "submit payment request ok",
+			vars: map[string]string{"id": "3578205f-aeb3-444a-a42f-d47298b6eb8b", "action": "submit"},
+			want: TransitionPaymentRequest{
+				ID:     "3578205f-aeb3-444a-a42f-d47298b6eb8b",
+				Status: models.StatusSubmitted,
+			},
+		},
+		{
+			name:    "unknown action",
+			vars:    map[string]string{"id": "3578205f-aeb3-444a-a42f-d47298b6eb8b", "action": "archive"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/payments/3578205f-aeb3-444a-a42f-d47298b6eb8b/submit", nil), tt.vars)
+			got, err := decodeTransitionPaymentRequest(context.Background(), r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeTransitionPaymentRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeTransitionPaymentRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_decodePatchPaymentRequest(t *testing.T) {
+	version := 3
+	tests := []struct {
+		name        string
+		contentType string
+		ifMatch     string
+		want        interface{}
+		wantErr     bool
+		wantStatus  int
+	}{
+		{
+			name:        "merge patch request ok",
+			contentType: "application/merge-patch+json",
+			want: PatchPaymentRequest{
+				ID:    "3578205f-aeb3-444a-a42f-d47298b6eb8b",
+				Patch: Patch{MediaType: "application/merge-patch+json", Body: []byte(`{"reference":"new"}`)},
+			},
+		},
+		{
+			name:        "json patch request with If-Match ok",
+			contentType: "application/json-patch+json; charset=utf-8",
+			ifMatch:     `"3"`,
+			want: PatchPaymentRequest{
+				ID:    "3578205f-aeb3-444a-a42f-d47298b6eb8b",
+				Patch: Patch{MediaType: "application/json-patch+json", Body: []byte(`{"reference":"new"}`), Version: &version},
+			},
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "application/json",
+			wantErr:     true,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "invalid If-Match",
+			contentType: "application/merge-patch+json",
+			ifMatch:     "three",
+			wantErr:     true,
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/payments/3578205f-aeb3-444a-a42f-d47298b6eb8b", strings.NewReader(`{"reference":"new"}`))
+			r.Header.Set("Content-Type", tt.contentType)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			r = mux.SetURLVars(r, map[string]string{"id": "3578205f-aeb3-444a-a42f-d47298b6eb8b"})
+			got, err := decodePatchPaymentRequest(context.Background(), r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodePatchPaymentRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_decodeBatchRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		contentType  string
+		body         string
+		wantMode     BatchMode
+		wantPayments int
+		wantErr      bool
+	}{
+		{
+			name:         "json array in atomic mode by default",
+			url:          "/payments/batch",
+			contentType:  "application/json",
+			body:         `[{"type": "Payment"}, {"type": "Withdraw"}]`,
+			wantMode:     BatchAtomic,
+			wantPayments: 2,
+		},
+		{
+			name:         "ndjson stream in best effort mode",
+			url:          "/payments/batch?mode=best_effort",
+			contentType:  "application/x-ndjson",
+			body:         "{\"type\": \"Payment\"}\n{\"type\": \"Withdraw\"}\n{\"type\": \"Payment\"}\n",
+			wantMode:     BatchBestEffort,
+			wantPayments: 3,
+		},
+		{
+			name:        "malformed ndjson line",
+			url:         "/payments/batch",
+			contentType: "application/x-ndjson",
+			body:        "{\"type\": \"Payment\"}\n{\"type\":\n",
+			wantErr:     true,
+		},
+		{
+			name:        "json object instead of array",
+			url:         "/payments/batch",
+			contentType: "application/json",
+			body:        `{"type": "Payment"}`,
+			wantErr:     true,
+		},
+		{
+			name:        "unknown mode",
+			url:         "/payments/batch?mode=sometimes",
+			contentType: "application/json",
+			body:        `[]`,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			got, err := decodeBatchRequest(context.Background(), r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeBatchRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Equal(t, http.StatusBadRequest, err.(kithttp.StatusCoder).StatusCode())
+				return
+			}
+			req := got.(BatchRequest)
+			assert.Equal(t, tt.wantMode, req.Mode)
+			assert.Len(t, req.Payments, tt.wantPayments)
+		})
+	}
+}
+
 func Test_decodeDeletePaymentRequest(t *testing.T) {
 	type args struct {
 		ctx context.Context
@@ -270,6 +625,18 @@ func Test_encodeEmptyResponse(t *testing.T) {
 	assert.Equal(t, http.StatusNoContent, w.Code)
 }
 
+func Test_encodeEmptyResponse_Headers(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+
+	// Act
+	encodeEmptyResponse(context.Background(), w, UpdatePaymentResponse{Version: 2})
+
+	// Assert
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+}
+
 func Test_encodeError(t *testing.T) {
 	var tests = []struct {
 		name string
@@ -309,3 +676,64 @@ func Test_encodeError(t *testing.T) {
 		})
 	}
 }
+
+func Test_encodeError_JSONAPI(t *testing.T) {
+	// Arrange
+	r := httptest.NewRequest(http.MethodGet, "/payments/", nil)
+	r.Header.Set("Accept", jsonapi.MediaType)
+	ctx := jsonapi.HTTPToContext(context.Background(), r)
+	w := httptest.NewRecorder()
+
+	// Act
+	encodeError(kitlog.NewNopLogger())(ctx, errorhandling.NotFound("payment_not_found", errors.New("payment not found")), w)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, jsonapi.MediaType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"errors":[{"status":"404","code":"payment_not_found","detail":"payment not found"}]}`, w.Body.String())
+}
+
+func TestMakePaymentHTTPHandler_InvalidDecimal(t *testing.T) {
+	pID := "3578205f-aeb3-444a-a42f-d47298b6eb8b"
+	body := `{
+		"id": "` + pID + `",
+		"type": "Payment",
+		"organisation_id": "` + testOrganisationID.String() + `",
+		"attributes": {"amount": "abc", "currency": "GBP"}
+	}`
+	tests := []struct {
+		name   string
+		method string
+		url    string
+	}{
+		{
+			name:   "create payment",
+			method: http.MethodPost,
+			url:    "/payments/",
+		},
+		{
+			name:   "update payment",
+			method: http.MethodPut,
+			url:    "/payments/" + pID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			handler := newTestHTTPHandler(&MockService{})
+			r := httptest.NewRequest(tt.method, tt.url, strings.NewReader(body))
+			r.Header.Set("Authorization", "Bearer "+testToken(t, &auth.Claims{
+				OrganisationID: testOrganisationID.String(),
+				Scope:          auth.ScopePaymentsWrite,
+			}))
+			w := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(w, r)
+
+			// Assert
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), `invalid decimal \"abc\"`)
+		})
+	}
+}
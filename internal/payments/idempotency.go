@@ -0,0 +1,153 @@
+package payments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+)
+
+type contextKey int
+
+const (
+	// ContextKeyIdempotencyKey holds the Idempotency-Key header of the request
+	ContextKeyIdempotencyKey contextKey = iota
+	// ContextKeyRequestID holds the id of the request recorded in the audit entries
+	ContextKeyRequestID
+	// ContextKeyOrganisation holds the organisation of the caller, see WithOrganisation
+	ContextKeyOrganisation
+
+	maxIdempotencyKeyLength = 255
+	// defaultReservationTTL is how long a key stays reserved for a request that never completes it
+	defaultReservationTTL = time.Minute
+
+	idempotencyKeyReusedCode     = "idempotency_key_reused"
+	idempotencyKeyInProgressCode = "idempotency_key_in_progress"
+	invalidIdempotencyKeyCode    = "invalid_idempotency_key"
+)
+
+var (
+	// ErrDuplicateKey is raised when an idempotency key is already stored
+	ErrDuplicateKey = errors.New("duplicate key")
+)
+
+// IdempotencyRepository stores the idempotency keys of create requests
+type IdempotencyRepository interface {
+	GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error)
+	// ReserveIdempotencyKey returns ErrDuplicateKey if the key already exists
+	ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	// TakeOverIdempotencyKey replaces a reservation without response made before reservedBefore
+	// Returns ErrDuplicateKey if the key was completed or reserved again in the meantime
+	TakeOverIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, reservedBefore time.Time) error
+	// CompleteIdempotencyKey stores the response of the reservation holding the token
+	// Returns ErrDuplicateKey if another request took the reservation over
+	CompleteIdempotencyKey(ctx context.Context, key string, token uuid.UUID, response string) error
+	// ReleaseIdempotencyKey removes the reservation holding the token, a reservation taken over is kept
+	ReleaseIdempotencyKey(ctx context.Context, key string, token uuid.UUID) error
+}
+
+// idempotencyKeyFromContext returns the Idempotency-Key sent with the request, if any
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(ContextKeyIdempotencyKey).(string)
+	return key
+}
+
+// fingerprint hashes the payment as sent by the client
+func fingerprint(payment *models.Payment) (string, error) {
+	raw, err := json.Marshal(payment)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// replayOrReserve returns the payment created by a previous request using the same key
+// or reserves the key for the current request when it was never used
+// The token of the reservation is returned when the key is reserved
+func (s *service) replayOrReserve(ctx context.Context, key string, payment *models.Payment) (*models.Payment, uuid.UUID, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, uuid.Nil, errorhandling.InvalidRequest(invalidIdempotencyKeyCode,
+			fmt.Errorf("idempotency key must not exceed %d characters", maxIdempotencyKeyLength))
+	}
+
+	fp, err := fingerprint(payment)
+	if err != nil {
+		return nil, uuid.Nil, errorhandling.Internal(persistFailedCode, err)
+	}
+
+	now := time.Now().UTC()
+	reservation := &models.IdempotencyKey{
+		Key:         key,
+		Fingerprint: fp,
+		Token:       uuid.New(),
+		CreatedAt:   now,
+	}
+
+	stored, err := s.idempotency.GetIdempotencyKey(ctx, key)
+	switch {
+	case err == ErrNotFound:
+		return nil, reservation.Token, reserveError(key, s.idempotency.ReserveIdempotencyKey(ctx, reservation))
+	case err != nil:
+		return nil, uuid.Nil, storageError(readPaymentFailedCode, err)
+	}
+
+	if stored.Response == "" {
+		reservedBefore := now.Add(-s.reservationTTL)
+		if stored.CreatedAt.After(reservedBefore) {
+			return nil, uuid.Nil, errorhandling.Conflict(idempotencyKeyInProgressCode,
+				fmt.Errorf("a request with idempotency key %s is being processed", key))
+		}
+		// the request holding the reservation is gone without completing nor releasing it,
+		// should it still be running, it cannot complete the key any more
+		return nil, reservation.Token, reserveError(key, s.idempotency.TakeOverIdempotencyKey(ctx, reservation, reservedBefore))
+	}
+	if stored.Fingerprint != fp {
+		return nil, uuid.Nil, errorhandling.Unprocessable(idempotencyKeyReusedCode,
+			fmt.Errorf("idempotency key %s was already used with a different request", key))
+	}
+
+	replayed := &models.Payment{}
+	if err := json.Unmarshal([]byte(stored.Response), replayed); err != nil {
+		return nil, uuid.Nil, errorhandling.Internal(readPaymentFailedCode, err)
+	}
+	return replayed, uuid.Nil, nil
+}
+
+// reserveError converts the error of a reservation to an api error
+func reserveError(key string, err error) error {
+	if err == ErrDuplicateKey {
+		return errorhandling.Conflict(idempotencyKeyInProgressCode,
+			fmt.Errorf("a request with idempotency key %s is being processed", key))
+	}
+	if err != nil {
+		return storageError(persistFailedCode, err)
+	}
+	return nil
+}
+
+// release frees the key of a request that created no payment so that the client can retry
+// A key that cannot be released is taken over once its reservation expires
+func (s *service) release(ctx context.Context, key string, token uuid.UUID) {
+	if err := s.idempotency.ReleaseIdempotencyKey(ctx, key, token); err != nil {
+		s.logger.Log("msg", "could not release idempotency key", "key", key, "err", err)
+	}
+}
+
+// complete stores the created payment as the response of the reservation
+// The payment is not created when the reservation was taken over
+func complete(ctx context.Context, idempotency IdempotencyRepository, key string, token uuid.UUID, payment *models.Payment) error {
+	raw, err := json.Marshal(payment)
+	if err != nil {
+		return errorhandling.Internal(persistFailedCode, err)
+	}
+	return reserveError(key, idempotency.CompleteIdempotencyKey(ctx, key, token, string(raw)))
+}
@@ -0,0 +1,236 @@
+// +build !integration
+
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+
+	kitlog "github.com/go-kit/kit/log"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newCreatePaymentRequest() *models.Payment {
+	return &models.Payment{
+		Type:           models.PaymentType,
+		OrganisationID: testOrganisationID,
+		Attribute: &models.Attribute{
+			Amount:         models.MustParseDecimal("100.21"),
+			Currency:       "GBP",
+			ProcessingDate: "2017-01-18",
+		},
+	}
+}
+
+// newUnitOfWork runs the units of work against the given mocks
+// The audit entries are accepted unless a test checks them
+func newUnitOfWork(r *MockPaymentRepository, i *MockIdempotencyRepository) *MockUnitOfWork {
+	return newAuditedUnitOfWork(r, i, newAuditRepository())
+}
+
+func newAuditedUnitOfWork(r *MockPaymentRepository, i *MockIdempotencyRepository, a *MockAuditRepository) *MockUnitOfWork {
+	u := &MockUnitOfWork{}
+	u.On("Do", mock.Anything, mock.Anything).Return(func(ctx context.Context, fn func(Repositories) error) error {
+		return fn(Repositories{Payments: r, Idempotency: i, Audit: a})
+	})
+	return u
+}
+
+// newAuditRepository accepts every audit entry
+func newAuditRepository() *MockAuditRepository {
+	a := &MockAuditRepository{}
+	a.On("AppendAuditEntry", mock.Anything, mock.Anything).Return(nil)
+	return a
+}
+
+func Test_service_CreatePayment_Idempotency(t *testing.T) {
+	const key = "3d0f6b1c"
+	ctx := context.WithValue(callerContext(), ContextKeyIdempotencyKey, key)
+
+	fp, _ := fingerprint(newCreatePaymentRequest())
+	previous := newCreatePaymentRequest()
+	previous.ID = uuid.New()
+	response, _ := json.Marshal(previous)
+
+	tests := []struct {
+		name       string
+		wantID     uuid.UUID
+		wantErr    bool
+		wantStatus int
+		mockCalls  func(r *MockPaymentRepository, i *MockIdempotencyRepository)
+	}{
+		{
+			name: "first request creates the payment and stores the response",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(nil, ErrNotFound)
+				i.On("ReserveIdempotencyKey", mock.Anything, mock.MatchedBy(func(k *models.IdempotencyKey) bool {
+					return k.Key == key && k.Fingerprint == fp
+				})).Return(nil)
+				r.On("InsertPayment", mock.Anything, mock.Anything).Return(nil)
+				i.On("CompleteIdempotencyKey", mock.Anything, key, mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:   "retry replays the stored payment",
+			wantID: previous.ID,
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(&models.IdempotencyKey{
+					Key:         key,
+					Fingerprint: fp,
+					Response:    string(response),
+				}, nil)
+			},
+		},
+		{
+			name: "key reused with a different body",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(&models.IdempotencyKey{
+					Key:         key,
+					Fingerprint: "another fingerprint",
+					Response:    string(response),
+				}, nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "first request still being processed",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(&models.IdempotencyKey{
+					Key:         key,
+					Fingerprint: fp,
+					CreatedAt:   time.Now().UTC(),
+				}, nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "expired reservation is taken over",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(&models.IdempotencyKey{
+					Key:         key,
+					Fingerprint: "another fingerprint",
+					CreatedAt:   time.Now().UTC().Add(-time.Hour),
+				}, nil)
+				i.On("TakeOverIdempotencyKey", mock.Anything, mock.MatchedBy(func(k *models.IdempotencyKey) bool {
+					return k.Key == key && k.Fingerprint == fp
+				}), mock.AnythingOfType("time.Time")).Return(nil)
+				r.On("InsertPayment", mock.Anything, mock.Anything).Return(nil)
+				i.On("CompleteIdempotencyKey", mock.Anything, key, mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name: "expired reservation taken over by a concurrent request",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(&models.IdempotencyKey{
+					Key:         key,
+					Fingerprint: fp,
+					CreatedAt:   time.Now().UTC().Add(-time.Hour),
+				}, nil)
+				i.On("TakeOverIdempotencyKey", mock.Anything, mock.Anything, mock.Anything).Return(ErrDuplicateKey)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "concurrent request reserved the key first",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(nil, ErrNotFound)
+				i.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(ErrDuplicateKey)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "key released when the payment is not created",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(nil, ErrNotFound)
+				i.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(nil)
+				r.On("InsertPayment", mock.Anything, mock.Anything).Return(errors.New("failed"))
+				i.On("ReleaseIdempotencyKey", mock.Anything, key, mock.Anything).Return(nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "payment error returned when the key cannot be released",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(nil, ErrNotFound)
+				i.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(nil)
+				r.On("InsertPayment", mock.Anything, mock.Anything).Return(errors.New("failed"))
+				i.On("ReleaseIdempotencyKey", mock.Anything, key, mock.Anything).Return(errors.New("failed"))
+			},
+			wantErr:    true,
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "reservation taken over while the payment is created",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				var token uuid.UUID
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(nil, ErrNotFound)
+				i.On("ReserveIdempotencyKey", mock.Anything, mock.MatchedBy(func(k *models.IdempotencyKey) bool {
+					token = k.Token
+					return k.Token != uuid.Nil
+				})).Return(nil)
+				r.On("InsertPayment", mock.Anything, mock.Anything).Return(nil)
+				tokenOfReservation := mock.MatchedBy(func(t uuid.UUID) bool { return t == token })
+				i.On("CompleteIdempotencyKey", mock.Anything, key, tokenOfReservation, mock.Anything).Return(ErrDuplicateKey)
+				i.On("ReleaseIdempotencyKey", mock.Anything, key, tokenOfReservation).Return(nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "key released when the response is not stored",
+			mockCalls: func(r *MockPaymentRepository, i *MockIdempotencyRepository) {
+				i.On("GetIdempotencyKey", mock.Anything, key).Return(nil, ErrNotFound)
+				i.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(nil)
+				r.On("InsertPayment", mock.Anything, mock.Anything).Return(nil)
+				i.On("CompleteIdempotencyKey", mock.Anything, key, mock.Anything, mock.Anything).Return(errors.New("failed"))
+				i.On("ReleaseIdempotencyKey", mock.Anything, key, mock.Anything).Return(nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			mockIdempotency := &MockIdempotencyRepository{}
+			tt.mockCalls(mockRepo, mockIdempotency)
+			s := &service{
+				repository:     mockRepo,
+				idempotency:    mockIdempotency,
+				unitOfWork:     newUnitOfWork(mockRepo, mockIdempotency),
+				reservationTTL: defaultReservationTTL,
+				logger:         kitlog.NewNopLogger(),
+			}
+
+			// Act
+			got, err := s.CreatePayment(ctx, newCreatePaymentRequest())
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.CreatePayment() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+			} else if tt.wantID != uuid.Nil {
+				assert.Equal(t, tt.wantID, got.ID)
+			}
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo, mockIdempotency))
+		})
+	}
+}
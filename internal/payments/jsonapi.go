@@ -0,0 +1,101 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/jsonapi"
+	"github.com/cedric-parisi/payment-api/pkg/utils"
+)
+
+// encodeResponse encodes the payments as JSON:API documents when the client accepts them
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if list, ok := response.(*utils.FilteredList); ok {
+		response = paymentList{list}
+	}
+	return jsonapi.EncodeResponse(ctx, w, response)
+}
+
+// Document represents the created payment as a JSON:API document
+func (c CreatePaymentResponse) Document() jsonapi.Document {
+	return paymentDocument(&c.Payment)
+}
+
+// Document represents the payment as a JSON:API document
+func (g GetPaymentResponse) Document() jsonapi.Document {
+	return paymentDocument(&g.Payment)
+}
+
+func paymentDocument(p *models.Payment) jsonapi.Document {
+	resource := paymentResource(p)
+	return jsonapi.Document{
+		Data:  resource,
+		Links: resource.Links,
+	}
+}
+
+// paymentList represents a page of payments as a JSON:API document
+// The pagination links are in the body as well as in the Link header
+type paymentList struct {
+	*utils.FilteredList
+}
+
+// Document represents the page as a JSON:API document
+// The total count is only known in offset mode
+func (l paymentList) Document() jsonapi.Document {
+	payments, _ := l.Results.([]*models.Payment)
+	resources := make([]*jsonapi.Resource, 0, len(payments))
+	for _, p := range payments {
+		resources = append(resources, paymentResource(p))
+	}
+
+	links := map[string]string{"self": l.Self()}
+	for _, link := range l.Links() {
+		links[link.Rel] = link.URL
+	}
+	doc := jsonapi.Document{
+		Data:  resources,
+		Links: links,
+	}
+	if l.Filter.Cursor == nil {
+		doc.Meta = map[string]interface{}{"total_count": l.TotalCount}
+	}
+	return doc
+}
+
+// paymentResource represents a payment as a JSON:API resource
+// As in mock.json, the type of the payment is the type of the resource
+// The fields of the payment attribute are flattened with the status, organisation
+// and dates of the payment, the ids of the attribute are left out as
+// JSON:API reserves the id member. The version is in meta
+func paymentResource(p *models.Payment) *jsonapi.Resource {
+	attributes := map[string]interface{}{}
+	if p.Attribute != nil {
+		var fields map[string]json.RawMessage
+		raw, _ := json.Marshal(p.Attribute)
+		json.Unmarshal(raw, &fields)
+		delete(fields, "id")
+		delete(fields, "payment_id")
+		for k, v := range fields {
+			attributes[k] = v
+		}
+	}
+	attributes["status"] = p.Status
+	attributes["organisation_id"] = p.OrganisationID
+	attributes["created_at"] = p.CreatedAt
+	attributes["updated_at"] = p.UpdatedAt
+	if p.DeletedAt != nil {
+		attributes["deleted_at"] = p.DeletedAt
+	}
+
+	return &jsonapi.Resource{
+		Type:       string(p.Type),
+		ID:         p.ID.String(),
+		Attributes: attributes,
+		Links:      map[string]string{"self": fmt.Sprintf("/%s/%s", resourceName, p.ID)},
+		Meta:       map[string]interface{}{"version": p.Version},
+	}
+}
@@ -0,0 +1,147 @@
+// +build !integration
+
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/jsonapi"
+	"github.com/cedric-parisi/payment-api/pkg/utils"
+)
+
+func newJSONAPIContext() context.Context {
+	r := httptest.NewRequest(http.MethodGet, "/payments/", nil)
+	r.Header.Set("Accept", jsonapi.MediaType)
+	return jsonapi.HTTPToContext(context.Background(), r)
+}
+
+func Test_encodeResponse_Payment(t *testing.T) {
+	// Arrange
+	pID := uuid.MustParse("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43")
+	orgID := uuid.MustParse("743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb")
+	res := GetPaymentResponse{Payment: models.Payment{
+		ID:             pID,
+		Type:           models.PaymentType,
+		Status:         models.StatusPending,
+		Version:        2,
+		OrganisationID: orgID,
+		CreatedAt:      time.Date(2019, 1, 18, 0, 0, 0, 0, time.UTC),
+		Attribute: &models.Attribute{
+			ID:        uuid.New(),
+			PaymentID: pID,
+			Amount:    models.MustParseDecimal("100.21"),
+			Currency:  "GBP",
+		},
+	}}
+	w := httptest.NewRecorder()
+
+	// Act
+	err := encodeResponse(newJSONAPIContext(), w, res)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, jsonapi.MediaType, w.Header().Get("Content-Type"))
+	assert.Equal(t, `"2"`, w.Header().Get("Etag"))
+
+	var doc struct {
+		Data struct {
+			Type       string                 `json:"type"`
+			ID         string                 `json:"id"`
+			Attributes map[string]interface{} `json:"attributes"`
+			Links      map[string]string      `json:"links"`
+			Meta       map[string]interface{} `json:"meta"`
+		} `json:"data"`
+		Links map[string]string `json:"links"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "Payment", doc.Data.Type)
+	assert.Equal(t, pID.String(), doc.Data.ID)
+	assert.Equal(t, "100.21", doc.Data.Attributes["amount"])
+	assert.Equal(t, "pending", doc.Data.Attributes["status"])
+	assert.Equal(t, orgID.String(), doc.Data.Attributes["organisation_id"])
+	assert.NotContains(t, doc.Data.Attributes, "id")
+	assert.NotContains(t, doc.Data.Attributes, "payment_id")
+	assert.Equal(t, float64(2), doc.Data.Meta["version"])
+	assert.Equal(t, "/payments/"+pID.String(), doc.Data.Links["self"])
+	assert.Equal(t, "/payments/"+pID.String(), doc.Links["self"])
+}
+
+func Test_encodeResponse_FilteredList(t *testing.T) {
+	tests := []struct {
+		name      string
+		list      *utils.FilteredList
+		wantLinks []string
+		wantMeta  bool
+	}{
+		{
+			name: "offset page",
+			list: &utils.FilteredList{
+				Filter:     utils.Filter{Limit: 1, Offset: 0},
+				Resource:   resourceName,
+				Results:    []*models.Payment{{ID: uuid.New(), Type: models.PaymentType}},
+				TotalCount: 3,
+			},
+			wantLinks: []string{"self", "first", "prev", "next", "last"},
+			wantMeta:  true,
+		},
+		{
+			name: "cursor page",
+			list: &utils.FilteredList{
+				Filter:   utils.Filter{Limit: 1, Cursor: &utils.Cursor{}},
+				Resource: resourceName,
+				Results:  []*models.Payment{{ID: uuid.New(), Type: models.PaymentType}},
+				Next:     &utils.Cursor{ID: uuid.New().String()},
+			},
+			wantLinks: []string{"self", "first", "next"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			err := encodeResponse(newJSONAPIContext(), w, tt.list)
+
+			assert.NoError(t, err)
+			var doc struct {
+				Data  []map[string]interface{} `json:"data"`
+				Links map[string]string        `json:"links"`
+				Meta  map[string]interface{}   `json:"meta"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+			assert.Len(t, doc.Data, 1)
+			assert.Len(t, doc.Links, len(tt.wantLinks))
+			for _, rel := range tt.wantLinks {
+				assert.Contains(t, doc.Links, rel)
+			}
+			if tt.wantMeta {
+				assert.Equal(t, float64(3), doc.Meta["total_count"])
+			} else {
+				assert.Nil(t, doc.Meta)
+			}
+			assert.NotEmpty(t, w.Header()["Link"])
+		})
+	}
+}
+
+func Test_encodeResponse_PlainJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	err := encodeResponse(context.Background(), w, &utils.FilteredList{
+		Filter:   utils.Filter{Limit: 10},
+		Resource: resourceName,
+		Results:  []*models.Payment{},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"results":[]`)
+}
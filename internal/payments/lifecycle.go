@@ -0,0 +1,73 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+)
+
+const (
+	invalidTransitionCode = "invalid_status_transition"
+)
+
+// transitions lists, for each status, the statuses a payment can move to
+// Settled, rejected and cancelled payments are final
+var transitions = map[models.Status][]models.Status{
+	models.StatusPending:   {models.StatusSubmitted, models.StatusCancelled},
+	models.StatusSubmitted: {models.StatusAccepted, models.StatusRejected, models.StatusCancelled},
+	models.StatusAccepted:  {models.StatusSettled, models.StatusRejected},
+}
+
+// canTransition reports whether a payment can move from one status to another
+func canTransition(from, to models.Status) bool {
+	// payments stored before the lifecycle existed have no status
+	if from == "" {
+		from = models.StatusPending
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionPayment moves the payment to the requested status
+// if the transition is allowed from its current status
+func (s *service) TransitionPayment(ctx context.Context, id string, status models.Status) (*models.Payment, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errorhandling.InvalidRequest(invalidPaymentCode, err)
+	}
+
+	payment, err := s.GetPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canTransition(payment.Status, status) {
+		return nil, errorhandling.Conflict(invalidTransitionCode,
+			fmt.Errorf("payment %s cannot move from %s to %s", id, payment.Status, status))
+	}
+
+	before := snapshot(payment)
+	err = s.mutate(ctx, func(r Repositories) error {
+		if err := r.Payments.UpdatePaymentStatus(ctx, payment, status); err != nil {
+			switch err {
+			case ErrNotFound:
+				return errorhandling.NotFound(invalidPaymentCode, fmt.Errorf("could not find %s", id))
+			case ErrVersionConflict:
+				return errorhandling.Conflict(staleVersionCode, fmt.Errorf("payment %s was modified concurrently", id))
+			}
+			return storageError(persistFailedCode, err)
+		}
+		return record(ctx, r, models.AuditTransition, payment, before, snapshot(payment))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
@@ -0,0 +1,180 @@
+// +build !integration
+
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_canTransition(t *testing.T) {
+	tests := []struct {
+		name string
+		from models.Status
+		to   models.Status
+		want bool
+	}{
+		{
+			name: "pending to submitted allowed",
+			from: models.StatusPending,
+			to:   models.StatusSubmitted,
+			want: true,
+		},
+		{
+			name: "payment without status can be submitted",
+			from: "",
+			to:   models.StatusSubmitted,
+			want: true,
+		},
+		{
+			name: "accepted to settled allowed",
+			from: models.StatusAccepted,
+			to:   models.StatusSettled,
+			want: true,
+		},
+		{
+			name: "pending to settled refused",
+			from: models.StatusPending,
+			to:   models.StatusSettled,
+		},
+		{
+			name: "settled is final",
+			from: models.StatusSettled,
+			to:   models.StatusCancelled,
+		},
+		{
+			name: "accepted cannot be cancelled",
+			from: models.StatusAccepted,
+			to:   models.StatusCancelled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, canTransition(tt.from, tt.to))
+		})
+	}
+}
+
+func Test_service_TransitionPayment(t *testing.T) {
+	pID := uuid.New()
+	type args struct {
+		ctx    context.Context
+		id     string
+		status models.Status
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantErr    bool
+		wantStatus int
+		mockCalls  func(m *MockPaymentRepository)
+	}{
+		{
+			name: "submit payment success",
+			args: args{
+				ctx:    callerContext(),
+				id:     pID.String(),
+				status: models.StatusSubmitted,
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(&models.Payment{
+					ID:     pID,
+					Status: models.StatusPending,
+				}, nil)
+				m.On("UpdatePaymentStatus", mock.Anything, mock.Anything, models.StatusSubmitted).Return(nil)
+			},
+		},
+		{
+			name: "transition failed due to invalid id",
+			args: args{
+				ctx:    callerContext(),
+				id:     "invalid id",
+				status: models.StatusSubmitted,
+			},
+			mockCalls:  func(m *MockPaymentRepository) {},
+			wantErr:    true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "transition failed due to payment not found",
+			args: args{
+				ctx:    callerContext(),
+				id:     pID.String(),
+				status: models.StatusSubmitted,
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(nil, ErrNotFound)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "transition failed due to forbidden transition",
+			args: args{
+				ctx:    callerContext(),
+				id:     pID.String(),
+				status: models.StatusCancelled,
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(&models.Payment{
+					ID:     pID,
+					Status: models.StatusSettled,
+				}, nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "transition failed due to repository error",
+			args: args{
+				ctx:    callerContext(),
+				id:     pID.String(),
+				status: models.StatusSubmitted,
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(&models.Payment{
+					ID:     pID,
+					Status: models.StatusPending,
+				}, nil)
+				m.On("UpdatePaymentStatus", mock.Anything, mock.Anything, models.StatusSubmitted).Return(errors.New("failed"))
+			},
+			wantErr:    true,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			s := &service{
+				repository: mockRepo,
+				unitOfWork: newUnitOfWork(mockRepo, nil),
+			}
+
+			// Act
+			got, err := s.TransitionPayment(tt.args.ctx, tt.args.id, tt.args.status)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.TransitionPayment() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+			} else {
+				assert.NotNil(t, got)
+			}
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
@@ -7,6 +7,7 @@ package payments
 import context "context"
 import mock "github.com/stretchr/testify/mock"
 import models "github.com/cedric-parisi/payment-api/internal/models"
+import time "time"
 import utils "github.com/cedric-parisi/payment-api/pkg/utils"
 
 // MockPaymentRepository is an autogenerated mock type for the PaymentRepository type
@@ -14,13 +15,13 @@ type MockPaymentRepository struct {
 	mock.Mock
 }
 
-// DeletePayment provides a mock function with given fields: ctx, id
-func (_m *MockPaymentRepository) DeletePayment(ctx context.Context, id string) error {
-	ret := _m.Called(ctx, id)
+// DeletePayment provides a mock function with given fields: ctx, payment
+func (_m *MockPaymentRepository) DeletePayment(ctx context.Context, payment *models.Payment) error {
+	ret := _m.Called(ctx, payment)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Payment) error); ok {
+		r0 = rf(ctx, payment)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -28,6 +29,29 @@ func (_m *MockPaymentRepository) DeletePayment(ctx context.Context, id string) e
 	return r0
 }
 
+// GetDeletedPayment provides a mock function with given fields: ctx, id
+func (_m *MockPaymentRepository) GetDeletedPayment(ctx context.Context, id string) (*models.Payment, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *models.Payment
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.Payment); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Payment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetFilteredPayments provides a mock function with given fields: ctx, filter
 func (_m *MockPaymentRepository) GetFilteredPayments(ctx context.Context, filter *utils.Filter) ([]*models.Payment, int, error) {
 	ret := _m.Called(ctx, filter)
@@ -95,6 +119,43 @@ func (_m *MockPaymentRepository) InsertPayment(ctx context.Context, payment *mod
 	return r0
 }
 
+// PurgePayments provides a mock function with given fields: ctx, deletedBefore, limit
+func (_m *MockPaymentRepository) PurgePayments(ctx context.Context, deletedBefore time.Time, limit int) ([]*models.Payment, error) {
+	ret := _m.Called(ctx, deletedBefore, limit)
+
+	var r0 []*models.Payment
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) []*models.Payment); ok {
+		r0 = rf(ctx, deletedBefore, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*models.Payment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int) error); ok {
+		r1 = rf(ctx, deletedBefore, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestorePayment provides a mock function with given fields: ctx, payment
+func (_m *MockPaymentRepository) RestorePayment(ctx context.Context, payment *models.Payment) error {
+	ret := _m.Called(ctx, payment)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Payment) error); ok {
+		r0 = rf(ctx, payment)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpdatePayment provides a mock function with given fields: ctx, payment
 func (_m *MockPaymentRepository) UpdatePayment(ctx context.Context, payment *models.Payment) error {
 	ret := _m.Called(ctx, payment)
@@ -108,3 +169,17 @@ func (_m *MockPaymentRepository) UpdatePayment(ctx context.Context, payment *mod
 
 	return r0
 }
+
+// UpdatePaymentStatus provides a mock function with given fields: ctx, payment, status
+func (_m *MockPaymentRepository) UpdatePaymentStatus(ctx context.Context, payment *models.Payment, status models.Status) error {
+	ret := _m.Called(ctx, payment, status)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Payment, models.Status) error); ok {
+		r0 = rf(ctx, payment, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -37,6 +37,29 @@ func (_m *MockService) CreatePayment(ctx context.Context, payment *models.Paymen
 	return r0, r1
 }
 
+// CreatePayments provides a mock function with given fields: ctx, payments, mode
+func (_m *MockService) CreatePayments(ctx context.Context, payments []*models.Payment, mode BatchMode) ([]BatchResult, error) {
+	ret := _m.Called(ctx, payments, mode)
+
+	var r0 []BatchResult
+	if rf, ok := ret.Get(0).(func(context.Context, []*models.Payment, BatchMode) []BatchResult); ok {
+		r0 = rf(ctx, payments, mode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]BatchResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []*models.Payment, BatchMode) error); ok {
+		r1 = rf(ctx, payments, mode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeletePayment provides a mock function with given fields: ctx, id
 func (_m *MockService) DeletePayment(ctx context.Context, id string) error {
 	ret := _m.Called(ctx, id)
@@ -51,6 +74,20 @@ func (_m *MockService) DeletePayment(ctx context.Context, id string) error {
 	return r0
 }
 
+// ExportPayments provides a mock function with given fields: ctx, filter, fn
+func (_m *MockService) ExportPayments(ctx context.Context, filter *utils.Filter, fn func(*models.Payment) error) error {
+	ret := _m.Called(ctx, filter, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *utils.Filter, func(*models.Payment) error) error); ok {
+		r0 = rf(ctx, filter, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetFilteredPayments provides a mock function with given fields: ctx, filter
 func (_m *MockService) GetFilteredPayments(ctx context.Context, filter *utils.Filter) (*utils.FilteredList, error) {
 	ret := _m.Called(ctx, filter)
@@ -97,6 +134,119 @@ func (_m *MockService) GetPayment(ctx context.Context, id string) (*models.Payme
 	return r0, r1
 }
 
+// GetPaymentHistory provides a mock function with given fields: ctx, id
+func (_m *MockService) GetPaymentHistory(ctx context.Context, id string) ([]*models.AuditEntry, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 []*models.AuditEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string) []*models.AuditEntry); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*models.AuditEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PatchPayment provides a mock function with given fields: ctx, id, patch
+func (_m *MockService) PatchPayment(ctx context.Context, id string, patch Patch) (*models.Payment, error) {
+	ret := _m.Called(ctx, id, patch)
+
+	var r0 *models.Payment
+	if rf, ok := ret.Get(0).(func(context.Context, string, Patch) *models.Payment); ok {
+		r0 = rf(ctx, id, patch)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Payment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, Patch) error); ok {
+		r1 = rf(ctx, id, patch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgePayments provides a mock function with given fields: ctx
+func (_m *MockService) PurgePayments(ctx context.Context) (int, error) {
+	ret := _m.Called(ctx)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context) int); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestorePayment provides a mock function with given fields: ctx, id
+func (_m *MockService) RestorePayment(ctx context.Context, id string) (*models.Payment, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *models.Payment
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.Payment); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Payment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TransitionPayment provides a mock function with given fields: ctx, id, status
+func (_m *MockService) TransitionPayment(ctx context.Context, id string, status models.Status) (*models.Payment, error) {
+	ret := _m.Called(ctx, id, status)
+
+	var r0 *models.Payment
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.Status) *models.Payment); ok {
+		r0 = rf(ctx, id, status)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Payment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.Status) error); ok {
+		r1 = rf(ctx, id, status)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdatePayment provides a mock function with given fields: ctx, payment
 func (_m *MockService) UpdatePayment(ctx context.Context, payment *models.Payment) error {
 	ret := _m.Called(ctx, payment)
@@ -110,3 +260,26 @@ func (_m *MockService) UpdatePayment(ctx context.Context, payment *models.Paymen
 
 	return r0
 }
+
+// UpdatePayments provides a mock function with given fields: ctx, payments, mode
+func (_m *MockService) UpdatePayments(ctx context.Context, payments []*models.Payment, mode BatchMode) ([]BatchResult, error) {
+	ret := _m.Called(ctx, payments, mode)
+
+	var r0 []BatchResult
+	if rf, ok := ret.Get(0).(func(context.Context, []*models.Payment, BatchMode) []BatchResult); ok {
+		r0 = rf(ctx, payments, mode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]BatchResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []*models.Payment, BatchMode) error); ok {
+		r1 = rf(ctx, payments, mode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,67 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+)
+
+const (
+	forbiddenCode           = "forbidden"
+	foreignOrganisationCode = "foreign_organisation"
+)
+
+var (
+	// ErrNoOrganisation is raised by the repositories for a context without organisation
+	ErrNoOrganisation = errors.New("no organisation in context")
+)
+
+// WithOrganisation returns a context scoping the repositories to the organisation
+func WithOrganisation(ctx context.Context, organisationID uuid.UUID) context.Context {
+	return context.WithValue(ctx, ContextKeyOrganisation, organisationID)
+}
+
+// OrganisationFromContext returns the organisation set by WithOrganisation
+func OrganisationFromContext(ctx context.Context) (uuid.UUID, bool) {
+	organisationID, ok := ctx.Value(ContextKeyOrganisation).(uuid.UUID)
+	return organisationID, ok && organisationID != uuid.Nil
+}
+
+// OrganisationMiddleware scopes the request to the organisation of its token
+// It runs after the JWT middleware, tokens without organisation are refused
+func OrganisationMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(*auth.Claims)
+			if !ok {
+				return nil, errorhandling.Forbidden(forbiddenCode, errors.New("the token is not bound to an organisation"))
+			}
+			organisationID, err := uuid.Parse(claims.OrganisationID)
+			if err != nil || organisationID == uuid.Nil {
+				return nil, errorhandling.Forbidden(forbiddenCode, errors.New("the token is not bound to an organisation"))
+			}
+			return next(WithOrganisation(ctx, organisationID), request)
+		}
+	}
+}
+
+// checkOrganisation refuses to save a payment of another organisation than the caller's one
+func checkOrganisation(ctx context.Context, payment *models.Payment) error {
+	organisationID, ok := OrganisationFromContext(ctx)
+	if !ok {
+		return errorhandling.Forbidden(forbiddenCode, ErrNoOrganisation)
+	}
+	if payment.OrganisationID != organisationID {
+		return errorhandling.Forbidden(foreignOrganisationCode,
+			fmt.Errorf("payments of organisation %s cannot be saved by organisation %s", payment.OrganisationID, organisationID))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// +build !integration
+
+package payments
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+)
+
+// testOrganisationID is the organisation of the caller in the tests
+var testOrganisationID = uuid.MustParse("743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb")
+
+// callerContext is the context of a request of testOrganisationID
+func callerContext() context.Context {
+	return WithOrganisation(context.Background(), testOrganisationID)
+}
+
+func TestOrganisationMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     jwt.Claims
+		want       uuid.UUID
+		wantStatus int
+	}{
+		{
+			name:   "token bound to an organisation",
+			claims: &auth.Claims{OrganisationID: testOrganisationID.String()},
+			want:   testOrganisationID,
+		},
+		{
+			name:       "token without organisation",
+			claims:     &auth.Claims{},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "token with an invalid organisation",
+			claims:     &auth.Claims{OrganisationID: "1234"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "standard claims",
+			claims:     &jwt.StandardClaims{Subject: "cedric"},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var got uuid.UUID
+			next := func(ctx context.Context, request interface{}) (interface{}, error) {
+				got, _ = OrganisationFromContext(ctx)
+				return nil, nil
+			}
+			ctx := context.WithValue(context.Background(), kitjwt.JWTClaimsContextKey, tt.claims)
+
+			// Act
+			_, err := OrganisationMiddleware()(next)(ctx, nil)
+
+			// Assert
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_checkOrganisation(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		payment *models.Payment
+		wantErr bool
+	}{
+		{
+			name:    "payment of the caller",
+			ctx:     callerContext(),
+			payment: &models.Payment{OrganisationID: testOrganisationID},
+		},
+		{
+			name:    "payment of another organisation",
+			ctx:     callerContext(),
+			payment: &models.Payment{OrganisationID: uuid.New()},
+			wantErr: true,
+		},
+		{
+			name:    "caller without organisation",
+			ctx:     context.Background(),
+			payment: &models.Payment{OrganisationID: testOrganisationID},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOrganisation(tt.ctx, tt.payment)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusForbidden, err.(kithttp.StatusCoder).StatusCode())
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package payments
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/utils"
+)
+
+// sortKeys reads the value of every sort field from a payment
+// The values are compared by the repository against the columns of the SortFields
+// A nil value stands for the NULL column of a missing related row
+var sortKeys = map[string]func(p *models.Payment) *string{
+	"created_at":      paymentKey(func(p *models.Payment) string { return p.CreatedAt.Format(time.RFC3339Nano) }),
+	"updated_at":      paymentKey(updatedAtKey),
+	"version":         paymentKey(func(p *models.Payment) string { return strconv.Itoa(p.Version) }),
+	"type":            paymentKey(func(p *models.Payment) string { return string(p.Type) }),
+	"status":          paymentKey(func(p *models.Payment) string { return string(p.Status) }),
+	"organisation_id": paymentKey(func(p *models.Payment) string { return p.OrganisationID.String() }),
+	"amount":          attributeDecimalKey(func(a *models.Attribute) models.Decimal { return a.Amount }),
+	"currency":        attributeKey(func(a *models.Attribute) string { return a.Currency }),
+	"processing_date": attributeKey(func(a *models.Attribute) string { return a.ProcessingDate }),
+	"payment_scheme":  attributeKey(func(a *models.Attribute) string { return a.PaymentScheme }),
+}
+
+// updatedAtKey falls back on the creation date of payments never updated
+// as the repository does, keyset comparisons cannot handle NULL values
+func updatedAtKey(p *models.Payment) string {
+	if p.UpdatedAt == nil {
+		return p.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return p.UpdatedAt.Format(time.RFC3339Nano)
+}
+
+func paymentKey(value func(p *models.Payment) string) func(p *models.Payment) *string {
+	return func(p *models.Payment) *string {
+		return utils.CursorValue(value(p))
+	}
+}
+
+// attributeKey is NULL for a payment without attributes row, as its left joined columns are
+// The repository loads such a payment with an empty attribute that has no id
+func attributeKey(value func(a *models.Attribute) string) func(p *models.Payment) *string {
+	return func(p *models.Payment) *string {
+		if p.Attribute == nil || p.Attribute.ID == uuid.Nil {
+			return nil
+		}
+		return utils.CursorValue(value(p.Attribute))
+	}
+}
+
+// attributeDecimalKey is NULL as well for an unset decimal, which is stored as NULL
+func attributeDecimalKey(value func(a *models.Attribute) models.Decimal) func(p *models.Payment) *string {
+	key := attributeKey(func(a *models.Attribute) string { return value(a).String() })
+	return func(p *models.Payment) *string {
+		if p.Attribute != nil && !value(p.Attribute).IsSet() {
+			return nil
+		}
+		return key(p)
+	}
+}
+
+// nextCursor returns the position after the last payment of a full page in cursor mode
+// A page shorter than the limit is the last one
+func nextCursor(filters *utils.Filter, payments []*models.Payment) *utils.Cursor {
+	if filters.Cursor == nil || len(payments) == 0 || len(payments) < filters.Limit {
+		return nil
+	}
+
+	last := payments[len(payments)-1]
+	values := make([]*string, 0, len(filters.Sorting))
+	for _, s := range filters.Sorting {
+		values = append(values, sortKeys[s.Field](last))
+	}
+	return &utils.Cursor{
+		Values: values,
+		ID:     last.ID.String(),
+	}
+}
@@ -0,0 +1,75 @@
+// +build !integration
+
+package payments
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/utils"
+)
+
+func Test_sortKeys(t *testing.T) {
+	for _, field := range SortFields {
+		if _, ok := sortKeys[field]; !ok {
+			t.Errorf("sortKeys misses the sort field %s", field)
+		}
+	}
+}
+
+func Test_nextCursor_NullKey(t *testing.T) {
+	pID := uuid.New()
+	tests := []struct {
+		name      string
+		attribute *models.Attribute
+		want      []*string
+	}{
+		{
+			// the repository attaches an empty attribute to a payment without attributes row
+			name: "payment without attributes row",
+			attribute: &models.Attribute{
+				BeneficiaryParty: &models.BeneficiaryParty{},
+				ChargesInformation: &models.ChargesInformation{
+					SenderCharges: []*models.SenderCharge{},
+				},
+				DebtorParty:  &models.DebtorParty{},
+				Fx:           &models.Fx{},
+				SponsorParty: &models.SponsorParty{},
+			},
+			want: []*string{nil, nil, utils.CursorValue("")},
+		},
+		{
+			name:      "attributes row without amount",
+			attribute: &models.Attribute{ID: uuid.New(), PaymentID: pID, Currency: "GBP"},
+			want:      []*string{nil, utils.CursorValue("GBP"), utils.CursorValue("")},
+		},
+		{
+			name:      "attributes row with amount",
+			attribute: &models.Attribute{ID: uuid.New(), PaymentID: pID, Amount: models.MustParseDecimal("10.00"), Currency: "GBP"},
+			want:      []*string{utils.CursorValue("10.00"), utils.CursorValue("GBP"), utils.CursorValue("")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			last := &models.Payment{ID: pID, Attribute: tt.attribute}
+			filters := &utils.Filter{
+				Limit:   1,
+				Sorting: []utils.Sort{{Field: "amount"}, {Field: "currency"}, {Field: "type"}},
+				Cursor:  &utils.Cursor{},
+			}
+
+			// Act
+			got := nextCursor(filters, []*models.Payment{last})
+
+			// Assert
+			if assert.NotNil(t, got) {
+				assert.Equal(t, tt.want, got.Values)
+				assert.Equal(t, pID.String(), got.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+	"github.com/cedric-parisi/payment-api/pkg/patch"
+)
+
+const (
+	invalidPatchCode     = "invalid_patch"
+	failedPatchTestCode  = "patch_test_failed"
+	unsupportedPatchCode = "unsupported_patch_media_type"
+)
+
+// Patch is a set of changes to apply to a stored payment
+type Patch struct {
+	// MediaType is either patch.MergePatchMediaType or patch.JSONPatchMediaType
+	MediaType string
+	// Body is the merge patch document or the list of operations
+	Body []byte
+	// Version is the version the patch was written against, from the If-Match header
+	// The stored version is patched when nil
+	Version *int
+}
+
+// PatchPayment applies the patch to the JSON representation of the stored payment
+// then validates and saves the result as UpdatePayment does
+// The id, status and version of the payment cannot be patched
+func (s *service) PatchPayment(ctx context.Context, id string, p Patch) (*models.Payment, error) {
+	if p.MediaType != patch.MergePatchMediaType && p.MediaType != patch.JSONPatchMediaType {
+		return nil, errorhandling.UnsupportedMediaType(unsupportedPatchCode,
+			fmt.Errorf("patch must be %s or %s", patch.MergePatchMediaType, patch.JSONPatchMediaType))
+	}
+
+	stored, err := s.GetPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Version != nil && *p.Version != stored.Version {
+		return nil, errorhandling.Conflict(staleVersionCode, fmt.Errorf("version %d of %s is not the latest one", *p.Version, id))
+	}
+
+	doc, err := json.Marshal(stored)
+	if err != nil {
+		return nil, errorhandling.Internal(readPaymentFailedCode, err)
+	}
+	patched, err := patch.Apply(p.MediaType, doc, p.Body)
+	if err != nil {
+		if errors.Is(err, patch.ErrTestFailed) {
+			return nil, errorhandling.Conflict(failedPatchTestCode, err)
+		}
+		return nil, errorhandling.InvalidRequest(invalidPatchCode, err)
+	}
+
+	payment := &models.Payment{}
+	if err := json.Unmarshal(patched, payment); err != nil {
+		return nil, errorhandling.InvalidRequest(invalidPatchCode, fmt.Errorf("patched payment is invalid: %s", err))
+	}
+	if err := readOnlyFields(stored, payment); err != nil {
+		return nil, invalidPayment(err)
+	}
+
+	if err := s.updatePayment(ctx, payment, models.AuditPatch); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// readOnlyFields lists the fields a patch changed although only the service sets them
+// The status only changes through the transition endpoints
+func readOnlyFields(stored, patched *models.Payment) error {
+	var errs models.ValidationErrors
+	if patched.ID != stored.ID {
+		errs = append(errs, models.FieldError{Field: "id", Message: "is read-only"})
+	}
+	if patched.Status != stored.Status {
+		errs = append(errs, models.FieldError{Field: "status", Message: "is read-only, use the transition endpoints"})
+	}
+	if patched.Version != stored.Version {
+		errs = append(errs, models.FieldError{Field: "version", Message: "is read-only, use the If-Match header"})
+	}
+	if stored.Attribute != nil && patched.Attribute != nil && stored.Attribute.ID != uuid.Nil &&
+		patched.Attribute.ID != stored.Attribute.ID {
+		errs = append(errs, models.FieldError{Field: "attributes.id", Message: "is read-only"})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
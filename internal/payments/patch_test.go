@@ -0,0 +1,220 @@
+// +build !integration
+
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_service_PatchPayment(t *testing.T) {
+	pID := uuid.New()
+	aID := uuid.New()
+	stored := func() *models.Payment {
+		return &models.Payment{
+			ID:             pID,
+			Type:           models.PaymentType,
+			Status:         models.StatusPending,
+			Version:        2,
+			OrganisationID: testOrganisationID,
+			Attribute: &models.Attribute{
+				ID:             aID,
+				PaymentID:      pID,
+				Amount:         models.MustParseDecimal("100.21"),
+				Currency:       "GBP",
+				ProcessingDate: "2017-01-18",
+				Reference:      "old",
+			},
+		}
+	}
+	staleVersion := 1
+	tests := []struct {
+		name          string
+		patch         Patch
+		wantErr       bool
+		wantStatus    int
+		wantReference string
+		wantAmount    string
+		mockCalls     func(m *MockPaymentRepository)
+	}{
+		{
+			name: "merge patch success",
+			patch: Patch{
+				MediaType: "application/merge-patch+json",
+				Body:      []byte(`{"attributes":{"reference":"new"}}`),
+			},
+			wantReference: "new",
+			wantAmount:    "100.21",
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+				m.On("UpdatePayment", mock.Anything, mock.MatchedBy(func(p *models.Payment) bool {
+					return p.Version == 2 && p.Attribute.ID == aID
+				})).Return(nil)
+			},
+		},
+		{
+			name: "json patch success",
+			patch: Patch{
+				MediaType: "application/json-patch+json",
+				Body:      []byte(`[{"op":"test","path":"/attributes/reference","value":"old"},{"op":"replace","path":"/attributes/amount","value":"50.00"}]`),
+			},
+			wantReference: "old",
+			wantAmount:    "50.00",
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:       "patch failed due to unsupported media type",
+			patch:      Patch{MediaType: "application/json", Body: []byte(`{}`)},
+			mockCalls:  func(m *MockPaymentRepository) {},
+			wantErr:    true,
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:  "patch failed due to payment not found",
+			patch: Patch{MediaType: "application/merge-patch+json", Body: []byte(`{}`)},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(nil, ErrNotFound)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "patch failed due to stale If-Match version",
+			patch: Patch{
+				MediaType: "application/merge-patch+json",
+				Body:      []byte(`{"attributes":{"reference":"new"}}`),
+				Version:   &staleVersion,
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "patch failed due to failed test operation",
+			patch: Patch{
+				MediaType: "application/json-patch+json",
+				Body:      []byte(`[{"op":"test","path":"/attributes/reference","value":"other"}]`),
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "patch failed due to malformed patch",
+			patch: Patch{
+				MediaType: "application/json-patch+json",
+				Body:      []byte(`[{"op":"remove","path":"/missing"}]`),
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "patch failed due to read-only status",
+			patch: Patch{
+				MediaType: "application/merge-patch+json",
+				Body:      []byte(`{"status":"settled"}`),
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "patch failed due to invalid patched payment",
+			patch: Patch{
+				MediaType: "application/merge-patch+json",
+				Body:      []byte(`{"attributes":{"currency":"XXX"}}`),
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "patch failed due to concurrent update",
+			patch: Patch{
+				MediaType: "application/merge-patch+json",
+				Body:      []byte(`{"attributes":{"reference":"new"}}`),
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(ErrVersionConflict)
+			},
+			wantErr:    true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "patch failed due to repository error",
+			patch: Patch{
+				MediaType: "application/merge-patch+json",
+				Body:      []byte(`{"attributes":{"reference":"new"}}`),
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, pID.String()).Return(stored(), nil)
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(errors.New("failed"))
+			},
+			wantErr:    true,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mockRepo := &MockPaymentRepository{}
+			tt.mockCalls(mockRepo)
+			s := &service{
+				repository: mockRepo,
+				unitOfWork: newUnitOfWork(mockRepo, nil),
+			}
+
+			// Act
+			got, err := s.PatchPayment(callerContext(), pID.String(), tt.patch)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.PatchPayment() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+			} else {
+				assert.Equal(t, tt.wantReference, got.Attribute.Reference)
+				assert.Equal(t, tt.wantAmount, got.Attribute.Amount.String())
+				assert.Equal(t, models.StatusPending, got.Status)
+			}
+			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
+		})
+	}
+}
+
+func Test_readOnlyFields(t *testing.T) {
+	pID := uuid.New()
+	stored := &models.Payment{ID: pID, Status: models.StatusPending, Version: 1}
+
+	assert.NoError(t, readOnlyFields(stored, &models.Payment{ID: pID, Status: models.StatusPending, Version: 1}))
+
+	err := readOnlyFields(stored, &models.Payment{ID: uuid.New(), Status: models.StatusSettled, Version: 4})
+	fields, ok := err.(models.ValidationErrors)
+	assert.True(t, ok)
+	assert.Len(t, fields, 3)
+}
@@ -2,6 +2,7 @@ package payments
 
 import (
 	"context"
+	"time"
 
 	"github.com/cedric-parisi/payment-api/internal/models"
 	"github.com/cedric-parisi/payment-api/pkg/utils"
@@ -13,5 +14,25 @@ type PaymentRepository interface {
 	UpdatePayment(ctx context.Context, payment *models.Payment) error
 	GetPayment(ctx context.Context, id string) (*models.Payment, error)
 	GetFilteredPayments(ctx context.Context, filter *utils.Filter) ([]*models.Payment, int, error)
-	DeletePayment(ctx context.Context, id string) error
+	// DeletePayment soft deletes the payment if its version matches the stored one
+	DeletePayment(ctx context.Context, payment *models.Payment) error
+	UpdatePaymentStatus(ctx context.Context, payment *models.Payment, status models.Status) error
+	GetDeletedPayment(ctx context.Context, id string) (*models.Payment, error)
+	RestorePayment(ctx context.Context, payment *models.Payment) error
+	// PurgePayments removes for good up to limit payments deleted before the given time
+	PurgePayments(ctx context.Context, deletedBefore time.Time, limit int) ([]*models.Payment, error)
+}
+
+// Repositories are the repositories bound to a unit of work
+type Repositories struct {
+	Payments    PaymentRepository
+	Idempotency IdempotencyRepository
+	Audit       AuditRepository
+}
+
+// UnitOfWork groups several repository operations in a single transaction
+type UnitOfWork interface {
+	// Do runs fn with repositories sharing one transaction
+	// The transaction is committed when fn returns nil and rolled back otherwise
+	Do(ctx context.Context, fn func(r Repositories) error) error
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	kitlog "github.com/go-kit/kit/log"
 	"github.com/google/uuid"
 
 	"github.com/cedric-parisi/payment-api/pkg/utils"
@@ -21,11 +22,54 @@ const (
 	invalidPaymentCode    = "invalid_payment"
 	persistFailedCode     = "save_payment_failed"
 	readPaymentFailedCode = "read_payment_failed"
+	staleVersionCode      = "stale_payment_version"
+	invalidFilterCode     = "invalid_filter"
+	invalidSortCode       = "invalid_sort"
+	invalidCursorCode     = "invalid_cursor"
+	queryTimeoutCode      = "storage_timeout"
+	queryCanceledCode     = "storage_unavailable"
 )
 
 var (
+	// FilterFields lists the fields payments can be filtered on
+	// The repository maps each of them to a column
+	FilterFields = map[string]utils.FieldType{
+		"type":                       utils.StringField,
+		"status":                     utils.StringField,
+		"organisation_id":            utils.UUIDField,
+		"amount":                     utils.DecimalField,
+		"currency":                   utils.StringField,
+		"processing_date":            utils.DateField,
+		"payment_scheme":             utils.StringField,
+		"payment_type":               utils.StringField,
+		"scheme_payment_type":        utils.StringField,
+		"beneficiary_account_number": utils.StringField,
+		"debtor_account_number":      utils.StringField,
+	}
+
+	// SortFields lists the fields payments can be sorted on
+	// The repository maps each of them to a column and sortKeys reads them for the cursors
+	SortFields = []string{
+		"created_at",
+		"updated_at",
+		"version",
+		"type",
+		"status",
+		"organisation_id",
+		"amount",
+		"currency",
+		"processing_date",
+		"payment_scheme",
+	}
+
 	// ErrNotFound is raised when a payment is not found in the storage
 	ErrNotFound = errors.New("not found")
+	// ErrVersionConflict is raised when the stored payment version differs from the expected one
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrTimeout is raised when a storage operation exceeds its timeout
+	ErrTimeout = errors.New("storage operation timed out")
+	// ErrCanceled is raised when a storage operation is canceled, e.g. on shutdown or client disconnection
+	ErrCanceled = errors.New("storage operation canceled")
 )
 
 // Service defines the business logic on the payment resource
@@ -33,82 +77,257 @@ type Service interface {
 	CreatePayment(ctx context.Context, payment *models.Payment) (*models.Payment, error)
 	UpdatePayment(ctx context.Context, payment *models.Payment) error
 	GetPayment(ctx context.Context, id string) (*models.Payment, error)
+	GetPaymentHistory(ctx context.Context, id string) ([]*models.AuditEntry, error)
 	GetFilteredPayments(ctx context.Context, filter *utils.Filter) (*utils.FilteredList, error)
 	DeletePayment(ctx context.Context, id string) error
+	RestorePayment(ctx context.Context, id string) (*models.Payment, error)
+	PurgePayments(ctx context.Context) (int, error)
+	TransitionPayment(ctx context.Context, id string, status models.Status) (*models.Payment, error)
+	PatchPayment(ctx context.Context, id string, patch Patch) (*models.Payment, error)
+	CreatePayments(ctx context.Context, payments []*models.Payment, mode BatchMode) ([]BatchResult, error)
+	UpdatePayments(ctx context.Context, payments []*models.Payment, mode BatchMode) ([]BatchResult, error)
+	ExportPayments(ctx context.Context, filter *utils.Filter, fn func(payment *models.Payment) error) error
 }
 
 type service struct {
-	repository PaymentRepository
+	repository  PaymentRepository
+	idempotency IdempotencyRepository
+	audit       AuditRepository
+	unitOfWork  UnitOfWork
+
+	purgeRetention time.Duration
+	deletePolicy   DeletePolicy
+	reservationTTL time.Duration
+	fxTolerances   models.FxTolerances
+	logger         kitlog.Logger
+}
+
+// Options tunes the service
+type Options struct {
+	// PurgeRetention is how long a deleted payment is kept before it can be purged
+	PurgeRetention time.Duration
+	// DeletePolicy can refuse the deletion of a payment, DefaultDeletePolicy when nil
+	DeletePolicy DeletePolicy
+	// IdempotencyReservationTTL is how long an idempotency key stays reserved for a request
+	// that neither completes nor releases it, one minute when zero
+	IdempotencyReservationTTL time.Duration
+	// FxTolerances overrides the rounding tolerance of the fx conversions per currency pair
+	FxTolerances models.FxTolerances
+	// Logger logs the failures the client is not told about, discarded when nil
+	Logger kitlog.Logger
 }
 
 // NewService ...
-func NewService(repo PaymentRepository) Service {
+func NewService(repo PaymentRepository, idempotency IdempotencyRepository, audit AuditRepository, unitOfWork UnitOfWork, options Options) Service {
+	if options.DeletePolicy == nil {
+		options.DeletePolicy = DefaultDeletePolicy
+	}
+	if options.IdempotencyReservationTTL <= 0 {
+		options.IdempotencyReservationTTL = defaultReservationTTL
+	}
+	if options.Logger == nil {
+		options.Logger = kitlog.NewNopLogger()
+	}
 	return &service{
-		repository: repo,
+		repository:     repo,
+		idempotency:    idempotency,
+		audit:          audit,
+		unitOfWork:     unitOfWork,
+		purgeRetention: options.PurgeRetention,
+		deletePolicy:   options.DeletePolicy,
+		reservationTTL: options.IdempotencyReservationTTL,
+		fxTolerances:   options.FxTolerances,
+		logger:         options.Logger,
 	}
 }
 
 // CreatePayment creates a new payment
 // Returns the newly created payment
+// When the request carries an idempotency key, a retry returns the payment created first
 func (s *service) CreatePayment(ctx context.Context, payment *models.Payment) (*models.Payment, error) {
-	// Complete payment request with ids and date
-	paymentID := uuid.New()
-	attributeID := uuid.New()
-	chargeInformationID := uuid.New()
+	key := idempotencyKeyFromContext(ctx)
+	if key == "" {
+		var created *models.Payment
+		err := s.mutate(ctx, func(r Repositories) error {
+			var err error
+			created, err = s.createPayment(ctx, r, payment)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return created, nil
+	}
 
-	payment.ID = paymentID
-	payment.CreatedAt = time.Now().UTC()
-	if payment.Attribute != nil {
-		payment.Attribute.ID = attributeID
-		payment.Attribute.PaymentID = paymentID
+	replayed, token, err := s.replayOrReserve(ctx, key, payment)
+	if err != nil {
+		return nil, err
+	}
+	if replayed != nil {
+		return replayed, nil
+	}
 
-		if payment.Attribute.BeneficiaryParty != nil {
-			payment.Attribute.BeneficiaryParty.AttributeID = attributeID
+	// The payment and the response of the key are saved together
+	var created *models.Payment
+	err = s.mutate(ctx, func(r Repositories) error {
+		var err error
+		if created, err = s.createPayment(ctx, r, payment); err != nil {
+			return err
 		}
+		return complete(ctx, r.Idempotency, key, token, created)
+	})
+	if err != nil {
+		// the payment was not created, the client can retry with the same key
+		s.release(ctx, key, token)
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *service) createPayment(ctx context.Context, r Repositories, payment *models.Payment) (*models.Payment, error) {
+	if err := s.prepareCreate(payment); err != nil {
+		return nil, err
+	}
+
+	if err := insertPayment(ctx, r, payment); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
 
+// insertPayment stores a new payment and records its creation
+// The payment must belong to the organisation of the caller
+func insertPayment(ctx context.Context, r Repositories, payment *models.Payment) error {
+	if err := checkOrganisation(ctx, payment); err != nil {
+		return err
+	}
+	if err := r.Payments.InsertPayment(ctx, payment); err != nil {
+		return storageError(persistFailedCode, err)
+	}
+	return record(ctx, r, models.AuditCreate, payment, snapshot(nil), snapshot(payment))
+}
+
+// prepareCreate sets the fields of a new payment and validates it
+func (s *service) prepareCreate(payment *models.Payment) error {
+	payment.ID = uuid.New()
+	payment.Status = models.StatusPending
+	payment.Version = 0
+	payment.CreatedAt = time.Now().UTC()
+	// ids sent by the client are ignored, linkChildren generates new ones
+	if payment.Attribute != nil {
+		payment.Attribute.ID = uuid.Nil
 		if payment.Attribute.ChargesInformation != nil {
-			payment.Attribute.ChargesInformation.ID = chargeInformationID
-			payment.Attribute.ChargesInformation.AttributeID = attributeID
-			for _, s := range payment.Attribute.ChargesInformation.SenderCharges {
-				s.ChargesInformationID = chargeInformationID
-			}
+			payment.Attribute.ChargesInformation.ID = uuid.Nil
 		}
+	}
+	linkChildren(payment)
 
-		if payment.Attribute.DebtorParty != nil {
-			payment.Attribute.DebtorParty.AttributeID = attributeID
-		}
+	if err := payment.Validate(s.fxTolerances); err != nil {
+		return invalidPayment(err)
+	}
+	return nil
+}
 
-		if payment.Attribute.Fx != nil {
-			payment.Attribute.Fx.AttributeID = attributeID
-		}
+// linkChildren sets the keys linking the attribute and its children to the payment
+// Missing attribute and charges information ids are generated
+func linkChildren(payment *models.Payment) {
+	if payment.Attribute == nil {
+		return
+	}
+
+	attribute := payment.Attribute
+	if attribute.ID == uuid.Nil {
+		attribute.ID = uuid.New()
+	}
+	attribute.PaymentID = payment.ID
+
+	if attribute.BeneficiaryParty != nil {
+		attribute.BeneficiaryParty.AttributeID = attribute.ID
+	}
 
-		if payment.Attribute.SponsorParty != nil {
-			payment.Attribute.SponsorParty.AttributeID = attributeID
+	if charges := attribute.ChargesInformation; charges != nil {
+		if charges.ID == uuid.Nil {
+			charges.ID = uuid.New()
+		}
+		charges.AttributeID = attribute.ID
+		for _, s := range charges.SenderCharges {
+			s.ChargesInformationID = charges.ID
 		}
 	}
 
-	if err := payment.Validate(); err != nil {
-		return nil, errorhandling.InvalidRequest(invalidPaymentCode, err)
+	if attribute.DebtorParty != nil {
+		attribute.DebtorParty.AttributeID = attribute.ID
 	}
 
-	if err := s.repository.InsertPayment(ctx, payment); err != nil {
-		return nil, errorhandling.Internal(persistFailedCode, err)
+	if attribute.Fx != nil {
+		attribute.Fx.AttributeID = attribute.ID
+	}
+
+	if attribute.SponsorParty != nil {
+		attribute.SponsorParty.AttributeID = attribute.ID
 	}
-	return payment, nil
 }
 
 // UpdatePayment updates an existing payment
+// The payment version must match the stored one and is incremented on success
 func (s *service) UpdatePayment(ctx context.Context, payment *models.Payment) error {
-	if err := payment.Validate(); err != nil {
-		return errorhandling.InvalidRequest(invalidPaymentCode, err)
+	return s.updatePayment(ctx, payment, models.AuditUpdate)
+}
+
+// updatePayment validates and saves the payment, the action is recorded in its audit entry
+func (s *service) updatePayment(ctx context.Context, payment *models.Payment, action string) error {
+	if err := s.prepareUpdate(payment); err != nil {
+		return err
 	}
+	return s.mutate(ctx, func(r Repositories) error {
+		return savePayment(ctx, r, payment, action)
+	})
+}
 
-	if err := s.repository.UpdatePayment(ctx, payment); err != nil {
-		return errorhandling.Internal(persistFailedCode, err)
+// prepareUpdate validates an updated payment
+func (s *service) prepareUpdate(payment *models.Payment) error {
+	if err := payment.Validate(s.fxTolerances); err != nil {
+		return invalidPayment(err)
 	}
+	// the stored children are replaced by the ones of the request
+	linkChildren(payment)
 	return nil
 }
 
+// savePayment replaces the stored payment and records the change
+// The dates and the status are managed by the service, the ones of the request are ignored
+// The payment cannot be moved to another organisation than the caller's one
+func savePayment(ctx context.Context, r Repositories, payment *models.Payment, action string) error {
+	if err := checkOrganisation(ctx, payment); err != nil {
+		return err
+	}
+	stored, err := r.Payments.GetPayment(ctx, payment.ID.String())
+	if err != nil {
+		return updateError(payment, err)
+	}
+	before := snapshot(stored)
+
+	now := time.Now().UTC()
+	payment.Status = stored.Status
+	payment.CreatedAt = stored.CreatedAt
+	payment.UpdatedAt = &now
+	if err := r.Payments.UpdatePayment(ctx, payment); err != nil {
+		return updateError(payment, err)
+	}
+	return record(ctx, r, action, payment, before, snapshot(payment))
+}
+
+// updateError maps an error of PaymentRepository.UpdatePayment to an api error
+func updateError(payment *models.Payment, err error) error {
+	switch err {
+	case ErrNotFound:
+		return errorhandling.NotFound(invalidPaymentCode, fmt.Errorf("could not find %s", payment.ID))
+	case ErrVersionConflict:
+		return errorhandling.Conflict(staleVersionCode, fmt.Errorf("version %d of %s is not the latest one", payment.Version, payment.ID))
+	}
+	return storageError(persistFailedCode, err)
+}
+
 // GetPayment returns the payment resource selected by its unique identifier
 func (s *service) GetPayment(ctx context.Context, id string) (*models.Payment, error) {
 	if _, err := uuid.Parse(id); err != nil {
@@ -120,7 +339,7 @@ func (s *service) GetPayment(ctx context.Context, id string) (*models.Payment, e
 		if err == ErrNotFound {
 			return nil, errorhandling.NotFound(invalidPaymentCode, fmt.Errorf("could not find %s", id))
 		}
-		return nil, errorhandling.Internal(readPaymentFailedCode, err)
+		return nil, storageError(readPaymentFailedCode, err)
 	}
 
 	return payment, nil
@@ -134,24 +353,72 @@ func (s *service) GetFilteredPayments(ctx context.Context, filters *utils.Filter
 
 	payments, totalCount, err := s.repository.GetFilteredPayments(ctx, filters)
 	if err != nil {
-		return nil, errorhandling.Internal(readPaymentFailedCode, err)
+		return nil, storageError(readPaymentFailedCode, err)
 	}
 	return &utils.FilteredList{
 		Results:    payments,
 		Resource:   resourceName,
 		Filter:     *filters,
 		TotalCount: totalCount,
+		Next:       nextCursor(filters, payments),
 	}, nil
 }
 
 // DeletePayment deletes the payment by its unique identifier
+// The payment is soft deleted, it can be restored until it is purged
+// The delete policy of the service can refuse the deletion
 func (s *service) DeletePayment(ctx context.Context, id string) error {
 	if _, err := uuid.Parse(id); err != nil {
 		return errorhandling.InvalidRequest(invalidPaymentCode, err)
 	}
 
-	if err := s.repository.DeletePayment(ctx, id); err != nil {
-		return errorhandling.Internal(persistFailedCode, err)
+	return s.mutate(ctx, func(r Repositories) error {
+		stored, err := r.Payments.GetPayment(ctx, id)
+		if err != nil {
+			if err == ErrNotFound {
+				return errorhandling.NotFound(invalidPaymentCode, fmt.Errorf("could not find %s", id))
+			}
+			return storageError(readPaymentFailedCode, err)
+		}
+		if s.deletePolicy != nil {
+			if err := s.deletePolicy(stored, time.Now().UTC()); err != nil {
+				return errorhandling.Conflict(deleteRefusedCode, err)
+			}
+		}
+
+		// the version makes sure the payment deleted is the one checked by the policy
+		if err := r.Payments.DeletePayment(ctx, stored); err != nil {
+			switch err {
+			case ErrNotFound:
+				return errorhandling.NotFound(invalidPaymentCode, fmt.Errorf("could not find %s", id))
+			case ErrVersionConflict:
+				return errorhandling.Conflict(staleVersionCode, fmt.Errorf("payment %s was modified concurrently", id))
+			}
+			return storageError(persistFailedCode, err)
+		}
+		return record(ctx, r, models.AuditDelete, stored, snapshot(stored), snapshot(nil))
+	})
+}
+
+// invalidPayment maps a validation failure to a bad request error
+// listing every invalid field when available
+func invalidPayment(err error) error {
+	if fields, ok := err.(models.ValidationErrors); ok {
+		return errorhandling.InvalidFields(invalidPaymentCode, errors.New("payment validation failed"), fields)
 	}
-	return nil
+	return errorhandling.InvalidRequest(invalidPaymentCode, err)
+}
+
+// storageError maps an error of the repositories to an api error
+// Interrupted operations are reported apart from the failed ones
+func storageError(code string, err error) error {
+	switch err {
+	case ErrNoOrganisation:
+		return errorhandling.Forbidden(forbiddenCode, err)
+	case ErrTimeout:
+		return errorhandling.Timeout(queryTimeoutCode, err)
+	case ErrCanceled:
+		return errorhandling.Unavailable(queryCanceledCode, err)
+	}
+	return errorhandling.Internal(code, err)
 }
@@ -5,6 +5,7 @@ package payments
 import (
 	"context"
 	"errors"
+	"net/http"
 	"reflect"
 	"testing"
 
@@ -12,6 +13,7 @@ import (
 
 	"github.com/cedric-parisi/payment-api/internal/models"
 
+	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -22,22 +24,43 @@ func Test_service_CreatePayment(t *testing.T) {
 		ctx     context.Context
 		payment *models.Payment
 	}
+	fxPayment := func() *models.Payment {
+		return &models.Payment{
+			Type:           models.PaymentType,
+			OrganisationID: testOrganisationID,
+			Attribute: &models.Attribute{
+				Amount:         models.MustParseDecimal("100.21"),
+				Currency:       "GBP",
+				ProcessingDate: "2017-01-18",
+				Fx: &models.Fx{
+					ExchangeRate:     models.MustParseDecimal("1.25"),
+					OriginalAmount:   models.MustParseDecimal("80.00"),
+					OriginalCurrency: "USD",
+				},
+			},
+		}
+	}
 	tests := []struct {
-		name      string
-		args      args
-		wantErr   bool
-		mockCalls func(m *MockPaymentRepository)
+		name         string
+		args         args
+		fxTolerances models.FxTolerances
+		wantErr      bool
+		mockCalls    func(m *MockPaymentRepository)
 	}{
 		{
 			name: "create payment success",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				payment: &models.Payment{
-					Type: models.PaymentType,
+					Type:           models.PaymentType,
+					OrganisationID: testOrganisationID,
 					Attribute: &models.Attribute{
+						Amount:           models.MustParseDecimal("100.21"),
+						Currency:         "GBP",
+						ProcessingDate:   "2017-01-18",
 						BeneficiaryParty: &models.BeneficiaryParty{},
 						ChargesInformation: &models.ChargesInformation{
-							SenderCharges: []*models.SenderCharge{{Currency: "GBP"}},
+							SenderCharges: []*models.SenderCharge{{Amount: models.MustParseDecimal("5.00"), Currency: "GBP"}},
 						},
 						DebtorParty:  &models.DebtorParty{},
 						Fx:           &models.Fx{},
@@ -52,7 +75,7 @@ func Test_service_CreatePayment(t *testing.T) {
 		{
 			name: "create payment failed due to invalid payment",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				payment: &models.Payment{
 					Type: "unknown payment type",
 				},
@@ -60,13 +83,55 @@ func Test_service_CreatePayment(t *testing.T) {
 			mockCalls: func(m *MockPaymentRepository) {},
 			wantErr:   true,
 		},
+		{
+			name: "create payment refused when the fx conversion exceeds the default tolerance",
+			args: args{
+				ctx:     callerContext(),
+				payment: fxPayment(),
+			},
+			mockCalls: func(m *MockPaymentRepository) {},
+			wantErr:   true,
+		},
+		{
+			name: "create payment accepts the fx conversion within the tolerance of its pair",
+			args: args{
+				ctx:     callerContext(),
+				payment: fxPayment(),
+			},
+			fxTolerances: models.FxTolerances{"USDGBP": models.MustParseDecimal("0.25")},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("InsertPayment", mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name: "create payment refused for another organisation",
+			args: args{
+				ctx: callerContext(),
+				payment: &models.Payment{
+					Type:           models.PaymentType,
+					OrganisationID: uuid.New(),
+					Attribute: &models.Attribute{
+						Amount:         models.MustParseDecimal("100.21"),
+						Currency:       "GBP",
+						ProcessingDate: "2017-01-18",
+					},
+				},
+			},
+			mockCalls: func(m *MockPaymentRepository) {},
+			wantErr:   true,
+		},
 		{
 			name: "create payment failed due to repository error",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				payment: &models.Payment{
-					Type:      models.PaymentType,
-					Attribute: &models.Attribute{},
+					Type:           models.PaymentType,
+					OrganisationID: testOrganisationID,
+					Attribute: &models.Attribute{
+						Amount:         models.MustParseDecimal("100.21"),
+						Currency:       "GBP",
+						ProcessingDate: "2017-01-18",
+					},
 				},
 			},
 			mockCalls: func(m *MockPaymentRepository) {
@@ -81,7 +146,9 @@ func Test_service_CreatePayment(t *testing.T) {
 			mockRepo := &MockPaymentRepository{}
 			tt.mockCalls(mockRepo)
 			s := &service{
-				repository: mockRepo,
+				repository:   mockRepo,
+				unitOfWork:   newUnitOfWork(mockRepo, nil),
+				fxTolerances: tt.fxTolerances,
 			}
 
 			// Act
@@ -109,31 +176,37 @@ func Test_service_UpdatePayment(t *testing.T) {
 		payment *models.Payment
 	}
 	tests := []struct {
-		name      string
-		args      args
-		wantErr   bool
-		mockCalls func(m *MockPaymentRepository)
+		name       string
+		args       args
+		wantErr    bool
+		wantStatus int
+		mockCalls  func(m *MockPaymentRepository)
 	}{
 		{
 			name: "update payment success",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				payment: &models.Payment{
-					ID:   pID,
-					Type: models.PaymentType,
+					ID:             pID,
+					Type:           models.PaymentType,
+					OrganisationID: testOrganisationID,
 					Attribute: &models.Attribute{
-						PaymentID: pID,
+						PaymentID:      pID,
+						Amount:         models.MustParseDecimal("100.21"),
+						Currency:       "GBP",
+						ProcessingDate: "2017-01-18",
 					},
 				},
 			},
 			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, mock.Anything).Return(&models.Payment{}, nil)
 				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(nil)
 			},
 		},
 		{
 			name: "update payment failed due to invalid payment",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				payment: &models.Payment{
 					ID:   pID,
 					Type: "unknown payment type",
@@ -145,20 +218,70 @@ func Test_service_UpdatePayment(t *testing.T) {
 		{
 			name: "update payment failed due to repository error",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				payment: &models.Payment{
-					ID:   pID,
-					Type: models.PaymentType,
+					ID:             pID,
+					Type:           models.PaymentType,
+					OrganisationID: testOrganisationID,
 					Attribute: &models.Attribute{
-						PaymentID: pID,
+						PaymentID:      pID,
+						Amount:         models.MustParseDecimal("100.21"),
+						Currency:       "GBP",
+						ProcessingDate: "2017-01-18",
 					},
 				},
 			},
 			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, mock.Anything).Return(&models.Payment{}, nil)
 				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(errors.New("failed"))
 			},
 			wantErr: true,
 		},
+		{
+			name: "update payment failed due to stale version",
+			args: args{
+				ctx: callerContext(),
+				payment: &models.Payment{
+					ID:             pID,
+					Type:           models.PaymentType,
+					OrganisationID: testOrganisationID,
+					Attribute: &models.Attribute{
+						PaymentID:      pID,
+						Amount:         models.MustParseDecimal("100.21"),
+						Currency:       "GBP",
+						ProcessingDate: "2017-01-18",
+					},
+				},
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, mock.Anything).Return(&models.Payment{}, nil)
+				m.On("UpdatePayment", mock.Anything, mock.Anything).Return(ErrVersionConflict)
+			},
+			wantStatus: http.StatusConflict,
+			wantErr:    true,
+		},
+		{
+			name: "update payment failed as the payment does not exist",
+			args: args{
+				ctx: callerContext(),
+				payment: &models.Payment{
+					ID:             pID,
+					Type:           models.PaymentType,
+					OrganisationID: testOrganisationID,
+					Attribute: &models.Attribute{
+						PaymentID:      pID,
+						Amount:         models.MustParseDecimal("100.21"),
+						Currency:       "GBP",
+						ProcessingDate: "2017-01-18",
+					},
+				},
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetPayment", mock.Anything, mock.Anything).Return(nil, ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantErr:    true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -167,6 +290,7 @@ func Test_service_UpdatePayment(t *testing.T) {
 			tt.mockCalls(mockRepo)
 			s := &service{
 				repository: mockRepo,
+				unitOfWork: newUnitOfWork(mockRepo, nil),
 			}
 			// Act
 			err := s.UpdatePayment(tt.args.ctx, tt.args.payment)
@@ -175,6 +299,9 @@ func Test_service_UpdatePayment(t *testing.T) {
 			if (err != nil) != tt.wantErr {
 				t.Errorf("service.UpdatePayment() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.wantStatus != 0 {
+				assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+			}
 			assert.True(t, mock.AssertExpectationsForObjects(t, mockRepo))
 		})
 	}
@@ -196,7 +323,7 @@ func Test_service_GetPayment(t *testing.T) {
 		{
 			name: "get payment success",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				id:  pID.String(),
 			},
 			want: &models.Payment{
@@ -211,7 +338,7 @@ func Test_service_GetPayment(t *testing.T) {
 		{
 			name: "get payment failed due to invalid id",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				id:  "invalid id",
 			},
 			mockCalls: func(m *MockPaymentRepository) {},
@@ -220,7 +347,7 @@ func Test_service_GetPayment(t *testing.T) {
 		{
 			name: "get payment not found",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				id:  pID.String(),
 			},
 			mockCalls: func(m *MockPaymentRepository) {
@@ -231,7 +358,7 @@ func Test_service_GetPayment(t *testing.T) {
 		{
 			name: "get payment failed due to repository error",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				id:  pID.String(),
 			},
 			mockCalls: func(m *MockPaymentRepository) {
@@ -266,6 +393,14 @@ func Test_service_GetPayment(t *testing.T) {
 }
 
 func Test_service_GetFilteredPayments(t *testing.T) {
+	cursorPayment := &models.Payment{
+		ID: uuid.MustParse("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"),
+		Attribute: &models.Attribute{
+			ID:        uuid.MustParse("0b9bd3b5-5a38-4f53-9d5e-4a2f0e9c4a10"),
+			PaymentID: uuid.MustParse("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"),
+			Amount:    models.MustParseDecimal("100.21"),
+		},
+	}
 	type args struct {
 		ctx     context.Context
 		filters *utils.Filter
@@ -280,7 +415,7 @@ func Test_service_GetFilteredPayments(t *testing.T) {
 		{
 			name: "get filtered payments success",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				filters: &utils.Filter{
 					Limit:  10,
 					Offset: 0,
@@ -299,10 +434,58 @@ func Test_service_GetFilteredPayments(t *testing.T) {
 				m.On("GetFilteredPayments", mock.Anything, mock.Anything).Return([]*models.Payment{}, 10, nil)
 			},
 		},
+		{
+			name: "get filtered payments full page in cursor mode returns the next cursor",
+			args: args{
+				ctx: callerContext(),
+				filters: &utils.Filter{
+					Limit:   1,
+					Sorting: []utils.Sort{{Field: "amount", Descending: true}},
+					Cursor:  &utils.Cursor{},
+				},
+			},
+			want: &utils.FilteredList{
+				Resource: resourceName,
+				Results:  []*models.Payment{cursorPayment},
+				Filter: utils.Filter{
+					Limit:   1,
+					Sorting: []utils.Sort{{Field: "amount", Descending: true}},
+					Cursor:  &utils.Cursor{},
+				},
+				Next: &utils.Cursor{
+					Values: []*string{utils.CursorValue("100.21")},
+					ID:     cursorPayment.ID.String(),
+				},
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetFilteredPayments", mock.Anything, mock.Anything).Return([]*models.Payment{cursorPayment}, 0, nil)
+			},
+		},
+		{
+			name: "get filtered payments last page in cursor mode",
+			args: args{
+				ctx: callerContext(),
+				filters: &utils.Filter{
+					Limit:  10,
+					Cursor: &utils.Cursor{},
+				},
+			},
+			want: &utils.FilteredList{
+				Resource: resourceName,
+				Results:  []*models.Payment{cursorPayment},
+				Filter: utils.Filter{
+					Limit:  10,
+					Cursor: &utils.Cursor{},
+				},
+			},
+			mockCalls: func(m *MockPaymentRepository) {
+				m.On("GetFilteredPayments", mock.Anything, mock.Anything).Return([]*models.Payment{cursorPayment}, 0, nil)
+			},
+		},
 		{
 			name: "get filtered failed due to wrong limit",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				filters: &utils.Filter{
 					Limit: maxLimit + 10,
 				},
@@ -313,7 +496,7 @@ func Test_service_GetFilteredPayments(t *testing.T) {
 		{
 			name: "get filtered failed due to repository error",
 			args: args{
-				ctx: context.Background(),
+				ctx: callerContext(),
 				filters: &utils.Filter{
 					Limit:  10,
 					Offset: 0,
@@ -349,3 +532,62 @@ func Test_service_GetFilteredPayments(t *testing.T) {
 		})
 	}
 }
+
+func Test_linkChildren(t *testing.T) {
+	paymentID := uuid.New()
+	attributeID := uuid.New()
+	payment := &models.Payment{
+		ID: paymentID,
+		Attribute: &models.Attribute{
+			ID:               attributeID,
+			BeneficiaryParty: &models.BeneficiaryParty{},
+			ChargesInformation: &models.ChargesInformation{
+				SenderCharges: []*models.SenderCharge{{}, {}},
+			},
+			Fx: &models.Fx{},
+		},
+	}
+
+	linkChildren(payment)
+
+	attribute := payment.Attribute
+	assert.Equal(t, attributeID, attribute.ID)
+	assert.Equal(t, paymentID, attribute.PaymentID)
+	assert.Equal(t, attributeID, attribute.BeneficiaryParty.AttributeID)
+	assert.Equal(t, attributeID, attribute.Fx.AttributeID)
+	assert.NotEqual(t, uuid.Nil, attribute.ChargesInformation.ID)
+	assert.Equal(t, attributeID, attribute.ChargesInformation.AttributeID)
+	for _, s := range attribute.ChargesInformation.SenderCharges {
+		assert.Equal(t, attribute.ChargesInformation.ID, s.ChargesInformationID)
+	}
+}
+
+func Test_storageError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{
+			name:       "timed out query",
+			err:        ErrTimeout,
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "canceled query",
+			err:        ErrCanceled,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "failed query",
+			err:        errors.New("failed"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := storageError(persistFailedCode, tt.err)
+			assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/internal/payments"
+)
+
+type auditRepository struct {
+	database
+}
+
+// NewAuditRepository ...
+func NewAuditRepository(db *gorm.DB, options Options) payments.AuditRepository {
+	return &auditRepository{
+		database: database{
+			db:      db,
+			options: options,
+		},
+	}
+}
+
+// AppendAuditEntry save a new audit entry
+func (a auditRepository) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	return a.write(ctx, func(tx *gorm.DB) error {
+		return tx.Create(entry).Error
+	})
+}
+
+// GetAuditEntries select the audit entries of a payment, oldest first
+// The entries of the payments of other organisations are not selected
+func (a auditRepository) GetAuditEntries(ctx context.Context, paymentID string) ([]*models.AuditEntry, error) {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*models.AuditEntry{}
+	err = a.read(ctx, func(db *gorm.DB) error {
+		return db.Where("payment_id = ? AND organisation_id = ?", paymentID, organisationID).
+			Order("created_at, id").
+			Find(&entries).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
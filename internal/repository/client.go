@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+)
+
+type clientRepository struct {
+	database
+}
+
+// NewClientRepository ...
+// The clients are not scoped to an organisation, only the administrators manage them
+func NewClientRepository(db *gorm.DB, options Options) auth.ClientRepository {
+	return &clientRepository{
+		database: database{
+			db:      db,
+			options: options,
+		},
+	}
+}
+
+// InsertClient save a new client
+func (c clientRepository) InsertClient(ctx context.Context, client *auth.Client) error {
+	return c.write(ctx, func(tx *gorm.DB) error {
+		return tx.Create(client).Error
+	})
+}
+
+// GetClient select a client, revoked or not
+func (c clientRepository) GetClient(ctx context.Context, id string) (*auth.Client, error) {
+	client := &auth.Client{}
+	err := c.read(ctx, func(db *gorm.DB) error {
+		err := db.First(client, "id = ?", id).Error
+		if err == gorm.ErrRecordNotFound {
+			return auth.ErrClientNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// UpdateClientSecret replaces the secret hash of an active client
+func (c clientRepository) UpdateClientSecret(ctx context.Context, id string, secretHash string, rotatedAt time.Time) error {
+	return c.updateActiveClient(ctx, id, map[string]interface{}{
+		"secret_hash": secretHash,
+		"rotated_at":  rotatedAt,
+	})
+}
+
+// RevokeClient marks an active client as revoked
+func (c clientRepository) RevokeClient(ctx context.Context, id string, revokedAt time.Time) error {
+	return c.updateActiveClient(ctx, id, map[string]interface{}{
+		"revoked_at": revokedAt,
+	})
+}
+
+// updateActiveClient updates the columns of a client not revoked yet
+// Returns ErrClientNotFound when no such client exists
+func (c clientRepository) updateActiveClient(ctx context.Context, id string, columns map[string]interface{}) error {
+	return c.write(ctx, func(tx *gorm.DB) error {
+		res := tx.Model(&auth.Client{}).
+			Where("id = ? AND revoked_at IS NULL", id).
+			UpdateColumns(columns)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return auth.ErrClientNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/cedric-parisi/payment-api/pkg/auth"
+)
+
+func Test_clientRepository_GetClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantErr   error
+		mockCalls func(m sqlmock.Sqlmock)
+	}{
+		{
+			name: "registered client",
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT \* FROM "clients"`).WillReturnRows(sqlmock.NewRows([]string{"id", "secret_hash"}).AddRow("cedric", auth.HashSecret("secret")))
+			},
+		},
+		{
+			name:    "unknown client is not found",
+			wantErr: auth.ErrClientNotFound,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT \* FROM "clients"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			c := NewClientRepository(db, Options{})
+
+			tt.mockCalls(mock)
+
+			_, err := c.GetClient(context.Background(), "cedric")
+			assert.Equal(t, tt.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_clientRepository_RevokeClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantErr   error
+		mockCalls func(m sqlmock.Sqlmock)
+	}{
+		{
+			name: "active client is revoked",
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "clients" SET "revoked_at" = \$1 WHERE \(id = \$2 AND revoked_at IS NULL\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectCommit()
+			},
+		},
+		{
+			name:    "unknown or already revoked client is not found",
+			wantErr: auth.ErrClientNotFound,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "clients" SET "revoked_at"`).WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			c := NewClientRepository(db, Options{})
+
+			tt.mockCalls(mock)
+
+			err := c.RevokeClient(context.Background(), "cedric", time.Now())
+			assert.Equal(t, tt.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
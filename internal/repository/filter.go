@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/cedric-parisi/payment-api/pkg/utils"
+)
+
+const (
+	// Left joins keep payments without the related row when sorting,
+	// predicates on a missing row are never true so filtering is not affected
+	attributesJoin  = "LEFT JOIN attributes ON attributes.payment_id = payments.id"
+	beneficiaryJoin = "LEFT JOIN beneficiary_parties ON beneficiary_parties.attribute_id = attributes.id"
+	debtorJoin      = "LEFT JOIN debtor_parties ON debtor_parties.attribute_id = attributes.id"
+
+	// idColumn breaks the ties between payments with equal sort keys in cursor mode
+	idColumn = "payments.id"
+)
+
+// column maps a filterable or sortable field to its SQL expression
+// and the joins required to reach it, in order
+type column struct {
+	expr  string
+	joins []string
+}
+
+var (
+	// paymentColumns must cover payments.FilterFields and payments.SortFields
+	paymentColumns = map[string]column{
+		"created_at":                 {expr: "payments.created_at"},
+		"updated_at":                 {expr: "COALESCE(payments.updated_at, payments.created_at)"},
+		"version":                    {expr: "payments.version"},
+		"type":                       {expr: "payments.type"},
+		"status":                     {expr: "payments.status"},
+		"organisation_id":            {expr: "payments.organisation_id"},
+		"amount":                     {expr: "attributes.amount", joins: []string{attributesJoin}},
+		"currency":                   {expr: "attributes.currency", joins: []string{attributesJoin}},
+		"processing_date":            {expr: "attributes.processing_date", joins: []string{attributesJoin}},
+		"payment_scheme":             {expr: "attributes.payment_scheme", joins: []string{attributesJoin}},
+		"payment_type":               {expr: "attributes.payment_type", joins: []string{attributesJoin}},
+		"scheme_payment_type":        {expr: "attributes.scheme_payment_type", joins: []string{attributesJoin}},
+		"beneficiary_account_number": {expr: "beneficiary_parties.account_number", joins: []string{attributesJoin, beneficiaryJoin}},
+		"debtor_account_number":      {expr: "debtor_parties.account_number", joins: []string{attributesJoin, debtorJoin}},
+	}
+
+	sqlOperators = map[utils.Operator]string{
+		utils.Eq:  "=",
+		utils.Gt:  ">",
+		utils.Gte: ">=",
+		utils.Lt:  "<",
+		utils.Lte: "<=",
+	}
+)
+
+// query builds a statement joining each related table at most once
+// Fields and operators are looked up in fixed tables, only values reach the SQL as bound parameters
+type query struct {
+	stmt    *gorm.DB
+	columns map[string]column
+	joined  map[string]bool
+}
+
+func newQuery(stmt *gorm.DB, columns map[string]column) *query {
+	return &query{
+		stmt:    stmt,
+		columns: columns,
+		joined:  map[string]bool{},
+	}
+}
+
+// column returns the column of the field after joining its tables
+func (q *query) column(field string) (column, error) {
+	col, ok := q.columns[field]
+	if !ok {
+		return column{}, fmt.Errorf("unknown field %s", field)
+	}
+	for _, join := range col.joins {
+		if !q.joined[join] {
+			q.stmt = q.stmt.Joins(join)
+			q.joined[join] = true
+		}
+	}
+	return col, nil
+}
+
+// where adds the conditions of the predicates
+func (q *query) where(predicates []utils.Predicate) error {
+	for _, p := range predicates {
+		col, err := q.column(p.Field)
+		if err != nil {
+			return err
+		}
+
+		if p.Operator == utils.In {
+			q.stmt = q.stmt.Where(fmt.Sprintf("%s IN (?)", col.expr), p.Values)
+			continue
+		}
+
+		op, ok := sqlOperators[p.Operator]
+		if !ok || len(p.Values) != 1 {
+			return fmt.Errorf("invalid predicate on %s", p.Field)
+		}
+		q.stmt = q.stmt.Where(fmt.Sprintf("%s %s ?", col.expr, op), p.Values[0])
+	}
+	return nil
+}
+
+// after keeps the results placed after the cursor in the sorting order
+// The id column breaks the ties and must end the ordering, see orderBy
+// e.g. for a sorting a,-b: a > ? OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id > ?)
+// NULL keys sort last ascending and first descending, as orderBy places them
+func (q *query) after(sorting []utils.Sort, cursor *utils.Cursor) error {
+	if cursor.IsZero() {
+		return nil
+	}
+	if len(cursor.Values) != len(sorting) {
+		return fmt.Errorf("cursor does not match the sorting")
+	}
+
+	var clauses []string
+	var args []interface{}
+	var equals []string
+	var equalArgs []interface{}
+	for i, sort := range sorting {
+		col, err := q.column(sort.Field)
+		if err != nil {
+			return err
+		}
+		value := cursor.Values[i]
+
+		if cond, condArgs, ok := beyond(col.expr, sort.Descending, value); ok {
+			clauses = append(clauses, "("+strings.Join(append(equals, cond), " AND ")+")")
+			args = append(append(args, equalArgs...), condArgs...)
+		}
+
+		if value == nil {
+			equals = append(equals, fmt.Sprintf("%s IS NULL", col.expr))
+			continue
+		}
+		equals = append(equals, fmt.Sprintf("%s = ?", col.expr))
+		equalArgs = append(equalArgs, *value)
+	}
+	clauses = append(clauses, "("+strings.Join(append(equals, fmt.Sprintf("%s > ?", idColumn)), " AND ")+")")
+	args = append(append(args, equalArgs...), cursor.ID)
+
+	q.stmt = q.stmt.Where(strings.Join(clauses, " OR "), args...)
+	return nil
+}
+
+// beyond is the condition on a column placing a row strictly after the cursor value
+// NULL is the greatest value, ok is false when no row can be placed after it
+func beyond(expr string, descending bool, value *string) (string, []interface{}, bool) {
+	switch {
+	case value == nil && descending:
+		return fmt.Sprintf("%s IS NOT NULL", expr), nil, true
+	case value == nil:
+		return "", nil, false
+	case descending:
+		return fmt.Sprintf("%s < ?", expr), []interface{}{*value}, true
+	default:
+		return fmt.Sprintf("(%s > ? OR %s IS NULL)", expr, expr), []interface{}{*value}, true
+	}
+}
+
+// orderBy adds the sorting
+func (q *query) orderBy(sorting []utils.Sort) error {
+	for _, sort := range sorting {
+		col, err := q.column(sort.Field)
+		if err != nil {
+			return err
+		}
+		// explicit NULLS placement, after relies on it
+		direction := "ASC NULLS LAST"
+		if sort.Descending {
+			direction = "DESC NULLS FIRST"
+		}
+		q.stmt = q.stmt.Order(fmt.Sprintf("%s %s", col.expr, direction))
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// +build !integration
+
+package repository
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/pkg/utils"
+)
+
+func Test_query_where(t *testing.T) {
+	tests := []struct {
+		name       string
+		predicates []utils.Predicate
+		wantQuery  string
+		wantArgs   int
+		wantErr    bool
+	}{
+		{
+			name: "payment field without join",
+			predicates: []utils.Predicate{
+				{Field: "type", Operator: utils.Eq, Values: []string{"Payment"}},
+			},
+			wantQuery: `SELECT * FROM "payments" WHERE "payments"."deleted_at" IS NULL AND ((payments.type = $1))`,
+			wantArgs:  1,
+		},
+		{
+			name: "nested fields join each table once",
+			predicates: []utils.Predicate{
+				{Field: "amount", Operator: utils.Gte, Values: []string{"10"}},
+				{Field: "currency", Operator: utils.In, Values: []string{"GBP", "EUR"}},
+				{Field: "beneficiary_account_number", Operator: utils.Eq, Values: []string{"31926819"}},
+			},
+			wantQuery: `SELECT "payments".* FROM "payments" ` + attributesJoin + ` ` + beneficiaryJoin +
+				` WHERE "payments"."deleted_at" IS NULL AND ((attributes.amount >= $1) AND (attributes.currency IN ($2,$3)) AND (beneficiary_parties.account_number = $4))`,
+			wantArgs: 4,
+		},
+		{
+			name: "unknown field",
+			predicates: []utils.Predicate{
+				{Field: "payments.id; DROP TABLE payments", Operator: utils.Eq, Values: []string{"1"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+
+			q := newQuery(db.Model(&models.Payment{}), paymentColumns)
+			err := q.where(tt.predicates)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("query.where() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			args := make([]driver.Value, tt.wantArgs)
+			for i := range args {
+				args[i] = sqlmock.AnyArg()
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(tt.wantQuery)).WithArgs(args...).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			var payments []*models.Payment
+			assert.NoError(t, q.stmt.Find(&payments).Error)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_query_orderBy(t *testing.T) {
+	tests := []struct {
+		name       string
+		predicates []utils.Predicate
+		sorting    []utils.Sort
+		wantQuery  string
+		wantArgs   int
+		wantErr    bool
+	}{
+		{
+			name:      "payment field",
+			sorting:   []utils.Sort{{Field: "created_at", Descending: true}},
+			wantQuery: `SELECT * FROM "payments" WHERE "payments"."deleted_at" IS NULL ORDER BY payments.created_at DESC NULLS FIRST`,
+		},
+		{
+			name: "nested field reuses the predicate join",
+			predicates: []utils.Predicate{
+				{Field: "currency", Operator: utils.Eq, Values: []string{"GBP"}},
+			},
+			sorting: []utils.Sort{{Field: "amount"}, {Field: "version", Descending: true}},
+			wantQuery: `SELECT "payments".* FROM "payments" ` + attributesJoin +
+				` WHERE "payments"."deleted_at" IS NULL AND ((attributes.currency = $1)) ORDER BY attributes.amount ASC NULLS LAST,payments.version DESC NULLS FIRST`,
+			wantArgs: 1,
+		},
+		{
+			name:    "unknown field",
+			sorting: []utils.Sort{{Field: "(SELECT 1)"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+
+			q := newQuery(db.Model(&models.Payment{}), paymentColumns)
+			assert.NoError(t, q.where(tt.predicates))
+			err := q.orderBy(tt.sorting)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("query.orderBy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			args := make([]driver.Value, tt.wantArgs)
+			for i := range args {
+				args[i] = sqlmock.AnyArg()
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(tt.wantQuery)).WithArgs(args...).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			var payments []*models.Payment
+			assert.NoError(t, q.stmt.Find(&payments).Error)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_query_after(t *testing.T) {
+	const id = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+	tests := []struct {
+		name      string
+		sorting   []utils.Sort
+		cursor    *utils.Cursor
+		wantQuery string
+		wantArgs  []driver.Value
+		wantErr   bool
+	}{
+		{
+			name:      "first page",
+			cursor:    &utils.Cursor{},
+			wantQuery: `SELECT * FROM "payments" WHERE "payments"."deleted_at" IS NULL`,
+		},
+		{
+			name:      "id only",
+			cursor:    &utils.Cursor{ID: id},
+			wantQuery: `SELECT * FROM "payments" WHERE "payments"."deleted_at" IS NULL AND (((payments.id > $1)))`,
+			wantArgs:  []driver.Value{id},
+		},
+		{
+			name:    "mixed directions",
+			sorting: []utils.Sort{{Field: "amount"}, {Field: "version", Descending: true}},
+			cursor:  &utils.Cursor{Values: []*string{utils.CursorValue("100.21"), utils.CursorValue("2")}, ID: id},
+			wantQuery: `SELECT "payments".* FROM "payments" ` + attributesJoin +
+				` WHERE "payments"."deleted_at" IS NULL AND ((((attributes.amount > $1 OR attributes.amount IS NULL))` +
+				` OR (attributes.amount = $2 AND payments.version < $3)` +
+				` OR (attributes.amount = $4 AND payments.version = $5 AND payments.id > $6)))`,
+			wantArgs: []driver.Value{"100.21", "100.21", "2", "100.21", "2", id},
+		},
+		{
+			name:    "NULL key ascending only keeps the ties",
+			sorting: []utils.Sort{{Field: "amount"}},
+			cursor:  &utils.Cursor{Values: []*string{nil}, ID: id},
+			wantQuery: `SELECT "payments".* FROM "payments" ` + attributesJoin +
+				` WHERE "payments"."deleted_at" IS NULL AND (((attributes.amount IS NULL AND payments.id > $1)))`,
+			wantArgs: []driver.Value{id},
+		},
+		{
+			name:    "NULL key descending keeps the non NULL keys",
+			sorting: []utils.Sort{{Field: "amount", Descending: true}},
+			cursor:  &utils.Cursor{Values: []*string{nil}, ID: id},
+			wantQuery: `SELECT "payments".* FROM "payments" ` + attributesJoin +
+				` WHERE "payments"."deleted_at" IS NULL AND (((attributes.amount IS NOT NULL)` +
+				` OR (attributes.amount IS NULL AND payments.id > $1)))`,
+			wantArgs: []driver.Value{id},
+		},
+		{
+			name:    "cursor not matching the sorting",
+			sorting: []utils.Sort{{Field: "amount"}},
+			cursor:  &utils.Cursor{ID: id},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+
+			q := newQuery(db.Model(&models.Payment{}), paymentColumns)
+			err := q.after(tt.sorting, tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("query.after() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			mock.ExpectQuery(regexp.QuoteMeta(tt.wantQuery)).WithArgs(tt.wantArgs...).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			var payments []*models.Payment
+			assert.NoError(t, q.stmt.Find(&payments).Error)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
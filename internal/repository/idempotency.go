@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/internal/payments"
+)
+
+const (
+	uniqueViolationCode = "23505"
+)
+
+type idempotencyRepository struct {
+	database
+}
+
+// NewIdempotencyRepository ...
+func NewIdempotencyRepository(db *gorm.DB, options Options) payments.IdempotencyRepository {
+	return &idempotencyRepository{
+		database: database{
+			db:      db,
+			options: options,
+		},
+	}
+}
+
+// GetIdempotencyKey select an idempotency key of the organisation of the request
+func (i idempotencyRepository) GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error) {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &models.IdempotencyKey{}
+	err = i.read(ctx, func(db *gorm.DB) error {
+		err := db.First(stored, "organisation_id = ? AND key = ?", organisationID, key).Error
+		if err == gorm.ErrRecordNotFound {
+			return payments.ErrNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// ReserveIdempotencyKey save a new idempotency key without response
+// The key belongs to the organisation of the request
+func (i idempotencyRepository) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
+	}
+
+	key.OrganisationID = organisationID
+	return i.write(ctx, func(tx *gorm.DB) error {
+		err := tx.Create(key).Error
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolationCode {
+			return payments.ErrDuplicateKey
+		}
+		return err
+	})
+}
+
+// TakeOverIdempotencyKey replaces a reservation without response made before reservedBefore
+// The reservation belongs to the organisation of the request
+func (i idempotencyRepository) TakeOverIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, reservedBefore time.Time) error {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
+	}
+
+	key.OrganisationID = organisationID
+	return i.write(ctx, func(tx *gorm.DB) error {
+		res := tx.Model(&models.IdempotencyKey{}).
+			Where("organisation_id = ? AND key = ? AND (response IS NULL OR response = '') AND created_at < ?",
+				organisationID, key.Key, reservedBefore).
+			UpdateColumns(map[string]interface{}{
+				"fingerprint": key.Fingerprint,
+				"token":       key.Token,
+				"created_at":  key.CreatedAt,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return payments.ErrDuplicateKey
+		}
+		return nil
+	})
+}
+
+// CompleteIdempotencyKey stores the response of the request holding the reservation
+// The row is locked by the update until the transaction ends, a takeover waits for it
+func (i idempotencyRepository) CompleteIdempotencyKey(ctx context.Context, key string, token uuid.UUID, response string) error {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
+	}
+
+	return i.write(ctx, func(tx *gorm.DB) error {
+		res := tx.Model(&models.IdempotencyKey{}).
+			Where("organisation_id = ? AND key = ? AND token = ? AND (response IS NULL OR response = '')",
+				organisationID, key, token).
+			Update("response", response)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return payments.ErrDuplicateKey
+		}
+		return nil
+	})
+}
+
+// ReleaseIdempotencyKey removes the reservation of a request so that the key can be used again
+func (i idempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, key string, token uuid.UUID) error {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
+	}
+
+	return i.write(ctx, func(tx *gorm.DB) error {
+		return tx.Delete(&models.IdempotencyKey{}, "organisation_id = ? AND key = ? AND token = ?", organisationID, key, token).Error
+	})
+}
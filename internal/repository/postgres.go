@@ -3,103 +3,487 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"time"
 
 	"github.com/cedric-parisi/payment-api/internal/payments"
 
 	"github.com/cedric-parisi/payment-api/pkg/utils"
 
+	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 
 	"github.com/cedric-parisi/payment-api/internal/models"
 )
 
 type paymentRepository struct {
-	db *gorm.DB
+	database
 }
 
 // NewPaymentRepository ...
-func NewPaymentRepository(db *gorm.DB) payments.PaymentRepository {
+func NewPaymentRepository(db *gorm.DB, options Options) payments.PaymentRepository {
 	return &paymentRepository{
-		db: db,
+		database: database{
+			db:      db,
+			options: options,
+		},
 	}
 }
 
-// InsertPayment save a new payment
+// InsertPayment save a new payment with its attribute in a single transaction
+// Returns ErrNotFound for a payment of another organisation
 func (p paymentRepository) InsertPayment(ctx context.Context, payment *models.Payment) error {
-	return p.db.Create(payment).Error
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
+	}
+	if payment.OrganisationID != organisationID {
+		return payments.ErrNotFound
+	}
+	return p.write(ctx, func(tx *gorm.DB) error {
+		if err := withoutAssociations(tx).Create(payment).Error; err != nil {
+			return err
+		}
+		return insertAttribute(tx, payment.Attribute)
+	})
 }
 
-// UpdatePayment updates an existing payment
+// UpdatePayment updates an existing payment if its version matches the stored one
+// The stored attribute and its children are replaced by the ones of the payment
+// The version is incremented on success
+// The payment cannot be moved to another organisation, it is not found then
 func (p paymentRepository) UpdatePayment(ctx context.Context, payment *models.Payment) error {
-	return p.db.Save(payment).Error
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
+	}
+	if payment.OrganisationID != organisationID {
+		return payments.ErrNotFound
+	}
+
+	version := payment.Version
+	err = p.write(ctx, func(tx *gorm.DB) error {
+		tenant := tx.Where("organisation_id = ?", organisationID)
+		// Bumping the version first locks the row until the end of the transaction
+		res := tenant.Model(&models.Payment{}).
+			Where("id = ? AND version = ?", payment.ID, payment.Version).
+			UpdateColumn("version", gorm.Expr("version + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return missingOrStale(tenant, payment.ID.String())
+		}
+
+		payment.Version++
+		// status only changes through UpdatePaymentStatus
+		err := withoutAssociations(tx).
+			Omit("status").
+			Save(payment).Error
+		if err != nil {
+			return err
+		}
+		return replaceAttribute(tx, payment)
+	})
+	if err != nil {
+		payment.Version = version
+	}
+	return err
+}
+
+// replaceAttribute deletes the stored attribute of the payment and all its children
+// then inserts the attribute of the payment, so that no stale child row survives an update
+func replaceAttribute(tx *gorm.DB, payment *models.Payment) error {
+	// the rows are removed for good, they are not part of a deleted payment
+	tx = tx.Unscoped()
+	attributeIDs, chargesIDs, err := attributeTree(tx, payment.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(chargesIDs) > 0 {
+		if err := tx.Delete(&models.SenderCharge{}, "charges_information_id IN (?)", chargesIDs).Error; err != nil {
+			return err
+		}
+	}
+	if len(attributeIDs) > 0 {
+		for _, child := range attributeChildren {
+			if err := tx.Delete(child, "attribute_id IN (?)", attributeIDs).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&models.Attribute{}, "id IN (?)", attributeIDs).Error; err != nil {
+			return err
+		}
+	}
+
+	return insertAttribute(tx, payment.Attribute)
+}
+
+// attributeChildren are the tables referencing the attribute
+var attributeChildren = []interface{}{
+	&models.ChargesInformation{},
+	&models.BeneficiaryParty{},
+	&models.DebtorParty{},
+	&models.Fx{},
+	&models.SponsorParty{},
+}
+
+// attributeTree selects the ids of the attribute of the payment and of its charges information
+// The sender charges and the parties are found by these ids
+func attributeTree(tx *gorm.DB, paymentID uuid.UUID) ([]uuid.UUID, []uuid.UUID, error) {
+	var attributeIDs, chargesIDs []uuid.UUID
+	if err := tx.Model(&models.Attribute{}).Where("payment_id = ?", paymentID).Pluck("id", &attributeIDs).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(attributeIDs) == 0 {
+		return nil, nil, nil
+	}
+	if err := tx.Model(&models.ChargesInformation{}).Where("attribute_id IN (?)", attributeIDs).Pluck("id", &chargesIDs).Error; err != nil {
+		return nil, nil, err
+	}
+	return attributeIDs, chargesIDs, nil
+}
+
+// cascadeDeletedAt sets the deleted_at of the attribute of the payment and of all its children,
+// a time to delete them along with the payment, nil to restore them
+func cascadeDeletedAt(tx *gorm.DB, paymentID uuid.UUID, deletedAt *time.Time) error {
+	tx = tx.Unscoped()
+	attributeIDs, chargesIDs, err := attributeTree(tx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if len(chargesIDs) > 0 {
+		err := tx.Model(&models.SenderCharge{}).Where("charges_information_id IN (?)", chargesIDs).
+			UpdateColumn("deleted_at", deletedAt).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(attributeIDs) > 0 {
+		for _, child := range attributeChildren {
+			if err := tx.Model(child).Where("attribute_id IN (?)", attributeIDs).UpdateColumn("deleted_at", deletedAt).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.Attribute{}).Where("id IN (?)", attributeIDs).UpdateColumn("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutAssociations disables the saving of associations by gorm
+// It saves associations having a primary key with an update falling back on an insert,
+// which saves their own associations twice, e.g. the sender charges
+func withoutAssociations(tx *gorm.DB) *gorm.DB {
+	return tx.Set("gorm:save_associations", false)
+}
+
+// insertAttribute inserts the attribute then each of its children
+func insertAttribute(tx *gorm.DB, attribute *models.Attribute) error {
+	if attribute == nil {
+		return nil
+	}
+
+	rows := []interface{}{attribute}
+	if attribute.BeneficiaryParty != nil {
+		rows = append(rows, attribute.BeneficiaryParty)
+	}
+	if charges := attribute.ChargesInformation; charges != nil {
+		rows = append(rows, charges)
+		for _, s := range charges.SenderCharges {
+			rows = append(rows, s)
+		}
+	}
+	if attribute.DebtorParty != nil {
+		rows = append(rows, attribute.DebtorParty)
+	}
+	if attribute.Fx != nil {
+		rows = append(rows, attribute.Fx)
+	}
+	if attribute.SponsorParty != nil {
+		rows = append(rows, attribute.SponsorParty)
+	}
+
+	tx = withoutAssociations(tx)
+	for _, row := range rows {
+		if err := tx.Create(row).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdatePaymentStatus changes the status of a payment if its version matches the stored one
+// The version is incremented on success
+func (p paymentRepository) UpdatePaymentStatus(ctx context.Context, payment *models.Payment, status models.Status) error {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := gorm.NowFunc()
+	err = p.write(ctx, func(tx *gorm.DB) error {
+		tx = tx.Where("organisation_id = ?", organisationID)
+		res := tx.Model(&models.Payment{}).
+			Where("id = ? AND version = ?", payment.ID, payment.Version).
+			UpdateColumns(map[string]interface{}{
+				"status":     status,
+				"version":    gorm.Expr("version + 1"),
+				"updated_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return missingOrStale(tx, payment.ID.String())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	payment.Status = status
+	payment.Version++
+	payment.UpdatedAt = &now
+	return nil
+}
+
+// missingOrStale tells apart a payment that does not exist
+// from a payment whose version changed
+func missingOrStale(db *gorm.DB, id string) error {
+	count := 0
+	if err := db.Model(&models.Payment{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return payments.ErrNotFound
+	}
+	return payments.ErrVersionConflict
 }
 
 // GetPayment select a payment by its id
+// Deleted payments and the payments of other organisations are not found
 func (p paymentRepository) GetPayment(ctx context.Context, id string) (*models.Payment, error) {
-	payment := &models.Payment{}
-	err := p.db.First(payment, "id = ?", id).Error
+	organisationID, err := organisation(ctx)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, payments.ErrNotFound
+		return nil, err
+	}
+
+	payment := &models.Payment{}
+	err = p.read(ctx, func(db *gorm.DB) error {
+		if err := db.First(payment, "id = ? AND organisation_id = ?", id, organisationID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return payments.ErrNotFound
+			}
+			return err
 		}
+		return getRelated(db, payment)
+	})
+	if err != nil {
 		return nil, err
 	}
+	return payment, nil
+}
 
-	err = p.getRelated(ctx, payment)
+// GetDeletedPayment select a deleted payment by its id, with the children deleted along with it
+func (p paymentRepository) GetDeletedPayment(ctx context.Context, id string) (*models.Payment, error) {
+	organisationID, err := organisation(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	payment := &models.Payment{}
+	err = p.read(ctx, func(db *gorm.DB) error {
+		db = db.Unscoped()
+		if err := db.First(payment, "id = ? AND organisation_id = ? AND deleted_at IS NOT NULL", id, organisationID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return payments.ErrNotFound
+			}
+			return err
+		}
+		return getRelated(db, payment)
+	})
+	if err != nil {
+		return nil, err
+	}
 	return payment, nil
 }
 
 // GetFilteredPayments selects payments according to filters
+// Returns the requested page and, in offset mode, the count of every payment matching the predicates
+// Keyset pagination does not count the payments, the returned count is always 0 in cursor mode
+// Only the payments of the organisation of the request are selected
 func (p paymentRepository) GetFilteredPayments(ctx context.Context, filter *utils.Filter) ([]*models.Payment, int, error) {
-	stmt := p.db.Offset(filter.Offset).Limit(filter.Limit)
-	for _, sort := range filter.Sorting {
-		direction := "ASC"
-		if sort.Descending {
-			direction = "DESC"
-		}
-		stmt = stmt.Order(fmt.Sprintf("%s %s", sort.Field, direction))
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return nil, 0, err
 	}
-	var payments []*models.Payment
+
+	var page []*models.Payment
 	totalCount := 0
-	err := stmt.Find(&payments).Count(&totalCount).Error
+	err = p.read(ctx, func(db *gorm.DB) error {
+		if filter.IncludeDeleted {
+			// the children of a deleted payment are deleted with it
+			db = db.Unscoped()
+		}
+		payments := db.Model(&models.Payment{}).Where("payments.organisation_id = ?", organisationID)
+		q := newQuery(payments, paymentColumns)
+		if err := q.where(filter.Predicates); err != nil {
+			return err
+		}
+
+		stmt := q.stmt
+		if filter.Cursor != nil {
+			if err := q.after(filter.Sorting, filter.Cursor); err != nil {
+				return err
+			}
+			if err := q.orderBy(filter.Sorting); err != nil {
+				return err
+			}
+			stmt = q.stmt.Order(idColumn)
+		} else {
+			if err := q.stmt.Count(&totalCount).Error; err != nil {
+				return err
+			}
+			if err := q.orderBy(filter.Sorting); err != nil {
+				return err
+			}
+			stmt = q.stmt.Offset(filter.Offset)
+		}
+
+		var err error
+		page, err = findPayments(db, stmt.Limit(filter.Limit))
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page, totalCount, nil
+}
+
+// findPayments runs the statement and loads the related entities of the payments
+func findPayments(db *gorm.DB, stmt *gorm.DB) ([]*models.Payment, error) {
+	var page []*models.Payment
+	err := stmt.Select("payments.*").Find(&page).Error
 	if err != nil {
 		// Find returns sql.ErrNoRows when no result found
 		if err == sql.ErrNoRows {
-			return nil, 0, nil
+			return nil, nil
 		}
-		return nil, 0, err
+		return nil, err
 	}
 
-	for _, payment := range payments {
-		err = p.getRelated(ctx, payment)
-		if err != nil {
-			return nil, 0, err
-		}
+	if err := loadRelated(db, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// DeletePayment soft deletes a payment along with its attribute and all its children
+// They share the same deleted_at so that RestorePayment brings them back together
+// The version of the payment must match the stored one, so that the payment deleted is the one checked by the service
+// Returns ErrNotFound when the payment does not exist or is already deleted
+func (p paymentRepository) DeletePayment(ctx context.Context, payment *models.Payment) error {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
 	}
 
-	return payments, totalCount, nil
+	now := gorm.NowFunc()
+	return p.write(ctx, func(tx *gorm.DB) error {
+		tenant := tx.Where("organisation_id = ?", organisationID)
+		res := tenant.Model(&models.Payment{}).
+			Where("id = ? AND version = ?", payment.ID, payment.Version).
+			UpdateColumn("deleted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return missingOrStale(tenant, payment.ID.String())
+		}
+		return cascadeDeletedAt(tx, payment.ID, &now)
+	})
 }
 
-func (p paymentRepository) DeletePayment(ctx context.Context, id string) error {
-	return p.db.Delete(models.Payment{}, "id = ?", id).Error
+// RestorePayment undeletes a deleted payment along with its attribute and all its children
+// The version of the payment must match the stored one and is incremented on success
+func (p paymentRepository) RestorePayment(ctx context.Context, payment *models.Payment) error {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := gorm.NowFunc()
+	err = p.write(ctx, func(tx *gorm.DB) error {
+		res := tx.Unscoped().Model(&models.Payment{}).
+			Where("id = ? AND organisation_id = ? AND version = ? AND deleted_at IS NOT NULL", payment.ID, organisationID, payment.Version).
+			UpdateColumns(map[string]interface{}{
+				"deleted_at": nil,
+				"version":    gorm.Expr("version + 1"),
+				"updated_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return missingOrStale(tx.Unscoped().Where("organisation_id = ? AND deleted_at IS NOT NULL", organisationID), payment.ID.String())
+		}
+		return cascadeDeletedAt(tx, payment.ID, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	payment.DeletedAt = nil
+	payment.Version++
+	payment.UpdatedAt = &now
+	return nil
 }
 
-func (p paymentRepository) getRelated(ctx context.Context, payment *models.Payment) error {
-	payment.Attribute = &models.Attribute{
-		BeneficiaryParty: &models.BeneficiaryParty{},
-		ChargesInformation: &models.ChargesInformation{
-			SenderCharges: []*models.SenderCharge{},
-		},
-		DebtorParty:  &models.DebtorParty{},
-		Fx:           &models.Fx{},
-		SponsorParty: &models.SponsorParty{},
+// PurgePayments removes for good up to limit payments deleted before the given time, oldest first
+// Their children are removed by the cascading foreign keys
+// Returns the purged payments, without their children
+// Only the payments of the organisation of the request are purged
+func (p paymentRepository) PurgePayments(ctx context.Context, deletedBefore time.Time, limit int) ([]*models.Payment, error) {
+	organisationID, err := organisation(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []*models.Payment
+	err = p.write(ctx, func(tx *gorm.DB) error {
+		tx = tx.Unscoped()
+		err := tx.Where("organisation_id = ? AND deleted_at < ?", organisationID, deletedBefore).
+			Order("deleted_at, id").
+			Limit(limit).
+			Set("gorm:query_option", "FOR UPDATE").
+			Find(&purged).Error
+		if err != nil {
+			return err
+		}
+		if len(purged) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, 0, len(purged))
+		for _, payment := range purged {
+			ids = append(ids, payment.ID)
+		}
+		return tx.Delete(&models.Payment{}, "id IN (?)", ids).Error
+	})
+	if err != nil {
+		return nil, err
 	}
-	err := p.db.First(payment.Attribute, "payment_id = ?", payment.ID).
+	return purged, nil
+}
+
+func getRelated(db *gorm.DB, payment *models.Payment) error {
+	payment.Attribute = &models.Attribute{}
+	setEmptyChildren(payment.Attribute)
+	err := db.First(payment.Attribute, "payment_id = ?", payment.ID).
 		Related(payment.Attribute.BeneficiaryParty).
 		Related(payment.Attribute.BeneficiaryParty).
 		Related(payment.Attribute.ChargesInformation).
@@ -113,7 +497,7 @@ func (p paymentRepository) getRelated(ctx context.Context, payment *models.Payme
 		}
 	}
 
-	err = p.db.Find(&payment.Attribute.ChargesInformation.SenderCharges, "charges_information_id = ?", payment.Attribute.ChargesInformation.ID).Error
+	err = db.Find(&payment.Attribute.ChargesInformation.SenderCharges, "charges_information_id = ?", payment.Attribute.ChargesInformation.ID).Error
 	if err != nil {
 		if err != gorm.ErrRecordNotFound {
 			return err
@@ -121,3 +505,114 @@ func (p paymentRepository) getRelated(ctx context.Context, payment *models.Payme
 	}
 	return nil
 }
+
+// loadRelated loads the attributes of the payments and their children
+// with one query per table whatever the number of payments, then assembles them in memory
+// Missing entities are set empty as getRelated does
+func loadRelated(db *gorm.DB, page []*models.Payment) error {
+	if len(page) == 0 {
+		return nil
+	}
+
+	paymentIDs := make([]uuid.UUID, 0, len(page))
+	for _, payment := range page {
+		paymentIDs = append(paymentIDs, payment.ID)
+	}
+	var attributes []*models.Attribute
+	if err := db.Where("payment_id IN (?)", paymentIDs).Find(&attributes).Error; err != nil {
+		return err
+	}
+
+	attributeIDs := make([]uuid.UUID, 0, len(attributes))
+	for _, a := range attributes {
+		attributeIDs = append(attributeIDs, a.ID)
+	}
+	var beneficiaries []*models.BeneficiaryParty
+	var charges []*models.ChargesInformation
+	var debtors []*models.DebtorParty
+	var fxs []*models.Fx
+	var sponsors []*models.SponsorParty
+	var senderCharges []*models.SenderCharge
+	if len(attributeIDs) > 0 {
+		for _, dest := range []interface{}{&beneficiaries, &charges, &debtors, &fxs, &sponsors} {
+			if err := db.Where("attribute_id IN (?)", attributeIDs).Find(dest).Error; err != nil {
+				return err
+			}
+		}
+
+		chargesIDs := make([]uuid.UUID, 0, len(charges))
+		for _, c := range charges {
+			chargesIDs = append(chargesIDs, c.ID)
+		}
+		if len(chargesIDs) > 0 {
+			if err := db.Where("charges_information_id IN (?)", chargesIDs).Find(&senderCharges).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// assemble from the leaves up to the payments
+	senderChargesByCharges := map[uuid.UUID][]*models.SenderCharge{}
+	for _, s := range senderCharges {
+		senderChargesByCharges[s.ChargesInformationID] = append(senderChargesByCharges[s.ChargesInformationID], s)
+	}
+
+	byAttribute := map[uuid.UUID]*models.Attribute{}
+	for _, a := range attributes {
+		setEmptyChildren(a)
+		byAttribute[a.ID] = a
+	}
+	for _, b := range beneficiaries {
+		if a, ok := byAttribute[b.AttributeID]; ok {
+			a.BeneficiaryParty = b
+		}
+	}
+	for _, c := range charges {
+		if a, ok := byAttribute[c.AttributeID]; ok {
+			c.SenderCharges = senderChargesByCharges[c.ID]
+			if c.SenderCharges == nil {
+				c.SenderCharges = []*models.SenderCharge{}
+			}
+			a.ChargesInformation = c
+		}
+	}
+	for _, d := range debtors {
+		if a, ok := byAttribute[d.AttributeID]; ok {
+			a.DebtorParty = d
+		}
+	}
+	for _, f := range fxs {
+		if a, ok := byAttribute[f.AttributeID]; ok {
+			a.Fx = f
+		}
+	}
+	for _, s := range sponsors {
+		if a, ok := byAttribute[s.AttributeID]; ok {
+			a.SponsorParty = s
+		}
+	}
+
+	byPayment := make(map[uuid.UUID]*models.Attribute, len(attributes))
+	for _, a := range attributes {
+		byPayment[a.PaymentID] = a
+	}
+	for _, payment := range page {
+		payment.Attribute = byPayment[payment.ID]
+		if payment.Attribute == nil {
+			payment.Attribute = &models.Attribute{}
+			setEmptyChildren(payment.Attribute)
+		}
+	}
+	return nil
+}
+
+// setEmptyChildren sets every child of the attribute to an empty value
+func setEmptyChildren(a *models.Attribute) {
+	a.BeneficiaryParty = &models.BeneficiaryParty{}
+	a.ChargesInformation = &models.ChargesInformation{
+		SenderCharges: []*models.SenderCharge{},
+	}
+	a.DebtorParty = &models.DebtorParty{}
+	a.Fx = &models.Fx{}
+	a.SponsorParty = &models.SponsorParty{}
+}
@@ -2,16 +2,28 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 
 	"github.com/cedric-parisi/payment-api/internal/models"
+	"github.com/cedric-parisi/payment-api/internal/payments"
 	"github.com/jinzhu/gorm"
 )
 
+// testOrganisationID is the organisation of the caller in the tests
+var testOrganisationID = uuid.MustParse("743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb")
+
+// callerContext is the context of a request of testOrganisationID
+func callerContext() context.Context {
+	return payments.WithOrganisation(context.Background(), testOrganisationID)
+}
+
 func Test_paymentRepository_InsertPayment(t *testing.T) {
 	type args struct {
 		ctx     context.Context
@@ -23,13 +35,59 @@ func Test_paymentRepository_InsertPayment(t *testing.T) {
 		wantErr   bool
 		mockCalls func(m sqlmock.Sqlmock)
 	}{
-		// TODO
+		{
+			name: "payment and children inserted in a single transaction",
+			args: args{
+				ctx:     callerContext(),
+				payment: newUpdatedPayment(),
+			},
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectQuery(`INSERT INTO "payments"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"))
+				m.ExpectQuery(`INSERT INTO "attributes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7a3bbd41-7a5d-4e4c-8e0c-1c9d3e0c2a11"))
+				m.ExpectQuery(`INSERT INTO "charges_informations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("b5e6a2c1-0d0c-4a54-9cb0-7b5a36f0e4e2"))
+				m.ExpectExec(`INSERT INTO "sender_charges"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectCommit()
+			},
+		},
+		{
+			name: "failed child insert rolls back the payment",
+			args: args{
+				ctx:     callerContext(),
+				payment: newUpdatedPayment(),
+			},
+			wantErr: true,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectQuery(`INSERT INTO "payments"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"))
+				m.ExpectQuery(`INSERT INTO "attributes"`).WillReturnError(errors.New("failed"))
+				m.ExpectRollback()
+			},
+		},
+		{
+			name: "payment of another organisation is refused",
+			args: args{
+				ctx:     payments.WithOrganisation(context.Background(), uuid.New()),
+				payment: newUpdatedPayment(),
+			},
+			wantErr:   true,
+			mockCalls: func(m sqlmock.Sqlmock) {},
+		},
+		{
+			name: "context without organisation is refused",
+			args: args{
+				ctx:     context.Background(),
+				payment: newUpdatedPayment(),
+			},
+			wantErr:   true,
+			mockCalls: func(m sqlmock.Sqlmock) {},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockDB, mock, _ := sqlmock.New()
 			db, _ := gorm.Open("postgres", mockDB)
-			p := NewPaymentRepository(db)
+			p := NewPaymentRepository(db, Options{})
 
 			tt.mockCalls(mock)
 
@@ -41,3 +99,540 @@ func Test_paymentRepository_InsertPayment(t *testing.T) {
 		})
 	}
 }
+
+func newUpdatedPayment() *models.Payment {
+	paymentID := uuid.MustParse("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43")
+	attributeID := uuid.MustParse("7a3bbd41-7a5d-4e4c-8e0c-1c9d3e0c2a11")
+	chargesID := uuid.MustParse("b5e6a2c1-0d0c-4a54-9cb0-7b5a36f0e4e2")
+	return &models.Payment{
+		ID:             paymentID,
+		Type:           models.PaymentType,
+		Version:        2,
+		OrganisationID: testOrganisationID,
+		Attribute: &models.Attribute{
+			ID:        attributeID,
+			PaymentID: paymentID,
+			Amount:    models.MustParseDecimal("100.21"),
+			ChargesInformation: &models.ChargesInformation{
+				ID:          chargesID,
+				AttributeID: attributeID,
+				SenderCharges: []*models.SenderCharge{
+					{ChargesInformationID: chargesID, Amount: models.MustParseDecimal("5.00"), Currency: "GBP"},
+				},
+			},
+		},
+	}
+}
+
+func Test_paymentRepository_UpdatePayment(t *testing.T) {
+	storedAttributeID := "0b7e3f4a-3a57-4c55-9f1e-3a6b1c2d4e5f"
+	storedChargesID := "1c8f4a5b-4b68-4d66-8a2f-4b7c2d3e5f60"
+
+	// expectReplace expects the deletion of the stored children
+	expectReplace := func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(`SELECT id FROM "attributes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(storedAttributeID))
+		m.ExpectQuery(`SELECT id FROM "charges_informations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(storedChargesID))
+		m.ExpectExec(`DELETE FROM "sender_charges"`).WillReturnResult(sqlmock.NewResult(0, 2))
+		m.ExpectExec(`DELETE FROM "charges_informations"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		m.ExpectExec(`DELETE FROM "beneficiary_parties"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		m.ExpectExec(`DELETE FROM "debtor_parties"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		m.ExpectExec(`DELETE FROM "fxes"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		m.ExpectExec(`DELETE FROM "sponsor_parties"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		m.ExpectExec(`DELETE FROM "attributes"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	tests := []struct {
+		name        string
+		wantErr     error
+		wantVersion int
+		mockCalls   func(m sqlmock.Sqlmock)
+	}{
+		{
+			name:        "children are replaced in a single transaction",
+			wantVersion: 3,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "payments" SET "version" = version \+ 1`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectExec(`UPDATE "payments" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectReplace(m)
+				m.ExpectQuery(`INSERT INTO "attributes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7a3bbd41-7a5d-4e4c-8e0c-1c9d3e0c2a11"))
+				m.ExpectQuery(`INSERT INTO "charges_informations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("b5e6a2c1-0d0c-4a54-9cb0-7b5a36f0e4e2"))
+				m.ExpectExec(`INSERT INTO "sender_charges"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectCommit()
+			},
+		},
+		{
+			name:        "failed child write rolls back the update",
+			wantErr:     errors.New("failed"),
+			wantVersion: 2,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "payments" SET "version" = version \+ 1`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectExec(`UPDATE "payments" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectReplace(m)
+				m.ExpectQuery(`INSERT INTO "attributes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7a3bbd41-7a5d-4e4c-8e0c-1c9d3e0c2a11"))
+				m.ExpectQuery(`INSERT INTO "charges_informations"`).WillReturnError(errors.New("failed"))
+				m.ExpectRollback()
+			},
+		},
+		{
+			name:        "stale version",
+			wantErr:     payments.ErrVersionConflict,
+			wantVersion: 2,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "payments" SET "version" = version \+ 1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectQuery(`SELECT count\(\*\) FROM "payments"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				m.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			p := NewPaymentRepository(db, Options{})
+			payment := newUpdatedPayment()
+
+			tt.mockCalls(mock)
+
+			err := p.UpdatePayment(callerContext(), payment)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Equal(t, tt.wantErr.Error(), err.Error())
+			}
+			assert.Equal(t, tt.wantVersion, payment.Version)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// expectCascade expects the deleted_at of the children of the payment to be set
+func expectCascade(m sqlmock.Sqlmock) {
+	m.ExpectQuery(`SELECT id FROM "attributes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7a3bbd41-7a5d-4e4c-8e0c-1c9d3e0c2a11"))
+	m.ExpectQuery(`SELECT id FROM "charges_informations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("b5e6a2c1-0d0c-4a54-9cb0-7b5a36f0e4e2"))
+	for _, table := range []string{"sender_charges", "charges_informations", "beneficiary_parties", "debtor_parties", "fxes", "sponsor_parties", "attributes"} {
+		m.ExpectExec(`UPDATE "` + table + `" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+}
+
+func Test_paymentRepository_DeletePayment(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantErr   error
+		mockCalls func(m sqlmock.Sqlmock)
+	}{
+		{
+			name: "children are deleted with the payment",
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "payments" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectCascade(m)
+				m.ExpectCommit()
+			},
+		},
+		{
+			name:    "unknown or already deleted payment is not found",
+			wantErr: payments.ErrNotFound,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "payments" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectQuery(`SELECT count\(\*\) FROM "payments"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				m.ExpectRollback()
+			},
+		},
+		{
+			name:    "stale version",
+			wantErr: payments.ErrVersionConflict,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "payments" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectQuery(`SELECT count\(\*\) FROM "payments"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				m.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			p := NewPaymentRepository(db, Options{})
+
+			tt.mockCalls(mock)
+
+			err := p.DeletePayment(callerContext(), newUpdatedPayment())
+			assert.Equal(t, tt.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_paymentRepository_RestorePayment(t *testing.T) {
+	tests := []struct {
+		name        string
+		wantErr     error
+		wantVersion int
+		mockCalls   func(m sqlmock.Sqlmock)
+	}{
+		{
+			name:        "children are restored with the payment",
+			wantVersion: 3,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "payments" SET "deleted_at" = \$1, "updated_at" = \$2, "version" = version \+ 1`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectCascade(m)
+				m.ExpectCommit()
+			},
+		},
+		{
+			name:        "payment not deleted",
+			wantErr:     payments.ErrNotFound,
+			wantVersion: 2,
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "payments"`).WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectQuery(`SELECT count\(\*\) FROM "payments"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				m.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			p := NewPaymentRepository(db, Options{})
+			payment := newUpdatedPayment()
+			deletedAt := time.Now()
+			payment.DeletedAt = &deletedAt
+
+			tt.mockCalls(mock)
+
+			err := p.RestorePayment(callerContext(), payment)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				assert.Nil(t, payment.DeletedAt)
+			} else {
+				assert.Equal(t, tt.wantErr, err)
+			}
+			assert.Equal(t, tt.wantVersion, payment.Version)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_unitOfWork_Do(t *testing.T) {
+	tests := []struct {
+		name      string
+		fnErr     error
+		mockCalls func(m sqlmock.Sqlmock)
+	}{
+		{
+			name: "operations are committed together",
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "idempotency_keys"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectExec(`UPDATE "payments"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectCommit()
+			},
+		},
+		{
+			name:  "operations are rolled back together",
+			fnErr: errors.New("failed"),
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectExec(`UPDATE "idempotency_keys"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectExec(`UPDATE "payments"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			u := NewUnitOfWork(db, Options{})
+
+			tt.mockCalls(mock)
+
+			err := u.Do(callerContext(), func(r payments.Repositories) error {
+				if err := r.Idempotency.CompleteIdempotencyKey(callerContext(), "key", uuid.New(), "{}"); err != nil {
+					return err
+				}
+				payment := newUpdatedPayment()
+				if err := r.Payments.UpdatePaymentStatus(callerContext(), payment, models.StatusSubmitted); err != nil {
+					return err
+				}
+				return tt.fnErr
+			})
+			assert.Equal(t, tt.fnErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_paymentRepository_GetPayment_Organisation(t *testing.T) {
+	id := uuid.New().String()
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		mockCalls func(m sqlmock.Sqlmock)
+		wantErr   error
+	}{
+		{
+			name: "payment of another organisation is not found",
+			ctx:  callerContext(),
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT \* FROM "payments" WHERE .*organisation_id = \$2`).
+					WithArgs(id, testOrganisationID).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			wantErr: payments.ErrNotFound,
+		},
+		{
+			name:      "context without organisation reads nothing",
+			ctx:       context.Background(),
+			mockCalls: func(m sqlmock.Sqlmock) {},
+			wantErr:   payments.ErrNoOrganisation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			p := NewPaymentRepository(db, Options{})
+			tt.mockCalls(mock)
+
+			got, err := p.GetPayment(tt.ctx, id)
+			assert.Nil(t, got)
+			assert.Equal(t, tt.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_paymentRepository_PurgePayments(t *testing.T) {
+	deletedBefore := time.Now().Add(-time.Hour)
+	purgedID := uuid.New()
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		mockCalls func(m sqlmock.Sqlmock)
+		want      int
+		wantErr   error
+	}{
+		{
+			name: "payments of the organisation are purged",
+			ctx:  callerContext(),
+			mockCalls: func(m sqlmock.Sqlmock) {
+				m.ExpectBegin()
+				m.ExpectQuery(`SELECT \* FROM "payments" WHERE \(organisation_id = \$1 AND deleted_at < \$2\)`).
+					WithArgs(testOrganisationID, deletedBefore).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(purgedID.String()))
+				m.ExpectExec(`DELETE FROM "payments" WHERE \(id IN \(\$1\)\)`).
+					WithArgs(purgedID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectCommit()
+			},
+			want: 1,
+		},
+		{
+			name:      "context without organisation purges nothing",
+			ctx:       context.Background(),
+			mockCalls: func(m sqlmock.Sqlmock) {},
+			wantErr:   payments.ErrNoOrganisation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			p := NewPaymentRepository(db, Options{})
+			tt.mockCalls(mock)
+
+			got, err := p.PurgePayments(tt.ctx, deletedBefore, 10)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Len(t, got, tt.want)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_idempotencyRepository_CompleteIdempotencyKey(t *testing.T) {
+	token := uuid.New()
+	tests := []struct {
+		name     string
+		affected int64
+		wantErr  error
+	}{
+		{
+			name:     "reservation completed",
+			affected: 1,
+		},
+		{
+			name:    "reservation taken over by another request",
+			wantErr: payments.ErrDuplicateKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			i := NewIdempotencyRepository(db, Options{})
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE "idempotency_keys" SET "response" = \$1 WHERE .*token = \$4`).
+				WithArgs("{}", testOrganisationID, "key", token).
+				WillReturnResult(sqlmock.NewResult(0, tt.affected))
+			if tt.wantErr == nil {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err := i.CompleteIdempotencyKey(callerContext(), "key", token, "{}")
+			assert.Equal(t, tt.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_paymentRepository_GetPayment_Context(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		options Options
+		wantErr error
+	}{
+		{
+			name:    "read timeout interrupts the query",
+			ctx:     func() (context.Context, context.CancelFunc) { return context.WithCancel(callerContext()) },
+			options: Options{ReadTimeout: 10 * time.Millisecond},
+			wantErr: payments.ErrTimeout,
+		},
+		{
+			name: "request deadline interrupts the query",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(callerContext(), 10*time.Millisecond)
+			},
+			wantErr: payments.ErrTimeout,
+		},
+		{
+			name: "canceled request interrupts the query",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(callerContext())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			wantErr: payments.ErrCanceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			db, _ := gorm.Open("postgres", mockDB)
+			p := NewPaymentRepository(db, tt.options)
+
+			mock.ExpectQuery(`SELECT \* FROM "payments"`).
+				WillDelayFor(time.Second).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			got, err := p.GetPayment(ctx, uuid.New().String())
+			assert.Nil(t, got)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_paymentRepository_loadRelated(t *testing.T) {
+	p1, p2, p3 := uuid.New(), uuid.New(), uuid.New()
+	a1, a2 := uuid.New(), uuid.New()
+	c1 := uuid.New()
+
+	mockDB, mock, _ := sqlmock.New()
+	db, _ := gorm.Open("postgres", mockDB)
+
+	mock.ExpectQuery(`SELECT \* FROM "attributes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payment_id", "amount"}).AddRow(a1.String(), p1.String(), "10.00").AddRow(a2.String(), p2.String(), "20.00"))
+	mock.ExpectQuery(`SELECT \* FROM "beneficiary_parties"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attribute_id", "name"}).AddRow(a2.String(), "Wilfred"))
+	mock.ExpectQuery(`SELECT \* FROM "charges_informations"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attribute_id", "bearer_code"}).AddRow(c1.String(), a1.String(), "SHAR"))
+	mock.ExpectQuery(`SELECT \* FROM "debtor_parties"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attribute_id", "name"}).AddRow(a1.String(), "Emelia"))
+	mock.ExpectQuery(`SELECT \* FROM "fxes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attribute_id"}))
+	mock.ExpectQuery(`SELECT \* FROM "sponsor_parties"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attribute_id"}))
+	mock.ExpectQuery(`SELECT \* FROM "sender_charges"`).
+		WillReturnRows(sqlmock.NewRows([]string{"charges_information_id", "amount"}).AddRow(c1.String(), "5.00").AddRow(c1.String(), "10.00"))
+
+	list := []*models.Payment{{ID: p1}, {ID: p2}, {ID: p3}}
+	assert.NoError(t, loadRelated(db, list))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, "10.00", list[0].Attribute.Amount.String())
+	assert.Equal(t, "Emelia", list[0].Attribute.DebtorParty.Name)
+	assert.Equal(t, "SHAR", list[0].Attribute.ChargesInformation.BearerCode)
+	assert.Len(t, list[0].Attribute.ChargesInformation.SenderCharges, 2)
+	assert.Equal(t, &models.BeneficiaryParty{}, list[0].Attribute.BeneficiaryParty)
+
+	assert.Equal(t, "20.00", list[1].Attribute.Amount.String())
+	assert.Equal(t, "Wilfred", list[1].Attribute.BeneficiaryParty.Name)
+	assert.Equal(t, []*models.SenderCharge{}, list[1].Attribute.ChargesInformation.SenderCharges)
+
+	// a payment without attribute gets empty entities
+	assert.Equal(t, uuid.Nil, list[2].Attribute.ID)
+	assert.NotNil(t, list[2].Attribute.ChargesInformation)
+}
+
+// roundTrip simulates the latency of a query to the database
+const roundTrip = 100 * time.Microsecond
+
+// newBenchmarkPage returns a page of payments and a database answering every query
+// with a row for each of them after a round trip
+func newBenchmarkPage(b *testing.B, size int, queries int) (*gorm.DB, []*models.Payment) {
+	mockDB, mock, _ := sqlmock.New()
+	db, _ := gorm.Open("postgres", mockDB)
+
+	page := make([]*models.Payment, 0, size)
+	rows := sqlmock.NewRows([]string{"id", "payment_id", "attribute_id", "charges_information_id"})
+	for i := 0; i < size; i++ {
+		id := uuid.New()
+		page = append(page, &models.Payment{ID: id})
+		rows.AddRow(id.String(), id.String(), id.String(), id.String())
+	}
+	for i := 0; i < queries; i++ {
+		mock.ExpectQuery(".").WillReturnRows(rows).WillDelayFor(roundTrip)
+	}
+	return db, page
+}
+
+func Benchmark_paymentRepository_getRelated(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		// getRelated runs 8 queries per payment
+		db, page := newBenchmarkPage(b, 100, 800)
+		b.StartTimer()
+
+		for _, payment := range page {
+			if err := getRelated(db, payment); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Benchmark_paymentRepository_loadRelated(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		// loadRelated runs 7 queries per page
+		db, page := newBenchmarkPage(b, 100, 7)
+		b.StartTimer()
+
+		if err := loadRelated(db, page); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github.com/cedric-parisi/payment-api/internal/payments"
+)
+
+// Options configures the database sessions of the repositories
+type Options struct {
+	// LogMode logs every statement
+	LogMode bool
+	// ReadTimeout bounds the duration of a read operation, no limit when zero
+	ReadTimeout time.Duration
+	// WriteTimeout bounds the duration of a write operation and its transaction, no limit when zero
+	WriteTimeout time.Duration
+}
+
+// database runs the operations of the repositories with the context of the request
+// gorm v1 has no context support, its statements go through ctxDB and ctxTx instead
+type database struct {
+	db      *gorm.DB
+	options Options
+}
+
+// read runs a read operation bounded by the read timeout
+func (d database) read(ctx context.Context, fn func(db *gorm.DB) error) error {
+	ctx, cancel := withTimeout(ctx, d.options.ReadTimeout)
+	defer cancel()
+
+	return queryError(ctx, fn(d.session(ctx)))
+}
+
+// write runs a write operation in a transaction bounded by the write timeout
+// Within a unit of work, the operation joins the transaction of the unit
+func (d database) write(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	ctx, cancel := withTimeout(ctx, d.options.WriteTimeout)
+	defer cancel()
+
+	return queryError(ctx, d.transaction(d.session(ctx), fn))
+}
+
+// session binds the statements of the database to the context
+func (d database) session(ctx context.Context) *gorm.DB {
+	switch conn := d.db.CommonDB().(type) {
+	case *sql.DB:
+		return d.open(ctxDB{ctx: ctx, db: conn})
+	case ctxDB:
+		return d.open(ctxDB{ctx: ctx, db: conn.db})
+	case ctxTx:
+		return d.open(ctxTx{ctx: ctx, tx: conn.tx})
+	}
+	return d.db
+}
+
+// transaction runs fn in a new transaction, committed when fn returns nil and rolled back otherwise
+// A session already in a transaction runs fn in it, the owner of the transaction commits it
+func (d database) transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	conn, ok := db.CommonDB().(ctxDB)
+	if !ok {
+		return fn(db)
+	}
+
+	sqlTx, err := conn.db.BeginTx(conn.ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := d.open(ctxTx{ctx: conn.ctx, tx: sqlTx})
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// open makes a handle running its statements on the connection
+// gorm v1 cannot change the connection of a handle, the handle is opened on it with the dialect of the database one
+// It runs the callbacks registered on gorm.DefaultCallback, its other settings come from the options
+func (d database) open(conn gorm.SQLCommon) *gorm.DB {
+	// Open only fails to ping a *sql.DB, never given here
+	db, _ := gorm.Open(d.db.Dialect().GetName(), conn)
+	db.LogMode(d.options.LogMode)
+	return db
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// queryError reports the operations interrupted by their context
+// with the errors of the payments package
+func queryError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return payments.ErrTimeout
+	case context.Canceled:
+		return payments.ErrCanceled
+	}
+	return err
+}
+
+// organisation returns the organisation of the request
+// The statements of the repositories only read and write the rows of this organisation
+func organisation(ctx context.Context) (uuid.UUID, error) {
+	organisationID, ok := payments.OrganisationFromContext(ctx)
+	if !ok {
+		return uuid.Nil, payments.ErrNoOrganisation
+	}
+	return organisationID, nil
+}
+
+// ctxDB runs the statements of gorm with a context
+type ctxDB struct {
+	ctx context.Context
+	db  *sql.DB
+}
+
+func (c ctxDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c ctxDB) Prepare(query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(c.ctx, query)
+}
+
+func (c ctxDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c ctxDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+// ctxTx runs the statements of gorm in a transaction with a context
+// gorm commits and rolls back the transaction through Commit and Rollback
+type ctxTx struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+func (c ctxTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.tx.ExecContext(c.ctx, query, args...)
+}
+
+func (c ctxTx) Prepare(query string) (*sql.Stmt, error) {
+	return c.tx.PrepareContext(c.ctx, query)
+}
+
+func (c ctxTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.tx.QueryContext(c.ctx, query, args...)
+}
+
+func (c ctxTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.tx.QueryRowContext(c.ctx, query, args...)
+}
+
+func (c ctxTx) Commit() error {
+	return c.tx.Commit()
+}
+
+func (c ctxTx) Rollback() error {
+	return c.tx.Rollback()
+}
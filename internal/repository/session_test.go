@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/cedric-parisi/payment-api/internal/models"
+)
+
+func Test_database_session(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	db, _ := gorm.Open("postgres", mockDB)
+	d := database{db: db}
+
+	ctx := context.Background()
+	session := d.session(ctx)
+	conn, ok := session.CommonDB().(ctxDB)
+	if assert.True(t, ok, "the session runs its statements with the context") {
+		assert.Equal(t, ctx, conn.ctx)
+	}
+	assert.Equal(t, "postgres", session.Dialect().GetName())
+	_, shared := db.CommonDB().(ctxDB)
+	assert.False(t, shared, "the shared handle keeps its connection")
+
+	mock.ExpectQuery(`SELECT \* FROM "payments"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	err := d.read(ctx, func(db *gorm.DB) error {
+		return db.Find(&[]*models.Payment{}).Error
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/cedric-parisi/payment-api/internal/payments"
+)
+
+type unitOfWork struct {
+	database
+}
+
+// NewUnitOfWork ...
+func NewUnitOfWork(db *gorm.DB, options Options) payments.UnitOfWork {
+	return &unitOfWork{
+		database: database{
+			db:      db,
+			options: options,
+		},
+	}
+}
+
+// Do runs fn with repositories bound to a single transaction
+// The transaction is bounded by the write timeout
+func (u unitOfWork) Do(ctx context.Context, fn func(r payments.Repositories) error) error {
+	return u.write(ctx, func(tx *gorm.DB) error {
+		return fn(payments.Repositories{
+			Payments:    NewPaymentRepository(tx, u.options),
+			Idempotency: NewIdempotencyRepository(tx, u.options),
+			Audit:       NewAuditRepository(tx, u.options),
+		})
+	})
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS sponsor_parties;
+DROP TABLE IF EXISTS fxes;
+DROP TABLE IF EXISTS debtor_parties;
+DROP TABLE IF EXISTS sender_charges;
+DROP TABLE IF EXISTS charges_informations;
+DROP TABLE IF EXISTS beneficiary_parties;
+DROP TABLE IF EXISTS attributes;
+DROP TABLE IF EXISTS payments;
@@ -0,0 +1,87 @@
+-- Baseline of the schema previously created by gorm AutoMigrate
+-- IF NOT EXISTS lets databases created by AutoMigrate adopt the migrations
+CREATE TABLE IF NOT EXISTS payments (
+    id uuid PRIMARY KEY,
+    type text,
+    status text NOT NULL DEFAULT 'pending',
+    version integer,
+    organisation_id uuid,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone
+);
+
+CREATE TABLE IF NOT EXISTS attributes (
+    id uuid PRIMARY KEY,
+    payment_id uuid,
+    amount text,
+    currency text,
+    end_to_end_reference text,
+    numeric_reference text,
+    payment_purpose text,
+    payment_scheme text,
+    payment_type text,
+    processing_date text,
+    reference text,
+    scheme_payment_sub_type text,
+    scheme_payment_type text
+);
+
+CREATE TABLE IF NOT EXISTS beneficiary_parties (
+    attribute_id uuid,
+    account_name text,
+    account_number text,
+    account_number_code text,
+    account_type integer,
+    address text,
+    bank_id text,
+    bank_id_code text,
+    name text
+);
+
+CREATE TABLE IF NOT EXISTS charges_informations (
+    id uuid PRIMARY KEY,
+    attribute_id uuid,
+    bearer_code text,
+    receiver_charges_amount text,
+    receiver_charges_currency text
+);
+
+CREATE TABLE IF NOT EXISTS sender_charges (
+    charges_information_id uuid,
+    amount text,
+    currency text
+);
+
+CREATE TABLE IF NOT EXISTS debtor_parties (
+    attribute_id uuid,
+    account_name text,
+    account_number text,
+    account_number_code text,
+    address text,
+    bank_id text,
+    bank_id_code text,
+    name text
+);
+
+CREATE TABLE IF NOT EXISTS fxes (
+    attribute_id uuid,
+    contract_reference text,
+    exchange_rate text,
+    original_amount text,
+    original_currency text
+);
+
+CREATE TABLE IF NOT EXISTS sponsor_parties (
+    attribute_id uuid,
+    account_number text,
+    bank_id text,
+    bank_id_code text
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key text PRIMARY KEY,
+    fingerprint text NOT NULL,
+    response text,
+    created_at timestamp with time zone
+);
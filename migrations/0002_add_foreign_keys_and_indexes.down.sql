@@ -0,0 +1,48 @@
+DROP INDEX IF EXISTS payments_created_at_id_idx;
+DROP INDEX IF EXISTS payments_organisation_id_idx;
+
+DROP INDEX IF EXISTS sponsor_parties_attribute_id_idx;
+DROP INDEX IF EXISTS fxes_attribute_id_idx;
+DROP INDEX IF EXISTS debtor_parties_attribute_id_idx;
+DROP INDEX IF EXISTS sender_charges_charges_information_id_idx;
+DROP INDEX IF EXISTS charges_informations_attribute_id_idx;
+DROP INDEX IF EXISTS beneficiary_parties_attribute_id_idx;
+DROP INDEX IF EXISTS attributes_payment_id_idx;
+
+ALTER TABLE sponsor_parties
+    DROP CONSTRAINT IF EXISTS sponsor_parties_attribute_id_fkey,
+    ALTER COLUMN attribute_id DROP NOT NULL;
+ALTER TABLE fxes
+    DROP CONSTRAINT IF EXISTS fxes_attribute_id_fkey,
+    ALTER COLUMN attribute_id DROP NOT NULL;
+ALTER TABLE debtor_parties
+    DROP CONSTRAINT IF EXISTS debtor_parties_attribute_id_fkey,
+    ALTER COLUMN attribute_id DROP NOT NULL;
+ALTER TABLE sender_charges
+    DROP CONSTRAINT IF EXISTS sender_charges_charges_information_id_fkey,
+    ALTER COLUMN charges_information_id DROP NOT NULL;
+ALTER TABLE charges_informations
+    DROP CONSTRAINT IF EXISTS charges_informations_attribute_id_fkey,
+    ALTER COLUMN attribute_id DROP NOT NULL;
+ALTER TABLE beneficiary_parties
+    DROP CONSTRAINT IF EXISTS beneficiary_parties_attribute_id_fkey,
+    ALTER COLUMN attribute_id DROP NOT NULL;
+ALTER TABLE attributes
+    DROP CONSTRAINT IF EXISTS attributes_payment_id_fkey,
+    ALTER COLUMN payment_id DROP NOT NULL;
+
+-- The rows moved aside by the up migration are restored
+INSERT INTO attributes SELECT * FROM orphaned_attributes;
+DROP TABLE orphaned_attributes;
+INSERT INTO beneficiary_parties SELECT * FROM orphaned_beneficiary_parties;
+DROP TABLE orphaned_beneficiary_parties;
+INSERT INTO charges_informations SELECT * FROM orphaned_charges_informations;
+DROP TABLE orphaned_charges_informations;
+INSERT INTO debtor_parties SELECT * FROM orphaned_debtor_parties;
+DROP TABLE orphaned_debtor_parties;
+INSERT INTO fxes SELECT * FROM orphaned_fxes;
+DROP TABLE orphaned_fxes;
+INSERT INTO sponsor_parties SELECT * FROM orphaned_sponsor_parties;
+DROP TABLE orphaned_sponsor_parties;
+INSERT INTO sender_charges SELECT * FROM orphaned_sender_charges;
+DROP TABLE orphaned_sender_charges;
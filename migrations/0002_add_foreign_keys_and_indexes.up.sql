@@ -0,0 +1,102 @@
+-- Payments are soft deleted, their rows and children stay in place.
+-- ON DELETE CASCADE only applies when a payment row is actually removed,
+-- e.g. by a purge, so that no child can outlive its payment.
+
+-- Rows left without parent by the schema without constraints would break
+-- the foreign keys, they are moved to orphaned_<table> tables with the same
+-- columns instead of being deleted. Parents are moved before their children
+-- so that the children of a moved row follow it. The down migration moves
+-- them back.
+CREATE TABLE orphaned_attributes (LIKE attributes);
+WITH moved AS (
+    DELETE FROM attributes WHERE payment_id IS NULL
+        OR payment_id NOT IN (SELECT id FROM payments)
+    RETURNING *
+)
+INSERT INTO orphaned_attributes SELECT * FROM moved;
+CREATE TABLE orphaned_beneficiary_parties (LIKE beneficiary_parties);
+WITH moved AS (
+    DELETE FROM beneficiary_parties WHERE attribute_id IS NULL
+        OR attribute_id NOT IN (SELECT id FROM attributes)
+    RETURNING *
+)
+INSERT INTO orphaned_beneficiary_parties SELECT * FROM moved;
+CREATE TABLE orphaned_charges_informations (LIKE charges_informations);
+WITH moved AS (
+    DELETE FROM charges_informations WHERE attribute_id IS NULL
+        OR attribute_id NOT IN (SELECT id FROM attributes)
+    RETURNING *
+)
+INSERT INTO orphaned_charges_informations SELECT * FROM moved;
+CREATE TABLE orphaned_debtor_parties (LIKE debtor_parties);
+WITH moved AS (
+    DELETE FROM debtor_parties WHERE attribute_id IS NULL
+        OR attribute_id NOT IN (SELECT id FROM attributes)
+    RETURNING *
+)
+INSERT INTO orphaned_debtor_parties SELECT * FROM moved;
+CREATE TABLE orphaned_fxes (LIKE fxes);
+WITH moved AS (
+    DELETE FROM fxes WHERE attribute_id IS NULL
+        OR attribute_id NOT IN (SELECT id FROM attributes)
+    RETURNING *
+)
+INSERT INTO orphaned_fxes SELECT * FROM moved;
+CREATE TABLE orphaned_sponsor_parties (LIKE sponsor_parties);
+WITH moved AS (
+    DELETE FROM sponsor_parties WHERE attribute_id IS NULL
+        OR attribute_id NOT IN (SELECT id FROM attributes)
+    RETURNING *
+)
+INSERT INTO orphaned_sponsor_parties SELECT * FROM moved;
+CREATE TABLE orphaned_sender_charges (LIKE sender_charges);
+WITH moved AS (
+    DELETE FROM sender_charges WHERE charges_information_id IS NULL
+        OR charges_information_id NOT IN (SELECT id FROM charges_informations)
+    RETURNING *
+)
+INSERT INTO orphaned_sender_charges SELECT * FROM moved;
+
+ALTER TABLE attributes
+    ALTER COLUMN payment_id SET NOT NULL,
+    ADD CONSTRAINT attributes_payment_id_fkey
+        FOREIGN KEY (payment_id) REFERENCES payments (id) ON DELETE CASCADE;
+ALTER TABLE beneficiary_parties
+    ALTER COLUMN attribute_id SET NOT NULL,
+    ADD CONSTRAINT beneficiary_parties_attribute_id_fkey
+        FOREIGN KEY (attribute_id) REFERENCES attributes (id) ON DELETE CASCADE;
+ALTER TABLE charges_informations
+    ALTER COLUMN attribute_id SET NOT NULL,
+    ADD CONSTRAINT charges_informations_attribute_id_fkey
+        FOREIGN KEY (attribute_id) REFERENCES attributes (id) ON DELETE CASCADE;
+ALTER TABLE sender_charges
+    ALTER COLUMN charges_information_id SET NOT NULL,
+    ADD CONSTRAINT sender_charges_charges_information_id_fkey
+        FOREIGN KEY (charges_information_id) REFERENCES charges_informations (id) ON DELETE CASCADE;
+ALTER TABLE debtor_parties
+    ALTER COLUMN attribute_id SET NOT NULL,
+    ADD CONSTRAINT debtor_parties_attribute_id_fkey
+        FOREIGN KEY (attribute_id) REFERENCES attributes (id) ON DELETE CASCADE;
+ALTER TABLE fxes
+    ALTER COLUMN attribute_id SET NOT NULL,
+    ADD CONSTRAINT fxes_attribute_id_fkey
+        FOREIGN KEY (attribute_id) REFERENCES attributes (id) ON DELETE CASCADE;
+ALTER TABLE sponsor_parties
+    ALTER COLUMN attribute_id SET NOT NULL,
+    ADD CONSTRAINT sponsor_parties_attribute_id_fkey
+        FOREIGN KEY (attribute_id) REFERENCES attributes (id) ON DELETE CASCADE;
+
+-- Postgres does not index the referencing columns, getRelated and
+-- loadRelated look the children up by them
+CREATE INDEX attributes_payment_id_idx ON attributes (payment_id);
+CREATE INDEX beneficiary_parties_attribute_id_idx ON beneficiary_parties (attribute_id);
+CREATE INDEX charges_informations_attribute_id_idx ON charges_informations (attribute_id);
+CREATE INDEX sender_charges_charges_information_id_idx ON sender_charges (charges_information_id);
+CREATE INDEX debtor_parties_attribute_id_idx ON debtor_parties (attribute_id);
+CREATE INDEX fxes_attribute_id_idx ON fxes (attribute_id);
+CREATE INDEX sponsor_parties_attribute_id_idx ON sponsor_parties (attribute_id);
+
+-- The list filters on organisation_id and pages on the default sort
+-- created_at with id as tie-break, deleted payments are never listed
+CREATE INDEX payments_organisation_id_idx ON payments (organisation_id) WHERE deleted_at IS NULL;
+CREATE INDEX payments_created_at_id_idx ON payments (created_at, id) WHERE deleted_at IS NULL;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS attributes_amount_idx;
+
+ALTER TABLE fxes
+    ALTER COLUMN original_amount TYPE text USING original_amount::text,
+    ALTER COLUMN exchange_rate TYPE text USING exchange_rate::text;
+ALTER TABLE sender_charges
+    ALTER COLUMN amount TYPE text USING amount::text;
+ALTER TABLE charges_informations
+    ALTER COLUMN receiver_charges_amount TYPE text USING receiver_charges_amount::text;
+ALTER TABLE attributes
+    ALTER COLUMN amount TYPE text USING amount::text;
@@ -0,0 +1,15 @@
+-- NUMERIC without precision keeps the scale of each value, 5.00 is read back as 5.00
+-- Empty strings were unset amounts and become NULL
+-- The migration fails if a stored amount is not a decimal number
+ALTER TABLE attributes
+    ALTER COLUMN amount TYPE numeric USING NULLIF(amount, '')::numeric;
+ALTER TABLE charges_informations
+    ALTER COLUMN receiver_charges_amount TYPE numeric USING NULLIF(receiver_charges_amount, '')::numeric;
+ALTER TABLE sender_charges
+    ALTER COLUMN amount TYPE numeric USING NULLIF(amount, '')::numeric;
+ALTER TABLE fxes
+    ALTER COLUMN exchange_rate TYPE numeric USING NULLIF(exchange_rate, '')::numeric,
+    ALTER COLUMN original_amount TYPE numeric USING NULLIF(original_amount, '')::numeric;
+
+-- Amounts can be filtered and sorted on
+CREATE INDEX attributes_amount_idx ON attributes (amount);
@@ -0,0 +1,29 @@
+-- The audit log has no foreign key to payments so that the history
+-- of a payment outlives its row, e.g. after a purge.
+CREATE TABLE IF NOT EXISTS audit_entries (
+    id uuid PRIMARY KEY,
+    payment_id uuid NOT NULL,
+    action text NOT NULL,
+    actor text NOT NULL,
+    request_id text NOT NULL,
+    version integer NOT NULL,
+    changes jsonb NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
+-- The history of a payment is read oldest first
+CREATE INDEX audit_entries_payment_id_created_at_idx ON audit_entries (payment_id, created_at);
+
+-- Entries are only appended
+CREATE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit entries cannot be updated or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_entries_append_only
+    BEFORE UPDATE OR DELETE ON audit_entries
+    FOR EACH ROW EXECUTE PROCEDURE audit_entries_append_only();
+CREATE TRIGGER audit_entries_no_truncate
+    BEFORE TRUNCATE ON audit_entries
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_entries_append_only();
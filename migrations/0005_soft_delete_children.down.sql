@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS payments_deleted_at_idx;
+
+ALTER TABLE sponsor_parties DROP COLUMN deleted_at;
+ALTER TABLE fxes DROP COLUMN deleted_at;
+ALTER TABLE debtor_parties DROP COLUMN deleted_at;
+ALTER TABLE sender_charges DROP COLUMN deleted_at;
+ALTER TABLE charges_informations DROP COLUMN deleted_at;
+ALTER TABLE beneficiary_parties DROP COLUMN deleted_at;
+ALTER TABLE attributes DROP COLUMN deleted_at;
@@ -0,0 +1,34 @@
+-- The children of a payment are soft deleted and restored along with it
+ALTER TABLE attributes ADD COLUMN deleted_at timestamp with time zone;
+ALTER TABLE beneficiary_parties ADD COLUMN deleted_at timestamp with time zone;
+ALTER TABLE charges_informations ADD COLUMN deleted_at timestamp with time zone;
+ALTER TABLE sender_charges ADD COLUMN deleted_at timestamp with time zone;
+ALTER TABLE debtor_parties ADD COLUMN deleted_at timestamp with time zone;
+ALTER TABLE fxes ADD COLUMN deleted_at timestamp with time zone;
+ALTER TABLE sponsor_parties ADD COLUMN deleted_at timestamp with time zone;
+
+-- The children of the payments deleted before get their deleted_at
+UPDATE attributes SET deleted_at = payments.deleted_at
+    FROM payments
+    WHERE payments.id = attributes.payment_id AND payments.deleted_at IS NOT NULL;
+UPDATE beneficiary_parties SET deleted_at = attributes.deleted_at
+    FROM attributes
+    WHERE attributes.id = beneficiary_parties.attribute_id AND attributes.deleted_at IS NOT NULL;
+UPDATE charges_informations SET deleted_at = attributes.deleted_at
+    FROM attributes
+    WHERE attributes.id = charges_informations.attribute_id AND attributes.deleted_at IS NOT NULL;
+UPDATE sender_charges SET deleted_at = charges_informations.deleted_at
+    FROM charges_informations
+    WHERE charges_informations.id = sender_charges.charges_information_id AND charges_informations.deleted_at IS NOT NULL;
+UPDATE debtor_parties SET deleted_at = attributes.deleted_at
+    FROM attributes
+    WHERE attributes.id = debtor_parties.attribute_id AND attributes.deleted_at IS NOT NULL;
+UPDATE fxes SET deleted_at = attributes.deleted_at
+    FROM attributes
+    WHERE attributes.id = fxes.attribute_id AND attributes.deleted_at IS NOT NULL;
+UPDATE sponsor_parties SET deleted_at = attributes.deleted_at
+    FROM attributes
+    WHERE attributes.id = sponsor_parties.attribute_id AND attributes.deleted_at IS NOT NULL;
+
+-- The purge looks the payments up by their deletion time
+CREATE INDEX payments_deleted_at_idx ON payments (deleted_at) WHERE deleted_at IS NOT NULL;
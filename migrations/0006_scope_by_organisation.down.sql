@@ -0,0 +1,10 @@
+-- The same key used by several organisations is kept once
+DELETE FROM idempotency_keys duplicate
+    USING idempotency_keys kept
+    WHERE duplicate.key = kept.key AND duplicate.organisation_id > kept.organisation_id;
+ALTER TABLE idempotency_keys
+    DROP CONSTRAINT idempotency_keys_pkey,
+    DROP COLUMN organisation_id,
+    ADD PRIMARY KEY (key);
+
+ALTER TABLE audit_entries DROP COLUMN organisation_id;
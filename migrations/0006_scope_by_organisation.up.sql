@@ -0,0 +1,32 @@
+-- Every payment request is scoped to the organisation of the caller
+
+-- The audit entries carry the organisation of their payment
+ALTER TABLE audit_entries ADD COLUMN organisation_id uuid;
+
+-- The backfill is the only update the append-only trigger lets through
+ALTER TABLE audit_entries DISABLE TRIGGER audit_entries_append_only;
+UPDATE audit_entries SET organisation_id = payments.organisation_id
+    FROM payments
+    WHERE payments.id = audit_entries.payment_id;
+-- The purged payments are gone, the organisation of their entries is the last one recorded in the changes
+UPDATE audit_entries SET organisation_id = recorded.organisation_id
+    FROM (
+        SELECT DISTINCT ON (entries.payment_id) entries.payment_id,
+            COALESCE(change->>'after', change->>'before')::uuid AS organisation_id
+        FROM audit_entries entries, jsonb_array_elements(entries.changes) change
+        WHERE change->>'path' = '/organisation_id'
+        ORDER BY entries.payment_id, entries.created_at DESC
+    ) recorded
+    WHERE recorded.payment_id = audit_entries.payment_id AND audit_entries.organisation_id IS NULL;
+ALTER TABLE audit_entries ENABLE TRIGGER audit_entries_append_only;
+
+-- The idempotency keys are scoped to the organisation of the caller
+ALTER TABLE idempotency_keys ADD COLUMN organisation_id uuid;
+UPDATE idempotency_keys SET organisation_id = (response::jsonb->>'organisation_id')::uuid
+    WHERE response IS NOT NULL AND response <> '';
+-- The keys still reserved have no response to tell their organisation, their requests are retried with a new key
+DELETE FROM idempotency_keys WHERE organisation_id IS NULL;
+ALTER TABLE idempotency_keys
+    DROP CONSTRAINT idempotency_keys_pkey,
+    ALTER COLUMN organisation_id SET NOT NULL,
+    ADD PRIMARY KEY (organisation_id, key);
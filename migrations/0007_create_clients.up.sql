@@ -0,0 +1,12 @@
+-- API clients authenticate with their id and secret, only the hash of the
+-- secret is stored. A revoked client is kept so that its id is never reused.
+CREATE TABLE IF NOT EXISTS clients (
+    id text PRIMARY KEY,
+    name text NOT NULL,
+    organisation_id uuid NOT NULL,
+    scope text NOT NULL,
+    secret_hash text NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    rotated_at timestamp with time zone,
+    revoked_at timestamp with time zone
+);
@@ -0,0 +1,3 @@
+-- The token identifies the reservation of the request processing a key,
+-- a request whose expired reservation was taken over cannot complete it
+ALTER TABLE idempotency_keys ADD COLUMN token uuid;
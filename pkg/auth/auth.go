@@ -7,6 +7,15 @@ import (
 
 	jwt "github.com/dgrijalva/jwt-go"
 	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/google/uuid"
+
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+)
+
+const (
+	invalidClientCode  = "invalid_client"
+	clientNotFoundCode = "client_not_found"
+	unknownErrorCode   = "unknown_error"
 )
 
 var (
@@ -22,42 +31,138 @@ var (
 	ErrJWTNotFound = errors.New("cannot retrieve token from context")
 )
 
+// Claims are the claims of the issued tokens
+// OrganisationID is the organisation the subject acts for, every payment request is scoped to it
+// Scope lists the scopes granted to the subject separated by spaces, see ScopeMiddleware
+type Claims struct {
+	OrganisationID string `json:"organisation_id,omitempty"`
+	Scope          string `json:"scope,omitempty"`
+	jwt.StandardClaims
+}
+
+// ClaimsFactory makes the claims parsed by the JWT middleware
+func ClaimsFactory() jwt.Claims {
+	return &Claims{}
+}
+
 type auth struct {
 	tokenDuration time.Duration
 	signingKey    []byte
 	keyFunc       jwt.Keyfunc
+	clients       ClientRepository
 }
 
 // Service ...
 type Service interface {
-	// Generate a token
-	GetJWT(id string) (string, error)
+	// Generate a token for the credentials of a client
+	GetJWT(ctx context.Context, clientID string, clientSecret string) (string, error)
+
+	// Register a client, returns its secret
+	CreateClient(ctx context.Context, client *Client) (string, error)
+
+	// Replace the secret of a client, returns the new secret
+	RotateClientSecret(ctx context.Context, id string) (string, error)
+
+	// Revoke a client, it gets no more token
+	RevokeClient(ctx context.Context, id string) error
 
 	// Get the sub from the token
 	ExtractSubFromContext(ctx context.Context) (string, error)
 }
 
 // NewService ...
-func NewService(tokendDuration time.Duration, key []byte, keyFunc jwt.Keyfunc) Service {
+// clients stores the API clients allowed to get tokens
+func NewService(tokendDuration time.Duration, key []byte, keyFunc jwt.Keyfunc, clients ClientRepository) Service {
 	return auth{
 		tokenDuration: tokendDuration,
 		signingKey:    key,
 		keyFunc:       keyFunc,
+		clients:       clients,
 	}
 }
 
-// GetJWT returns a token
-func (a auth) GetJWT(id string) (string, error) {
-	claims := jwt.StandardClaims{
-		Subject:   id,
-		ExpiresAt: time.Now().Add(time.Second * a.tokenDuration).Unix(),
-		IssuedAt:  jwt.TimeFunc().Unix(),
+// GetJWT returns a token carrying the organisation and the scope of the client
+// Returns ErrUnknowCredentials for an unknown or revoked client and a wrong secret
+func (a auth) GetJWT(ctx context.Context, clientID string, clientSecret string) (string, error) {
+	client, err := a.clients.GetClient(ctx, clientID)
+	if err == ErrClientNotFound {
+		return "", ErrUnknowCredentials
+	}
+	if err != nil {
+		return "", err
+	}
+	if !client.authenticates(clientSecret) {
+		return "", ErrUnknowCredentials
+	}
+
+	claims := Claims{
+		OrganisationID: client.OrganisationID,
+		Scope:          client.Scope,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   client.ID,
+			ExpiresAt: time.Now().Add(time.Second * a.tokenDuration).Unix(),
+			IssuedAt:  jwt.TimeFunc().Unix(),
+		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(a.signingKey)
 }
 
+// CreateClient registers a client with a new id and secret
+// The secret is only returned here, the client keeps its hash
+func (a auth) CreateClient(ctx context.Context, client *Client) (string, error) {
+	if err := client.validate(); err != nil {
+		return "", errorhandling.InvalidRequest(invalidClientCode, err)
+	}
+
+	secret, hash, err := newSecret()
+	if err != nil {
+		return "", errorhandling.Internal(unknownErrorCode, err)
+	}
+	client.ID = uuid.New().String()
+	client.SecretHash = hash
+	client.CreatedAt = time.Now().UTC()
+	client.RotatedAt = nil
+	client.RevokedAt = nil
+
+	if err := a.clients.InsertClient(ctx, client); err != nil {
+		return "", errorhandling.Internal(unknownErrorCode, err)
+	}
+	return secret, nil
+}
+
+// RotateClientSecret replaces the secret of an active client
+// The previous secret gets no more token, the tokens already issued stay valid until they expire
+func (a auth) RotateClientSecret(ctx context.Context, id string) (string, error) {
+	secret, hash, err := newSecret()
+	if err != nil {
+		return "", errorhandling.Internal(unknownErrorCode, err)
+	}
+
+	if err := a.clients.UpdateClientSecret(ctx, id, hash, time.Now().UTC()); err != nil {
+		return "", clientError(err)
+	}
+	return secret, nil
+}
+
+// RevokeClient revokes an active client
+// The client gets no more token, the tokens already issued stay valid until they expire
+func (a auth) RevokeClient(ctx context.Context, id string) error {
+	if err := a.clients.RevokeClient(ctx, id, time.Now().UTC()); err != nil {
+		return clientError(err)
+	}
+	return nil
+}
+
+// clientError converts an error of the client repository to an api error
+func clientError(err error) error {
+	if err == ErrClientNotFound {
+		return errorhandling.NotFound(clientNotFoundCode, err)
+	}
+	return errorhandling.Internal(unknownErrorCode, err)
+}
+
 // ExtractUserID retrieves the user id from the token
 func (a auth) ExtractSubFromContext(ctx context.Context) (string, error) {
 	ownertoken := ctx.Value(kitjwt.JWTTokenContextKey)
@@ -0,0 +1,231 @@
+// +build !integration
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testOrganisationID = "743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb"
+
+var (
+	testKey     = []byte("signingkey")
+	testKeyFunc = func(*jwt.Token) (interface{}, error) { return testKey, nil }
+)
+
+func Test_auth_GetJWT(t *testing.T) {
+	revokedAt := time.Now()
+	tests := []struct {
+		name      string
+		secret    string
+		wantErr   error
+		mockCalls func(m *MockClientRepository)
+	}{
+		{
+			name:   "token carries the organisation and the scope of the client",
+			secret: "secret",
+			mockCalls: func(m *MockClientRepository) {
+				m.On("GetClient", mock.Anything, "cedric").Return(&Client{
+					ID:             "cedric",
+					OrganisationID: testOrganisationID,
+					Scope:          "payments:read payments:write",
+					SecretHash:     HashSecret("secret"),
+				}, nil)
+			},
+		},
+		{
+			name:    "wrong secret gets no token",
+			secret:  "guess",
+			wantErr: ErrUnknowCredentials,
+			mockCalls: func(m *MockClientRepository) {
+				m.On("GetClient", mock.Anything, "cedric").Return(&Client{ID: "cedric", SecretHash: HashSecret("secret")}, nil)
+			},
+		},
+		{
+			name:    "revoked client gets no token",
+			secret:  "secret",
+			wantErr: ErrUnknowCredentials,
+			mockCalls: func(m *MockClientRepository) {
+				m.On("GetClient", mock.Anything, "cedric").Return(&Client{ID: "cedric", SecretHash: HashSecret("secret"), RevokedAt: &revokedAt}, nil)
+			},
+		},
+		{
+			name:    "unknown client gets no token",
+			secret:  "secret",
+			wantErr: ErrUnknowCredentials,
+			mockCalls: func(m *MockClientRepository) {
+				m.On("GetClient", mock.Anything, "cedric").Return(nil, ErrClientNotFound)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MockClientRepository{}
+			tt.mockCalls(m)
+			a := NewService(500, testKey, testKeyFunc, m)
+
+			token, err := a.GetJWT(context.Background(), "cedric", tt.secret)
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr != nil {
+				return
+			}
+			claims := &Claims{}
+			_, err = jwt.ParseWithClaims(token, claims, testKeyFunc)
+			assert.NoError(t, err)
+			assert.Equal(t, "cedric", claims.Subject)
+			assert.Equal(t, testOrganisationID, claims.OrganisationID)
+			assert.Equal(t, "payments:read payments:write", claims.Scope)
+		})
+	}
+}
+
+func Test_auth_CreateClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     *Client
+		wantScope  string
+		wantStatus int
+		mockCalls  func(m *MockClientRepository)
+	}{
+		{
+			name:      "client is stored with the hash of its secret",
+			client:    &Client{Name: "ops", OrganisationID: testOrganisationID, Scope: " payments:read  admin "},
+			wantScope: "payments:read admin",
+			mockCalls: func(m *MockClientRepository) {
+				m.On("InsertClient", mock.Anything, mock.AnythingOfType("*auth.Client")).Return(nil)
+			},
+		},
+		{
+			name:       "name is required",
+			client:     &Client{OrganisationID: testOrganisationID},
+			wantStatus: http.StatusBadRequest,
+			mockCalls:  func(m *MockClientRepository) {},
+		},
+		{
+			name:       "organisation must be a uuid",
+			client:     &Client{Name: "ops", OrganisationID: "acme"},
+			wantStatus: http.StatusBadRequest,
+			mockCalls:  func(m *MockClientRepository) {},
+		},
+		{
+			name:       "unknown scope is refused",
+			client:     &Client{Name: "ops", OrganisationID: testOrganisationID, Scope: "payments:everything"},
+			wantStatus: http.StatusBadRequest,
+			mockCalls:  func(m *MockClientRepository) {},
+		},
+		{
+			name:       "storage failure",
+			client:     &Client{Name: "ops", OrganisationID: testOrganisationID},
+			wantStatus: http.StatusInternalServerError,
+			mockCalls: func(m *MockClientRepository) {
+				m.On("InsertClient", mock.Anything, mock.AnythingOfType("*auth.Client")).Return(errors.New("failed"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MockClientRepository{}
+			tt.mockCalls(m)
+			a := NewService(500, testKey, testKeyFunc, m)
+
+			secret, err := a.CreateClient(context.Background(), tt.client)
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, tt.client.ID)
+			assert.Equal(t, tt.wantScope, tt.client.Scope)
+			assert.Equal(t, HashSecret(secret), tt.client.SecretHash)
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_auth_RotateClientSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantStatus int
+		mockCalls  func(m *MockClientRepository)
+	}{
+		{
+			name: "hash of the new secret is stored",
+			mockCalls: func(m *MockClientRepository) {
+				m.On("UpdateClientSecret", mock.Anything, "cedric", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+			},
+		},
+		{
+			name:       "unknown or revoked client is not found",
+			wantStatus: http.StatusNotFound,
+			mockCalls: func(m *MockClientRepository) {
+				m.On("UpdateClientSecret", mock.Anything, "cedric", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(ErrClientNotFound)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MockClientRepository{}
+			tt.mockCalls(m)
+			a := NewService(500, testKey, testKeyFunc, m)
+
+			secret, err := a.RotateClientSecret(context.Background(), "cedric")
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			m.AssertCalled(t, "UpdateClientSecret", mock.Anything, "cedric", HashSecret(secret), mock.AnythingOfType("time.Time"))
+		})
+	}
+}
+
+func Test_auth_RevokeClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantStatus int
+		mockCalls  func(m *MockClientRepository)
+	}{
+		{
+			name: "active client is revoked",
+			mockCalls: func(m *MockClientRepository) {
+				m.On("RevokeClient", mock.Anything, "cedric", mock.AnythingOfType("time.Time")).Return(nil)
+			},
+		},
+		{
+			name:       "unknown or revoked client is not found",
+			wantStatus: http.StatusNotFound,
+			mockCalls: func(m *MockClientRepository) {
+				m.On("RevokeClient", mock.Anything, "cedric", mock.AnythingOfType("time.Time")).Return(ErrClientNotFound)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MockClientRepository{}
+			tt.mockCalls(m)
+			a := NewService(500, testKey, testKeyFunc, m)
+
+			err := a.RevokeClient(context.Background(), "cedric")
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -3,8 +3,10 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/tracing/opentracing"
 
 	"github.com/gorilla/mux"
@@ -18,16 +20,39 @@ import (
 	stdopentracing "github.com/opentracing/opentracing-go"
 )
 
-type authRequest struct {
-	ID string `json:"id"`
+const (
+	unknownCredentialsCode = "unknown_credentials"
+	invalidRequestCode     = "invalid_request"
+	invalidTokenCode       = "invalid_authentication_token"
+)
+
+type tokenRequest struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
 }
 
-type authResponse struct {
+type tokenResponse struct {
 	Token string `json:"token"`
 }
 
-// MakeAuthHandler ...
-func MakeAuthHandler(service Service, errLogger kitlog.Logger, tracer stdopentracing.Tracer) http.Handler {
+type clientResponse struct {
+	*Client
+	ClientSecret string `json:"client_secret"`
+}
+
+// StatusCode of a created client
+func (clientResponse) StatusCode() int {
+	return http.StatusCreated
+}
+
+type clientSecretResponse struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// MakeAuthHandler serves the tokens and the administration of the API clients
+// The administration requires a token with the admin scope
+func MakeAuthHandler(service Service, JWTMiddleware endpoint.Middleware, errLogger kitlog.Logger, tracer stdopentracing.Tracer) http.Handler {
 	errLogger = kitlog.With(errLogger, "component", "auth")
 
 	options := []kithttp.ServerOption{
@@ -35,42 +60,128 @@ func MakeAuthHandler(service Service, errLogger kitlog.Logger, tracer stdopentra
 		kithttp.ServerErrorEncoder(errorEncoder(errLogger)),
 		kithttp.ServerBefore(kitjwt.HTTPToContext()),
 	}
+	admin := endpoint.Chain(JWTMiddleware, ScopeMiddleware(ScopeAdmin))
 
-	endpoint := func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(authRequest)
-		token, err := service.GetJWT(req.ID)
+	tokenEndpoint := func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(tokenRequest)
+		token, err := service.GetJWT(ctx, req.ClientID, req.ClientSecret)
 		if err != nil {
 			return nil, err
 		}
-		return authResponse{Token: token}, nil
+		return tokenResponse{Token: token}, nil
 	}
 
-	authHandler := instrumenting.Middleware("auth", "post-auth",
+	createClientEndpoint := admin(func(ctx context.Context, request interface{}) (interface{}, error) {
+		client := request.(*Client)
+		secret, err := service.CreateClient(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		return clientResponse{Client: client, ClientSecret: secret}, nil
+	})
+
+	rotateClientEndpoint := admin(func(ctx context.Context, request interface{}) (interface{}, error) {
+		id := request.(string)
+		secret, err := service.RotateClientSecret(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return clientSecretResponse{ClientID: id, ClientSecret: secret}, nil
+	})
+
+	revokeClientEndpoint := admin(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, service.RevokeClient(ctx, request.(string))
+	})
+
+	tokenHandler := instrumenting.Middleware("auth", "post-token",
+		kithttp.NewServer(
+			tokenEndpoint,
+			decodeTokenRequest,
+			kithttp.EncodeJSONResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "post-token", errLogger)))...,
+		),
+	)
+
+	createClientHandler := instrumenting.Middleware("auth", "post-client",
+		kithttp.NewServer(
+			createClientEndpoint,
+			decodeClientRequest,
+			kithttp.EncodeJSONResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "post-client", errLogger)))...,
+		),
+	)
+
+	rotateClientHandler := instrumenting.Middleware("auth", "rotate-client",
 		kithttp.NewServer(
-			endpoint,
-			decodeAuthRequest,
+			rotateClientEndpoint,
+			decodeClientIDRequest,
 			kithttp.EncodeJSONResponse,
-			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "auth", errLogger)))...,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "rotate-client", errLogger)))...,
 		),
 	)
+
+	revokeClientHandler := instrumenting.Middleware("auth", "revoke-client",
+		kithttp.NewServer(
+			revokeClientEndpoint,
+			decodeClientIDRequest,
+			encodeEmptyResponse,
+			append(options, kithttp.ServerBefore(opentracing.HTTPToContext(tracer, "revoke-client", errLogger)))...,
+		),
+	)
+
 	r := mux.NewRouter().PathPrefix("/auth/").Subrouter().StrictSlash(true)
 	{
-		r.Handle("/", errorhandling.RecoverFromPanic(errLogger, authHandler)).Methods(http.MethodPost)
+		r.Handle("/token", errorhandling.RecoverFromPanic(errLogger, tokenHandler)).Methods(http.MethodPost)
+		r.Handle("/clients", errorhandling.RecoverFromPanic(errLogger, createClientHandler)).Methods(http.MethodPost)
+		r.Handle("/clients/{id}/rotate", errorhandling.RecoverFromPanic(errLogger, rotateClientHandler)).Methods(http.MethodPost)
+		r.Handle("/clients/{id}", errorhandling.RecoverFromPanic(errLogger, revokeClientHandler)).Methods(http.MethodDelete)
 	}
 
 	return r
 }
 
-func decodeAuthRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var request authRequest
+func decodeTokenRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request tokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		return nil, err
+		return nil, errorhandling.InvalidRequest(invalidRequestCode, err)
 	}
 	return request, nil
 }
 
+func decodeClientRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	client := &Client{}
+	if err := json.NewDecoder(r.Body).Decode(client); err != nil {
+		return nil, errorhandling.InvalidRequest(invalidRequestCode, err)
+	}
+	return client, nil
+}
+
+func decodeClientIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok || id == "" {
+		return nil, errorhandling.InvalidRequest(invalidRequestCode, errors.New("missing client id"))
+	}
+	return id, nil
+}
+
+func encodeEmptyResponse(_ context.Context, w http.ResponseWriter, _ interface{}) error {
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 func errorEncoder(logger kitlog.Logger) kithttp.ErrorEncoder {
 	return func(ctx context.Context, err error, w http.ResponseWriter) {
+		switch err {
+		case ErrUnknowCredentials:
+			err = errorhandling.Unauthorized(unknownCredentialsCode, err)
+		case kitjwt.ErrTokenContextMissing, kitjwt.ErrTokenExpired, kitjwt.ErrTokenInvalid,
+			kitjwt.ErrTokenMalformed, kitjwt.ErrTokenNotActive, kitjwt.ErrUnexpectedSigningMethod:
+			err = errorhandling.Unauthorized(invalidTokenCode, err)
+		}
+		if _, ok := err.(kithttp.StatusCoder); !ok {
+			err = errorhandling.Internal(unknownErrorCode, err)
+			errorhandling.Log(ctx, err, logger)
+		}
 		kithttp.DefaultErrorEncoder(ctx, err, w)
 	}
 }
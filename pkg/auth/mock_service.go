@@ -12,6 +12,27 @@ type MockService struct {
 	mock.Mock
 }
 
+// CreateClient provides a mock function with given fields: ctx, client
+func (_m *MockService) CreateClient(ctx context.Context, client *Client) (string, error) {
+	ret := _m.Called(ctx, client)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, *Client) string); ok {
+		r0 = rf(ctx, client)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *Client) error); ok {
+		r1 = rf(ctx, client)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ExtractSubFromContext provides a mock function with given fields: ctx
 func (_m *MockService) ExtractSubFromContext(ctx context.Context) (string, error) {
 	ret := _m.Called(ctx)
@@ -33,20 +54,55 @@ func (_m *MockService) ExtractSubFromContext(ctx context.Context) (string, error
 	return r0, r1
 }
 
-// GetJWT provides a mock function with given fields: id
-func (_m *MockService) GetJWT(id string) (string, error) {
-	ret := _m.Called(id)
+// GetJWT provides a mock function with given fields: ctx, clientID, clientSecret
+func (_m *MockService) GetJWT(ctx context.Context, clientID string, clientSecret string) (string, error) {
+	ret := _m.Called(ctx, clientID, clientSecret)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, clientID, clientSecret)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, clientID, clientSecret)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeClient provides a mock function with given fields: ctx, id
+func (_m *MockService) RevokeClient(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RotateClientSecret provides a mock function with given fields: ctx, id
+func (_m *MockService) RotateClientSecret(ctx context.Context, id string) (string, error) {
+	ret := _m.Called(ctx, id)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(string) string); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, id)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/cedric-parisi/payment-api/pkg/errorhandling"
+)
+
+// Scopes granted to the tokens, a token carries them in its scope claim separated by spaces
+const (
+	// ScopePaymentsRead reads the payments, their history and their exports
+	ScopePaymentsRead = "payments:read"
+	// ScopePaymentsWrite creates, updates, patches and transitions the payments
+	ScopePaymentsWrite = "payments:write"
+	// ScopePaymentsDelete deletes and restores the payments
+	ScopePaymentsDelete = "payments:delete"
+	// ScopeAdmin runs the administration operations, e.g. the purge
+	ScopeAdmin = "admin"
+
+	insufficientScopeCode = "insufficient_scope"
+)
+
+var knownScopes = map[string]bool{
+	ScopePaymentsRead:   true,
+	ScopePaymentsWrite:  true,
+	ScopePaymentsDelete: true,
+	ScopeAdmin:          true,
+}
+
+// HasScope tells whether the claims grant the scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, granted := range strings.Fields(c.Scope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeMiddleware only lets through the requests whose token grants every scope
+// It runs after the JWT middleware, the other requests are forbidden
+func ScopeMiddleware(scopes ...string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims, _ := ctx.Value(kitjwt.JWTClaimsContextKey).(*Claims)
+			for _, scope := range scopes {
+				if claims == nil || !claims.HasScope(scope) {
+					return nil, errorhandling.Forbidden(insufficientScopeCode, fmt.Errorf("the token lacks the scope %s", scope))
+				}
+			}
+			return next(ctx, request)
+		}
+	}
+}
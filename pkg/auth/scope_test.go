@@ -0,0 +1,80 @@
+// +build !integration
+
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     jwt.Claims
+		scopes     []string
+		wantStatus int
+	}{
+		{
+			name:   "granted scope is let through",
+			claims: &Claims{Scope: "payments:read payments:write"},
+			scopes: []string{ScopePaymentsWrite},
+		},
+		{
+			name:   "every scope granted is let through",
+			claims: &Claims{Scope: "payments:read payments:delete"},
+			scopes: []string{ScopePaymentsRead, ScopePaymentsDelete},
+		},
+		{
+			name:       "missing scope is forbidden",
+			claims:     &Claims{Scope: "payments:read"},
+			scopes:     []string{ScopePaymentsRead, ScopePaymentsDelete},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "scope prefix is not granted",
+			claims:     &Claims{Scope: "payments:readonly"},
+			scopes:     []string{ScopePaymentsRead},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "token without scope is forbidden",
+			claims:     &Claims{},
+			scopes:     []string{ScopeAdmin},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "standard claims are forbidden",
+			claims:     &jwt.StandardClaims{Subject: "cedric"},
+			scopes:     []string{ScopePaymentsRead},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			next := func(ctx context.Context, request interface{}) (interface{}, error) {
+				return "ok", nil
+			}
+			ctx := context.WithValue(context.Background(), kitjwt.JWTClaimsContextKey, tt.claims)
+
+			// Act
+			got, err := ScopeMiddleware(tt.scopes...)(next)(ctx, nil)
+
+			// Assert
+			if tt.wantStatus != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(kithttp.StatusCoder).StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", got)
+		})
+	}
+}
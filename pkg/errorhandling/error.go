@@ -14,6 +14,8 @@ type apierror struct {
 	message string
 	// ResponseCode represents the HTTP status code the error will return
 	responseCode int
+	// Details provides optional structured information, e.g. the list of invalid fields
+	details interface{}
 }
 
 // Error returns the error in a string format
@@ -31,10 +33,14 @@ func (a apierror) StatusCode() int {
 // MarshalJSON defines the json representation of the error
 func (a apierror) MarshalJSON() ([]byte, error) {
 	vals := map[string]interface{}{}
-	vals["error"] = map[string]interface{}{
+	body := map[string]interface{}{
 		"message": a.message,
 		"code":    a.code,
 	}
+	if a.details != nil {
+		body["details"] = a.details
+	}
+	vals["error"] = body
 	return json.Marshal(vals)
 }
 
@@ -56,6 +62,34 @@ func InvalidRequest(code string, err error) error {
 	}
 }
 
+// InvalidFields returns a bad request error with the detail of every invalid field
+func InvalidFields(code string, err error, fields interface{}) error {
+	return apierror{
+		code:         code,
+		responseCode: http.StatusBadRequest,
+		message:      err.Error(),
+		details:      fields,
+	}
+}
+
+// Conflict returns a conflict error
+func Conflict(code string, err error) error {
+	return apierror{
+		code:         code,
+		responseCode: http.StatusConflict,
+		message:      err.Error(),
+	}
+}
+
+// Unprocessable returns an unprocessable entity error
+func Unprocessable(code string, err error) error {
+	return apierror{
+		code:         code,
+		responseCode: http.StatusUnprocessableEntity,
+		message:      err.Error(),
+	}
+}
+
 // Internal returns an internal server error
 func Internal(code string, err error) error {
 	return apierror{
@@ -73,3 +107,48 @@ func Unauthorized(code string, err error) error {
 		responseCode: http.StatusUnauthorized,
 	}
 }
+
+// Forbidden returns a forbidden error, for an authenticated client lacking the rights of the operation
+func Forbidden(code string, err error) error {
+	return apierror{
+		code:         code,
+		message:      err.Error(),
+		responseCode: http.StatusForbidden,
+	}
+}
+
+// Timeout returns a gateway timeout error
+func Timeout(code string, err error) error {
+	return apierror{
+		code:         code,
+		responseCode: http.StatusGatewayTimeout,
+		message:      err.Error(),
+	}
+}
+
+// Unavailable returns a service unavailable error
+func Unavailable(code string, err error) error {
+	return apierror{
+		code:         code,
+		responseCode: http.StatusServiceUnavailable,
+		message:      err.Error(),
+	}
+}
+
+// UnsupportedMediaType returns an unsupported media type error
+func UnsupportedMediaType(code string, err error) error {
+	return apierror{
+		code:         code,
+		responseCode: http.StatusUnsupportedMediaType,
+		message:      err.Error(),
+	}
+}
+
+// FailedDependency returns a failed dependency error, e.g. for an operation aborted by the failure of another one
+func FailedDependency(code string, err error) error {
+	return apierror{
+		code:         code,
+		responseCode: http.StatusFailedDependency,
+		message:      err.Error(),
+	}
+}
@@ -0,0 +1,45 @@
+package errorhandling
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+
+	"github.com/cedric-parisi/payment-api/pkg/jsonapi"
+)
+
+// EncodeError writes the error as a JSON:API errors document when the client accepts it
+// and falls back on the go-kit default error encoder otherwise
+func EncodeError(ctx context.Context, err error, w http.ResponseWriter) {
+	if !jsonapi.Requested(ctx) {
+		kithttp.DefaultErrorEncoder(ctx, err, w)
+		return
+	}
+
+	code := http.StatusInternalServerError
+	if sc, ok := err.(kithttp.StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	if headerer, ok := err.(kithttp.Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+
+	obj := jsonapi.ErrorObject{
+		Status: strconv.Itoa(code),
+		Detail: err.Error(),
+	}
+	if a, ok := err.(apierror); ok {
+		obj.Code = a.code
+		obj.Detail = a.message
+		if a.details != nil {
+			obj.Meta = map[string]interface{}{"details": a.details}
+		}
+	}
+	jsonapi.EncodeErrors(w, code, obj)
+}
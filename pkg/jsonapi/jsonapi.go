@@ -0,0 +1,109 @@
+// Package jsonapi represents responses as JSON:API documents, see https://jsonapi.org/format/
+// The representation is selected per request with the Accept header
+package jsonapi
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// MediaType is the media type of JSON:API documents
+const MediaType = "application/vnd.api+json"
+
+type contextKey int
+
+const contextKeyRequested contextKey = iota
+
+// Document is a top level JSON:API document
+// Data holds a *Resource or a []*Resource
+type Document struct {
+	Data  interface{}            `json:"data"`
+	Links map[string]string      `json:"links,omitempty"`
+	Meta  map[string]interface{} `json:"meta,omitempty"`
+}
+
+// Resource is a JSON:API resource object
+type Resource struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Attributes interface{}            `json:"attributes,omitempty"`
+	Links      map[string]string      `json:"links,omitempty"`
+	Meta       map[string]interface{} `json:"meta,omitempty"`
+}
+
+// ErrorObject is a JSON:API error object
+type ErrorObject struct {
+	Status string      `json:"status"`
+	Code   string      `json:"code,omitempty"`
+	Detail string      `json:"detail,omitempty"`
+	Meta   interface{} `json:"meta,omitempty"`
+}
+
+// Documenter is implemented by the responses that have a JSON:API representation
+type Documenter interface {
+	Document() Document
+}
+
+// HTTPToContext records in the context whether the client accepts JSON:API documents
+// A media type with parameters does not count, as the specification requires
+func HTTPToContext(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, contextKeyRequested, accepts(r.Header.Get("Accept")))
+}
+
+// Requested returns true when the client accepts JSON:API documents, see HTTPToContext
+func Requested(ctx context.Context) bool {
+	requested, _ := ctx.Value(contextKeyRequested).(bool)
+	return requested
+}
+
+func accepts(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil || mediaType != MediaType {
+			continue
+		}
+		// the quality factor is the only parameter allowed by content negotiation
+		delete(params, "q")
+		if len(params) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeResponse encodes the JSON:API document of the response when the client
+// accepts it and falls back on kithttp.EncodeJSONResponse otherwise
+// The headers and the status code of the response are kept
+func EncodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	documenter, ok := response.(Documenter)
+	if !ok || !Requested(ctx) {
+		return kithttp.EncodeJSONResponse(ctx, w, response)
+	}
+
+	w.Header().Set("Content-Type", MediaType)
+	if headerer, ok := response.(kithttp.Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	code := http.StatusOK
+	if sc, ok := response.(kithttp.StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(documenter.Document())
+}
+
+// EncodeErrors writes the errors as a JSON:API errors document
+func EncodeErrors(w http.ResponseWriter, code int, errs ...ErrorObject) {
+	w.Header().Set("Content-Type", MediaType)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string][]ErrorObject{"errors": errs})
+}
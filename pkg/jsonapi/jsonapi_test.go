@@ -0,0 +1,88 @@
+// +build !integration
+
+package jsonapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequested(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   bool
+	}{
+		{name: "no accept header", accept: "", want: false},
+		{name: "plain json", accept: "application/json", want: false},
+		{name: "json api", accept: MediaType, want: true},
+		{name: "json api among other media types", accept: "application/json;q=0.9, application/vnd.api+json", want: true},
+		{name: "json api with quality factor", accept: "application/vnd.api+json;q=0.5", want: true},
+		{name: "json api with extension parameter", accept: `application/vnd.api+json; ext="bulk"`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+
+			got := Requested(HTTPToContext(context.Background(), r))
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type testResponse struct{}
+
+func (testResponse) Document() Document {
+	return Document{Data: &Resource{Type: "tests", ID: "1"}}
+}
+
+func (testResponse) StatusCode() int {
+	return http.StatusCreated
+}
+
+func (testResponse) Headers() http.Header {
+	return http.Header{"Location": []string{"/tests/1"}}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "json api document",
+			accept:          MediaType,
+			wantContentType: MediaType,
+			wantBody:        `{"data":{"type":"tests","id":"1"}}`,
+		},
+		{
+			name:            "plain json response",
+			accept:          "application/json",
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `{}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+
+			err := EncodeResponse(HTTPToContext(context.Background(), r), w, testResponse{})
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, tt.wantContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, "/tests/1", w.Header().Get("Location"))
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
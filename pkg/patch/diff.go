@@ -0,0 +1,70 @@
+package patch
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Change is a difference between two JSON documents at Path, a JSON Pointer
+// Before is missing for an added member and After for a removed one
+type Change struct {
+	Path   string          `json:"path"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Diff lists the changes from the before document to the after one, sorted by path
+// Objects are compared member by member, other values as a whole, arrays included
+func Diff(before, after []byte) ([]Change, error) {
+	b, err := decode(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := decode(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := []Change{}
+	return diff(changes, "", b, a, true, true), nil
+}
+
+func diff(changes []Change, path string, before, after interface{}, hasBefore, hasAfter bool) []Change {
+	b, bObject := before.(map[string]interface{})
+	a, aObject := after.(map[string]interface{})
+	if bObject && aObject {
+		keys := make([]string, 0, len(b)+len(a))
+		for k := range b {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := b[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			bv, bok := b[k]
+			av, aok := a[k]
+			changes = diff(changes, path+"/"+escape(k), bv, av, bok, aok)
+		}
+		return changes
+	}
+
+	if hasBefore && hasAfter && equal(before, after) {
+		return changes
+	}
+	change := Change{Path: path}
+	if hasBefore {
+		change.Before, _ = json.Marshal(before)
+	}
+	if hasAfter {
+		change.After, _ = json.Marshal(after)
+	}
+	return append(changes, change)
+}
+
+// escape builds the reference token of a member name, see parsePointer
+func escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
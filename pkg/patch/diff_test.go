@@ -0,0 +1,74 @@
+// +build !integration
+
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  string
+		after   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "no change",
+			before: `{"a":{"b":1.0}}`,
+			after:  `{"a":{"b":1}}`,
+			want:   `[]`,
+		},
+		{
+			name:   "nested members changed, added and removed",
+			before: `{"a":{"b":"c","d":"e"},"f":1}`,
+			after:  `{"a":{"b":"z","g":null},"f":1}`,
+			want: `[
+				{"path":"/a/b","before":"c","after":"z"},
+				{"path":"/a/d","before":"e"},
+				{"path":"/a/g","after":null}
+			]`,
+		},
+		{
+			name:   "arrays are compared as a whole",
+			before: `{"a":[1,2]}`,
+			after:  `{"a":[1,3]}`,
+			want:   `[{"path":"/a","before":[1,2],"after":[1,3]}]`,
+		},
+		{
+			name:   "created document",
+			before: `{}`,
+			after:  `{"a/b":{"c":"d"},"e":"f"}`,
+			want:   `[{"path":"/a~1b","after":{"c":"d"}},{"path":"/e","after":"f"}]`,
+		},
+		{
+			name:   "object replaced by a scalar",
+			before: `{"a":{"b":"c"}}`,
+			after:  `{"a":null}`,
+			want:   `[{"path":"/a","before":{"b":"c"},"after":null}]`,
+		},
+		{
+			name:    "malformed document",
+			before:  `{"a":`,
+			after:   `{}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff([]byte(tt.before), []byte(tt.after))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Diff() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				raw, _ := json.Marshal(got)
+				assert.JSONEq(t, tt.want, string(raw))
+			}
+		})
+	}
+}
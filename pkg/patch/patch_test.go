@@ -0,0 +1,199 @@
+// +build !integration
+
+package patch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "replace a member",
+			doc:   `{"a":"b","c":{"d":"e"}}`,
+			patch: `{"a":"z"}`,
+			want:  `{"a":"z","c":{"d":"e"}}`,
+		},
+		{
+			name:  "merge nested objects and remove with null",
+			doc:   `{"a":"b","c":{"d":"e","f":"g"}}`,
+			patch: `{"c":{"d":null,"h":1}}`,
+			want:  `{"a":"b","c":{"f":"g","h":1}}`,
+		},
+		{
+			name:  "arrays are replaced",
+			doc:   `{"a":[1,2,3]}`,
+			patch: `{"a":[4]}`,
+			want:  `{"a":[4]}`,
+		},
+		{
+			name:  "numbers are kept as written",
+			doc:   `{"a":100.10}`,
+			patch: `{"b":0.50000}`,
+			want:  `{"a":100.10,"b":0.50000}`,
+		},
+		{
+			name:  "a non object patch replaces the document",
+			doc:   `{"a":"b"}`,
+			patch: `["c"]`,
+			want:  `["c"]`,
+		},
+		{
+			name:    "malformed patch",
+			doc:     `{"a":"b"}`,
+			patch:   `{"a":`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MergePatch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.JSONEq(t, tt.want, string(got))
+			}
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		patch      string
+		want       string
+		wantErr    bool
+		testFailed bool
+	}{
+		{
+			name:  "add a member",
+			doc:   `{"a":{"b":"c"}}`,
+			patch: `[{"op":"add","path":"/a/d","value":"e"}]`,
+			want:  `{"a":{"b":"c","d":"e"}}`,
+		},
+		{
+			name:  "add inserts in and appends to arrays",
+			doc:   `{"a":[1,3]}`,
+			patch: `[{"op":"add","path":"/a/1","value":2},{"op":"add","path":"/a/-","value":4}]`,
+			want:  `{"a":[1,2,3,4]}`,
+		},
+		{
+			name:  "remove a member and an array item",
+			doc:   `{"a":"b","c":[1,2,3]}`,
+			patch: `[{"op":"remove","path":"/a"},{"op":"remove","path":"/c/0"}]`,
+			want:  `{"c":[2,3]}`,
+		},
+		{
+			name:  "replace with null",
+			doc:   `{"a":{"b":"c"}}`,
+			patch: `[{"op":"replace","path":"/a/b","value":null}]`,
+			want:  `{"a":{"b":null}}`,
+		},
+		{
+			name:  "move and copy",
+			doc:   `{"a":{"b":"c"},"d":{}}`,
+			patch: `[{"op":"copy","from":"/a/b","path":"/d/e"},{"op":"move","from":"/a","path":"/f"}]`,
+			want:  `{"d":{"e":"c"},"f":{"b":"c"}}`,
+		},
+		{
+			name:  "escaped pointer",
+			doc:   `{"a/b":{"c~d":1}}`,
+			patch: `[{"op":"replace","path":"/a~1b/c~0d","value":2}]`,
+			want:  `{"a/b":{"c~d":2}}`,
+		},
+		{
+			name:  "test compares numbers by value",
+			doc:   `{"a":100.10}`,
+			patch: `[{"op":"test","path":"/a","value":100.1},{"op":"replace","path":"/a","value":50}]`,
+			want:  `{"a":50}`,
+		},
+		{
+			name:       "failed test",
+			doc:        `{"a":"b"}`,
+			patch:      `[{"op":"test","path":"/a","value":"c"}]`,
+			wantErr:    true,
+			testFailed: true,
+		},
+		{
+			name:    "replace a missing member",
+			doc:     `{"a":"b"}`,
+			patch:   `[{"op":"replace","path":"/c","value":"d"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "remove out of range",
+			doc:     `{"a":[1]}`,
+			patch:   `[{"op":"remove","path":"/a/1"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "add without value",
+			doc:     `{"a":"b"}`,
+			patch:   `[{"op":"add","path":"/c"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "move into a child",
+			doc:     `{"a":{"b":{}}}`,
+			patch:   `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown operation",
+			doc:     `{"a":"b"}`,
+			patch:   `[{"op":"merge","path":"/a","value":"c"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid pointer",
+			doc:     `{"a":"b"}`,
+			patch:   `[{"op":"remove","path":"a"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed patch",
+			doc:     `{"a":"b"}`,
+			patch:   `{"op":"remove","path":"/a"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("JSONPatch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Equal(t, tt.testFailed, errors.Is(err, ErrTestFailed))
+				return
+			}
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	got, err := Apply(MergePatchMediaType, []byte(`{"a":"b"}`), []byte(`{"a":"c"}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a":"c"}`, string(got))
+
+	got, err = Apply(JSONPatchMediaType, []byte(`{"a":"b"}`), []byte(`[{"op":"remove","path":"/a"}]`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(got))
+
+	_, err = Apply("application/json", []byte(`{"a":"b"}`), []byte(`{"a":"c"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Cursor is a position in a list ordered by the filter sorting
+// Values holds the sort keys of the last result of the previous page,
+// in the sorting order, and ID breaks the ties between equal keys
+// A nil value is a NULL key, e.g. a payment without attributes sorted on its amount
+// A zero cursor points to the first page
+type Cursor struct {
+	Values []*string
+	ID     string
+}
+
+// CursorValue returns a non NULL cursor value
+func CursorValue(value string) *string {
+	return &value
+}
+
+// cursorToken is the encoded form of a cursor
+// The sorting is stored to reject a cursor reused with another sorting
+type cursorToken struct {
+	Sort   string    `json:"s,omitempty"`
+	Values []*string `json:"v,omitempty"`
+	ID     string    `json:"id"`
+}
+
+// IsZero returns true when the cursor points to the first page
+func (c Cursor) IsZero() bool {
+	return c.ID == ""
+}
+
+// encode builds the opaque token of the cursor
+func (c Cursor) encode(sorting []Sort) string {
+	if c.IsZero() {
+		return ""
+	}
+	raw, _ := json.Marshal(cursorToken{
+		Sort:   sortString(sorting),
+		Values: c.Values,
+		ID:     c.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor reads a token built by encode for the same sorting
+func decodeCursor(token string, sorting []Sort) (*Cursor, error) {
+	if token == "" {
+		return &Cursor{}, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	var t cursorToken
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	if t.Sort != sortString(sorting) || len(t.Values) != len(sorting) {
+		return nil, fmt.Errorf("cursor does not match the sorting %s", sortString(sorting))
+	}
+	if _, err := uuid.Parse(t.ID); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	return &Cursor{Values: t.Values, ID: t.ID}, nil
+}
+
+func sortString(sorting []Sort) string {
+	sorts := make([]string, 0, len(sorting))
+	for _, s := range sorting {
+		sorts = append(sorts, s.String())
+	}
+	return strings.Join(sorts, ",")
+}
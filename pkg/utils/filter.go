@@ -18,6 +18,13 @@ type Filter struct {
 	Limit   int    `json:"limit"`
 	Offset  int    `json:"offset"`
 	Sorting []Sort `json:"-"`
+	// Predicates are the conditions the results must match
+	Predicates []Predicate `json:"-"`
+	// Cursor enables keyset pagination instead of the offset one
+	// The page starts after the cursor, nil in offset mode
+	Cursor *Cursor `json:"-"`
+	// IncludeDeleted lists the soft deleted results along with the others
+	IncludeDeleted bool `json:"-"`
 }
 
 // Sort represents the sorting options
@@ -28,15 +35,20 @@ type Sort struct {
 
 // FilteredList represents a page of results
 // Stores the filters applied and the resource name
+// TotalCount is only computed in offset mode, Next only in cursor mode
 type FilteredList struct {
 	Filter
 	Resource   string      `json:"-"`
 	Results    interface{} `json:"results"`
 	TotalCount int         `json:"total_count"`
+	// Next is the cursor of the following page, nil on the last page
+	Next *Cursor `json:"-"`
 }
 
 // GetFilter extracts filtering options from the url
-func GetFilter(params url.Values) *Filter {
+// Only the parameters naming one of the fields become predicates
+// The cursor parameter, even empty, switches to keyset pagination
+func GetFilter(params url.Values, fields map[string]FieldType) (*Filter, error) {
 	var limit int
 	var offset int
 	var err error
@@ -49,21 +61,57 @@ func GetFilter(params url.Values) *Filter {
 		offset = defaultOffset
 	}
 
-	return &Filter{
-		Limit:   limit,
-		Offset:  offset,
-		Sorting: getSorting(params.Get("sort")),
+	filter := &Filter{
+		Limit:      limit,
+		Offset:     offset,
+		Sorting:    getSorting(params.Get("sort")),
+		Predicates: getPredicates(params, fields),
 	}
+
+	if _, ok := params["cursor"]; ok {
+		if filter.Cursor, err = decodeCursor(params.Get("cursor"), filter.Sorting); err != nil {
+			return nil, err
+		}
+		filter.Offset = defaultOffset
+	}
+	return filter, nil
+}
+
+// Link is a pagination link of a FilteredList
+// Rel is the relation of the page to the current one: first, prev, next or last
+type Link struct {
+	Rel string
+	URL string
 }
 
 // Headers build headers Link for pagination
 func (f FilteredList) Headers() http.Header {
+	var links []string
+	for _, l := range f.Links() {
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, l.URL, l.Rel))
+	}
+	return http.Header{
+		"Link": links,
+	}
+}
+
+// Self returns the URL of the current page
+func (f FilteredList) Self() string {
+	return f.url()
+}
+
+// Links computes the pagination links
+func (f FilteredList) Links() []Link {
+	if f.Filter.Cursor != nil {
+		return f.cursorLinks()
+	}
+
 	currentOffset := f.Filter.Offset
 	remaining := f.TotalCount % f.Filter.Limit
 
 	// compute first page link
 	f.Filter.Offset = 0
-	first := fmt.Sprintf(`</%s/%s>; rel="first"`, f.Resource, f.Filter.String())
+	first := Link{Rel: "first", URL: f.url()}
 
 	// compute previous page link
 	prevOffset := 0
@@ -71,7 +119,7 @@ func (f FilteredList) Headers() http.Header {
 		prevOffset = currentOffset - f.Filter.Limit
 	}
 	f.Filter.Offset = prevOffset
-	prev := fmt.Sprintf(`</%s/%s>; rel="prev"`, f.Resource, f.Filter.String())
+	prev := Link{Rel: "prev", URL: f.url()}
 
 	//compute next page link
 	nextOffset := f.TotalCount - remaining
@@ -79,30 +127,52 @@ func (f FilteredList) Headers() http.Header {
 		nextOffset = currentOffset + f.Filter.Limit
 	}
 	f.Filter.Offset = nextOffset
-	next := fmt.Sprintf(`</%s/%s>; rel="next"`, f.Resource, f.Filter.String())
+	next := Link{Rel: "next", URL: f.url()}
 
 	// compute last page link
 	f.Filter.Offset = f.TotalCount - remaining
 	if f.TotalCount%f.Limit == 0 {
 		f.Filter.Offset = f.TotalCount - f.Limit
 	}
-	last := fmt.Sprintf(`</%s/%s>; rel="last"`, f.Resource, f.Filter.String())
+	last := Link{Rel: "last", URL: f.url()}
 
-	return http.Header{
-		"Link": []string{first, prev, next, last},
+	return []Link{first, prev, next, last}
+}
+
+// cursorLinks computes the links for keyset pagination
+// Pages can only be walked forward, there is no prev nor last link
+func (f FilteredList) cursorLinks() []Link {
+	f.Filter.Cursor = &Cursor{}
+	links := []Link{{Rel: "first", URL: f.url()}}
+
+	if f.Next != nil {
+		f.Filter.Cursor = f.Next
+		links = append(links, Link{Rel: "next", URL: f.url()})
 	}
+	return links
+}
+
+func (f FilteredList) url() string {
+	return fmt.Sprintf("/%s/%s", f.Resource, f.Filter.String())
 }
 
 // String build a raw query according to the filters
 func (f Filter) String() string {
-	var sorts []string
+	query := fmt.Sprintf("?limit=%d&offset=%d", f.Limit, f.Offset)
+	if f.Cursor != nil {
+		query = fmt.Sprintf("?limit=%d&cursor=%s", f.Limit, f.Cursor.encode(f.Sorting))
+	}
 	if len(f.Sorting) > 0 {
-		for _, tmp := range f.Sorting {
-			sorts = append(sorts, tmp.String())
-		}
-		return fmt.Sprintf("?limit=%d&offset=%d&sort=%s", f.Limit, f.Offset, strings.Join(sorts, ","))
+		query += "&sort=" + sortString(f.Sorting)
 	}
-	return fmt.Sprintf("?limit=%d&offset=%d", f.Limit, f.Offset)
+
+	for _, p := range f.Predicates {
+		query += "&" + p.String()
+	}
+	if f.IncludeDeleted {
+		query += "&include_deleted=true"
+	}
+	return query
 }
 
 // String build the sort as part of a raw query
@@ -115,17 +185,45 @@ func (s Sort) String() string {
 	return sort
 }
 
+// ValidateSorting ensures every sort field is one of the allowed fields
+func (f *Filter) ValidateSorting(allowed []string) error {
+	for _, s := range f.Sorting {
+		if !hasField(allowed, s.Field) {
+			return fmt.Errorf("cannot sort on %s, allowed fields are %s", s.Field, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// getSorting reads the sort parameter
+// Fields sorted more than once only keep their first occurrence
+// so that the cursor and the pagination links match the sorting actually applied
 func getSorting(source string) []Sort {
 	strSorts := split(source)
 
+	seen := map[string]bool{}
 	var sorting []Sort
 	for _, sort := range strSorts {
+		sort = strings.TrimSpace(sort)
 		field := sort
 		desc := false
-		if sort[0] == '-' {
+		if strings.HasPrefix(sort, "-") {
 			field = sort[1:]
 			desc = true
 		}
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
 		sorting = append(sorting, Sort{
 			Field:      field,
 			Descending: desc,
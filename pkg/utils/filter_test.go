@@ -13,10 +13,13 @@ func TestGetFilter(t *testing.T) {
 	type args struct {
 		params url.Values
 	}
+	cursor := Cursor{Values: []*string{CursorValue("100.21")}, ID: "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"}
+	nullCursor := Cursor{Values: []*string{nil}, ID: "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"}
 	tests := []struct {
-		name string
-		args args
-		want *Filter
+		name    string
+		args    args
+		want    *Filter
+		wantErr bool
 	}{
 		{
 			name: "ok",
@@ -42,10 +45,109 @@ func TestGetFilter(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "first page in cursor mode ok",
+			args: args{
+				params: url.Values{
+					"cursor": {""},
+					"limit":  {"50"},
+					"offset": {"100"},
+				},
+			},
+			want: &Filter{
+				Limit:  50,
+				Offset: 0,
+				Cursor: &Cursor{},
+			},
+		},
+		{
+			name: "next page in cursor mode ok",
+			args: args{
+				params: url.Values{
+					"cursor": {cursor.encode([]Sort{{Field: "amount", Descending: true}})},
+					"sort":   {"-amount"},
+					"limit":  {"50"},
+				},
+			},
+			want: &Filter{
+				Limit:   50,
+				Offset:  0,
+				Sorting: []Sort{{Field: "amount", Descending: true}},
+				Cursor:  &cursor,
+			},
+		},
+		{
+			name: "next page after a NULL key",
+			args: args{
+				params: url.Values{
+					"cursor": {nullCursor.encode([]Sort{{Field: "amount", Descending: true}})},
+					"sort":   {"-amount"},
+					"limit":  {"50"},
+				},
+			},
+			want: &Filter{
+				Limit:   50,
+				Offset:  0,
+				Sorting: []Sort{{Field: "amount", Descending: true}},
+				Cursor:  &nullCursor,
+			},
+		},
+		{
+			name: "repeated sort field keeps the first occurrence",
+			args: args{
+				params: url.Values{
+					"sort": {"amount,-created_at,-amount"},
+				},
+			},
+			want: &Filter{
+				Limit:   defaultLimit,
+				Offset:  defaultOffset,
+				Sorting: []Sort{{Field: "amount"}, {Field: "created_at", Descending: true}},
+			},
+		},
+		{
+			name: "next page with a repeated sort field",
+			args: args{
+				params: url.Values{
+					"cursor": {cursor.encode([]Sort{{Field: "amount"}})},
+					"sort":   {"amount,amount"},
+				},
+			},
+			want: &Filter{
+				Limit:   defaultLimit,
+				Offset:  defaultOffset,
+				Sorting: []Sort{{Field: "amount"}},
+				Cursor:  &cursor,
+			},
+		},
+		{
+			name: "cursor reused with another sorting",
+			args: args{
+				params: url.Values{
+					"cursor": {cursor.encode([]Sort{{Field: "amount", Descending: true}})},
+					"sort":   {"amount"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed cursor",
+			args: args{
+				params: url.Values{
+					"cursor": {"not a cursor"},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := GetFilter(tt.args.params); !reflect.DeepEqual(got, tt.want) {
+			got, err := GetFilter(tt.args.params, map[string]FieldType{"currency": StringField})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetFilter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GetFilter() = %v, want %v", got, tt.want)
 			}
 		})
@@ -54,9 +156,11 @@ func TestGetFilter(t *testing.T) {
 
 func TestFilter_String(t *testing.T) {
 	type fields struct {
-		Limit   int
-		Offset  int
-		Sorting []Sort
+		Limit      int
+		Offset     int
+		Sorting        []Sort
+		Predicates     []Predicate
+		IncludeDeleted bool
 	}
 	tests := []struct {
 		name   string
@@ -103,13 +207,38 @@ func TestFilter_String(t *testing.T) {
 			},
 			want: "?limit=100&offset=50&sort=date,-amount",
 		},
+		{
+			name: "conditions ok",
+			fields: fields{
+				Limit:  100,
+				Offset: 50,
+				Predicates: []Predicate{
+					{Field: "amount", Operator: Gte, Values: []string{"10"}},
+					{Field: "status", Operator: Eq, Values: []string{"pending"}},
+					{Field: "type", Operator: In, Values: []string{"Payment", "Withdraw"}},
+				},
+			},
+			want: "?limit=100&offset=50&amount[gte]=10&status=pending&type[in]=Payment,Withdraw",
+		},
+		{
+			name: "deleted results included",
+			fields: fields{
+				Limit:          100,
+				Offset:         50,
+				Predicates:     []Predicate{{Field: "status", Operator: Eq, Values: []string{"pending"}}},
+				IncludeDeleted: true,
+			},
+			want: "?limit=100&offset=50&status=pending&include_deleted=true",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			f := Filter{
-				Limit:   tt.fields.Limit,
-				Offset:  tt.fields.Offset,
-				Sorting: tt.fields.Sorting,
+				Limit:      tt.fields.Limit,
+				Offset:     tt.fields.Offset,
+				Sorting:        tt.fields.Sorting,
+				Predicates:     tt.fields.Predicates,
+				IncludeDeleted: tt.fields.IncludeDeleted,
 			}
 			if got := f.String(); got != tt.want {
 				t.Errorf("Filter.String() = %v, want %v", got, tt.want)
@@ -208,6 +337,43 @@ func TestFilteredList_Headers(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "cursor mode ok",
+			fields: fields{
+				filteredList: FilteredList{
+					Resource: "payments",
+					Filter: Filter{
+						Limit:   10,
+						Sorting: []Sort{{Field: "amount", Descending: true}},
+						Cursor:  &Cursor{},
+					},
+					Next: &Cursor{Values: []*string{CursorValue("100.21")}, ID: "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"},
+				},
+			},
+			want: http.Header{
+				"Link": []string{
+					`</payments/?limit=10&cursor=&sort=-amount>; rel="first"`,
+					`</payments/?limit=10&cursor=eyJzIjoiLWFtb3VudCIsInYiOlsiMTAwLjIxIl0sImlkIjoiNGVlM2E4ZDgtY2E3Yi00MjkwLWE1MmMtZGQ1YjYxNjVlYzQzIn0&sort=-amount>; rel="next"`,
+				},
+			},
+		},
+		{
+			name: "cursor mode last page ok",
+			fields: fields{
+				filteredList: FilteredList{
+					Resource: "payments",
+					Filter: Filter{
+						Limit:  10,
+						Cursor: &Cursor{Values: []*string{}, ID: "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"},
+					},
+				},
+			},
+			want: http.Header{
+				"Link": []string{
+					`</payments/?limit=10&cursor=>; rel="first"`,
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -218,3 +384,37 @@ func TestFilteredList_Headers(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter_ValidateSorting(t *testing.T) {
+	allowed := []string{"created_at", "amount"}
+	tests := []struct {
+		name    string
+		sorting []Sort
+		want    []Sort
+		wantErr bool
+	}{
+		{
+			name:    "allowed fields",
+			sorting: []Sort{{Field: "amount", Descending: true}, {Field: "created_at"}},
+			want:    []Sort{{Field: "amount", Descending: true}, {Field: "created_at"}},
+		},
+		{
+			name:    "unknown field",
+			sorting: []Sort{{Field: "views"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Filter{Sorting: tt.sorting}
+			err := f.ValidateSorting(allowed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Filter.ValidateSorting() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(f.Sorting, tt.want) {
+				t.Errorf("Filter.ValidateSorting() sorting = %v, want %v", f.Sorting, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Operator is the comparison applied by a predicate
+type Operator string
+
+const (
+	// Eq matches values equal to the predicate value
+	Eq Operator = "eq"
+	// In matches values equal to one of the predicate values
+	In Operator = "in"
+	// Gt matches values greater than the predicate value
+	Gt Operator = "gt"
+	// Gte matches values greater than or equal to the predicate value
+	Gte Operator = "gte"
+	// Lt matches values lower than the predicate value
+	Lt Operator = "lt"
+	// Lte matches values lower than or equal to the predicate value
+	Lte Operator = "lte"
+)
+
+// FieldType defines the values and operators accepted on a field
+type FieldType int
+
+const (
+	// StringField accepts any value with equality operators
+	StringField FieldType = iota
+	// UUIDField accepts uuids with equality operators
+	UUIDField
+	// DecimalField accepts decimal numbers with equality and range operators
+	DecimalField
+	// DateField accepts YYYY-MM-DD dates with equality and range operators
+	DateField
+)
+
+var (
+	predicateKeyRegex = regexp.MustCompile(`^([^\[\]]+)\[([^\[\]]*)\]$`)
+	decimalRegex      = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+	equalityOperators = []Operator{Eq, In}
+	rangeOperators    = []Operator{Eq, In, Gt, Gte, Lt, Lte}
+)
+
+// Predicate is a condition on a field
+// Values holds a single value except for the In operator
+type Predicate struct {
+	Field    string
+	Operator Operator
+	Values   []string
+}
+
+// String build the predicate as part of a raw query
+func (p Predicate) String() string {
+	values := make([]string, 0, len(p.Values))
+	for _, v := range p.Values {
+		values = append(values, url.QueryEscape(v))
+	}
+	if p.Operator == Eq {
+		return fmt.Sprintf("%s=%s", url.QueryEscape(p.Field), strings.Join(values, ","))
+	}
+	return fmt.Sprintf("%s[%s]=%s", url.QueryEscape(p.Field), p.Operator, strings.Join(values, ","))
+}
+
+// getPredicates reads predicates from the query parameters naming one of the fields
+// e.g. currency=GBP, amount[gte]=10, type[in]=Payment,Withdraw
+// The other parameters, e.g. cache busters, are ignored
+func getPredicates(params url.Values, fields map[string]FieldType) []Predicate {
+	var predicates []Predicate
+	for key, values := range params {
+		field, op := key, Eq
+		if m := predicateKeyRegex.FindStringSubmatch(key); m != nil {
+			field, op = m[1], Operator(m[2])
+		}
+		if _, ok := fields[field]; !ok {
+			continue
+		}
+
+		for _, value := range values {
+			p := Predicate{
+				Field:    field,
+				Operator: op,
+				Values:   []string{value},
+			}
+			if op == In {
+				p.Values = split(value)
+			}
+			predicates = append(predicates, p)
+		}
+	}
+
+	// url.Values is a map, keep predicates order stable for the links
+	sort.Slice(predicates, func(i, j int) bool {
+		if predicates[i].Field != predicates[j].Field {
+			return predicates[i].Field < predicates[j].Field
+		}
+		return predicates[i].Operator < predicates[j].Operator
+	})
+	return predicates
+}
+
+// Validate ensures every predicate targets a known field
+// with an operator and values matching the field type
+func (f Filter) Validate(fields map[string]FieldType) error {
+	for _, p := range f.Predicates {
+		fieldType, ok := fields[p.Field]
+		if !ok {
+			return fmt.Errorf("cannot filter on %s, allowed fields are %s", p.Field, strings.Join(fieldNames(fields), ", "))
+		}
+
+		allowed := equalityOperators
+		if fieldType == DecimalField || fieldType == DateField {
+			allowed = rangeOperators
+		}
+		if !hasOperator(allowed, p.Operator) {
+			return fmt.Errorf("operator %s is not allowed on %s", p.Operator, p.Field)
+		}
+
+		if len(p.Values) == 0 {
+			return fmt.Errorf("%s requires a value", p.Field)
+		}
+		for _, v := range p.Values {
+			if err := checkValue(fieldType, v); err != nil {
+				return fmt.Errorf("invalid value for %s: %s", p.Field, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkValue(fieldType FieldType, value string) error {
+	switch fieldType {
+	case UUIDField:
+		if _, err := uuid.Parse(value); err != nil {
+			return err
+		}
+	case DecimalField:
+		if !decimalRegex.MatchString(value) {
+			return fmt.Errorf("%s is not a decimal number", value)
+		}
+	case DateField:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Errorf("%s is not a YYYY-MM-DD date", value)
+		}
+	}
+	return nil
+}
+
+func hasOperator(operators []Operator, op Operator) bool {
+	for _, o := range operators {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldNames(fields map[string]FieldType) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
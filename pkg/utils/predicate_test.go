@@ -0,0 +1,129 @@
+// +build !integration
+
+package utils
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func Test_getPredicates(t *testing.T) {
+	fields := map[string]FieldType{
+		"amount":       DecimalField,
+		"currency":     StringField,
+		"payment_type": StringField,
+		"type":         StringField,
+	}
+	tests := []struct {
+		name   string
+		params url.Values
+		want   []Predicate
+	}{
+		{
+			name: "params naming no field are ignored",
+			params: url.Values{
+				"limit":       {"10"},
+				"offset":      {"0"},
+				"sort":        {"-amount"},
+				"_":           {"1571392800"},
+				"utm_source":  {"newsletter"},
+				"unknown[gt]": {"1"},
+			},
+		},
+		{
+			name: "equality, range and in predicates",
+			params: url.Values{
+				"currency":     {"GBP"},
+				"amount[gte]":  {"10"},
+				"amount[lt]":   {"100.50"},
+				"type[in]":     {"Payment,Withdraw"},
+				"payment_type": {"Credit", "Debit"},
+				"amount[like]": {"10"},
+			},
+			want: []Predicate{
+				{Field: "amount", Operator: Gte, Values: []string{"10"}},
+				{Field: "amount", Operator: "like", Values: []string{"10"}},
+				{Field: "amount", Operator: Lt, Values: []string{"100.50"}},
+				{Field: "currency", Operator: Eq, Values: []string{"GBP"}},
+				{Field: "payment_type", Operator: Eq, Values: []string{"Credit"}},
+				{Field: "payment_type", Operator: Eq, Values: []string{"Debit"}},
+				{Field: "type", Operator: In, Values: []string{"Payment", "Withdraw"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getPredicates(tt.params, fields); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getPredicates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	fields := map[string]FieldType{
+		"currency":        StringField,
+		"organisation_id": UUIDField,
+		"amount":          DecimalField,
+		"processing_date": DateField,
+	}
+	tests := []struct {
+		name       string
+		predicates []Predicate
+		wantErr    bool
+	}{
+		{
+			name: "valid predicates",
+			predicates: []Predicate{
+				{Field: "currency", Operator: In, Values: []string{"GBP", "EUR"}},
+				{Field: "organisation_id", Operator: Eq, Values: []string{"743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb"}},
+				{Field: "amount", Operator: Gte, Values: []string{"10.5"}},
+				{Field: "processing_date", Operator: Lte, Values: []string{"2017-01-18"}},
+			},
+		},
+		{
+			name:       "unknown field",
+			predicates: []Predicate{{Field: "password", Operator: Eq, Values: []string{"secret"}}},
+			wantErr:    true,
+		},
+		{
+			name:       "range on a string field",
+			predicates: []Predicate{{Field: "currency", Operator: Gt, Values: []string{"GBP"}}},
+			wantErr:    true,
+		},
+		{
+			name:       "unknown operator",
+			predicates: []Predicate{{Field: "amount", Operator: "like", Values: []string{"10"}}},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid decimal",
+			predicates: []Predicate{{Field: "amount", Operator: Gt, Values: []string{"NaN"}}},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid date",
+			predicates: []Predicate{{Field: "processing_date", Operator: Gt, Values: []string{"18/01/2017"}}},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid uuid",
+			predicates: []Predicate{{Field: "organisation_id", Operator: Eq, Values: []string{"1 OR 1=1"}}},
+			wantErr:    true,
+		},
+		{
+			name:       "empty in list",
+			predicates: []Predicate{{Field: "currency", Operator: In}},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filter{Predicates: tt.predicates}
+			if err := f.Validate(fields); (err != nil) != tt.wantErr {
+				t.Errorf("Filter.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Bank id codes, they tell how a bank id identifies the bank
+const (
+	// BankIDSortCode identifies a UK bank branch with 6 digits
+	BankIDSortCode = "GBDSC"
+	// BankIDBIC identifies a bank with its SWIFT BIC
+	BankIDBIC = "SWBIC"
+	// BankIDBLZ identifies a German bank with its 8 digits Bankleitzahl
+	BankIDBLZ = "DEBLZ"
+)
+
+var (
+	sortCodeRegex      = regexp.MustCompile(`^[0-9]{6}$`)
+	ukAccountRegex     = regexp.MustCompile(`^[0-9]{8}$`)
+	blzRegex           = regexp.MustCompile(`^[0-9]{8}$`)
+	bicRegex           = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	bankIDValidators   = map[string]func(id string) error{BankIDSortCode: UKSortCode, BankIDBIC: BIC, BankIDBLZ: BLZ}
+	ibanBankIDPosition = map[string]struct {
+		country    string
+		start, end int
+	}{
+		// GBkk BBBB SSSSSS AAAAAAAA, the sort code follows the bank code
+		BankIDSortCode: {country: "GB", start: 8, end: 14},
+		// DEkk BBBBBBBB AAAAAAAAAA, the Bankleitzahl follows the check digits
+		BankIDBLZ: {country: "DE", start: 4, end: 12},
+	}
+)
+
+// UKSortCode checks a UK sort code, 6 digits without dashes
+func UKSortCode(sortCode string) error {
+	if !sortCodeRegex.MatchString(sortCode) {
+		return fmt.Errorf("must be a sort code of 6 digits")
+	}
+	return nil
+}
+
+// UKAccountNumber checks a UK account number, 8 digits
+func UKAccountNumber(number string) error {
+	if !ukAccountRegex.MatchString(number) {
+		return fmt.Errorf("must be a UK account number of 8 digits")
+	}
+	return nil
+}
+
+// BLZ checks a German Bankleitzahl, 8 digits
+func BLZ(blz string) error {
+	if !blzRegex.MatchString(blz) {
+		return fmt.Errorf("must be a Bankleitzahl of 8 digits")
+	}
+	return nil
+}
+
+// BIC checks the structure of a SWIFT BIC: 4 letters for the bank, 2 for the country,
+// 2 letters or digits for the location and an optional branch of 3 letters or digits
+func BIC(bic string) error {
+	if !bicRegex.MatchString(bic) {
+		return fmt.Errorf("must be a BIC of 8 or 11 upper case letters or digits, e.g. NWBKGB2L")
+	}
+	return nil
+}
+
+// BankID checks the bank id has the format of its bank id code
+// Unknown codes are not checked
+func BankID(code, id string) error {
+	validate, ok := bankIDValidators[code]
+	if !ok {
+		return nil
+	}
+	return validate(id)
+}
+
+// IBANBankID checks a valid IBAN and a valid bank id designate the same bank
+// The sort code of a GB IBAN and the Bankleitzahl of a DE IBAN must be the bank id,
+// the country of a BIC must be the one of the IBAN
+// Other combinations are not checked
+func IBANBankID(iban, code, id string) error {
+	country := iban[:2]
+	if code == BankIDBIC {
+		if id[4:6] != country {
+			return fmt.Errorf("must be a BIC of the country of the IBAN %s, got %s", country, id[4:6])
+		}
+		return nil
+	}
+
+	pos, ok := ibanBankIDPosition[code]
+	if !ok || pos.country != country {
+		return nil
+	}
+	if expected := iban[pos.start:pos.end]; expected != id {
+		return fmt.Errorf("must be %s, the bank id of the IBAN", expected)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// +build !integration
+
+package validation
+
+import "testing"
+
+func TestBankID(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		id      string
+		wantErr bool
+	}{
+		{name: "sort code", code: BankIDSortCode, id: "403000"},
+		{name: "sort code with dashes", code: BankIDSortCode, id: "40-30-00", wantErr: true},
+		{name: "short sort code", code: BankIDSortCode, id: "40300", wantErr: true},
+		{name: "BIC of 8 characters", code: BankIDBIC, id: "NWBKGB2L"},
+		{name: "BIC with branch", code: BankIDBIC, id: "DEUTDEFF500"},
+		{name: "BIC with digits in the bank code", code: BankIDBIC, id: "NW1KGB2L", wantErr: true},
+		{name: "BIC of 9 characters", code: BankIDBIC, id: "NWBKGB2L1", wantErr: true},
+		{name: "lower case BIC", code: BankIDBIC, id: "nwbkgb2l", wantErr: true},
+		{name: "Bankleitzahl", code: BankIDBLZ, id: "37040044"},
+		{name: "short Bankleitzahl", code: BankIDBLZ, id: "3704004", wantErr: true},
+		{name: "unknown code is not checked", code: "XXXXX", id: "anything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := BankID(tt.code, tt.id); (err != nil) != tt.wantErr {
+				t.Errorf("BankID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUKAccountNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		number  string
+		wantErr bool
+	}{
+		{name: "8 digits", number: "31926819"},
+		{name: "7 digits", number: "3192681", wantErr: true},
+		{name: "letters", number: "3192681A", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := UKAccountNumber(tt.number); (err != nil) != tt.wantErr {
+				t.Errorf("UKAccountNumber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIBANBankID(t *testing.T) {
+	tests := []struct {
+		name    string
+		iban    string
+		code    string
+		id      string
+		wantErr bool
+	}{
+		{name: "sort code of the GB IBAN", iban: "GB29NWBK60161331926819", code: BankIDSortCode, id: "601613"},
+		{name: "other sort code", iban: "GB29NWBK60161331926819", code: BankIDSortCode, id: "403000", wantErr: true},
+		{name: "Bankleitzahl of the DE IBAN", iban: "DE89370400440532013000", code: BankIDBLZ, id: "37040044"},
+		{name: "other Bankleitzahl", iban: "DE89370400440532013000", code: BankIDBLZ, id: "10000000", wantErr: true},
+		{name: "BIC of the IBAN country", iban: "GB29NWBK60161331926819", code: BankIDBIC, id: "NWBKGB2L"},
+		{name: "BIC of another country", iban: "GB29NWBK60161331926819", code: BankIDBIC, id: "DEUTDEFF", wantErr: true},
+		{name: "sort code with a foreign IBAN is not checked", iban: "DE89370400440532013000", code: BankIDSortCode, id: "403000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := IBANBankID(tt.iban, tt.code, tt.id); (err != nil) != tt.wantErr {
+				t.Errorf("IBANBankID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Package validation checks the identifiers of bank accounts and banks
+// Errors are phrased to follow the name of the checked field, e.g. "account_number must ..."
+package validation
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+var (
+	ibanRegex = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]+$`)
+
+	// ibanLengths is the length of the IBANs of each country of the IBAN registry
+	ibanLengths = map[string]int{
+		"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BI": 27,
+		"BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DJ": 27, "DK": 18, "DO": 28,
+		"EE": 20, "EG": 29, "ES": 24, "FI": 18, "FK": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23,
+		"GL": 18, "GR": 27, "GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27,
+		"JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "LY": 25,
+		"MC": 27, "MD": 24, "ME": 22, "MK": 19, "MN": 20, "MR": 27, "MT": 31, "MU": 30, "NI": 28, "NL": 18,
+		"NO": 15, "OM": 23, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "RU": 33,
+		"SA": 24, "SC": 31, "SD": 18, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "SO": 23, "ST": 25, "SV": 28,
+		"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20, "YE": 30,
+	}
+
+	ninetySeven = big.NewInt(97)
+)
+
+// IBAN checks an IBAN in its electronic format, upper case without spaces,
+// e.g. GB29NWBK60161331926819
+// The length must be the one of its country and the check digits must pass ISO 7064 mod 97-10
+func IBAN(iban string) error {
+	if !ibanRegex.MatchString(iban) {
+		return fmt.Errorf("must be an IBAN: a country code, 2 check digits and upper case letters or digits")
+	}
+	country := iban[:2]
+	length, ok := ibanLengths[country]
+	if !ok {
+		return fmt.Errorf("must be an IBAN of a country of the IBAN registry, got country %s", country)
+	}
+	if len(iban) != length {
+		return fmt.Errorf("must be an IBAN of %d characters for %s, got %d", length, country, len(iban))
+	}
+	if ibanChecksum(iban) != 1 {
+		return fmt.Errorf("must be an IBAN with valid check digits")
+	}
+	return nil
+}
+
+// ibanChecksum moves the country code and the check digits at the end,
+// replaces letters with numbers, A = 10 to Z = 35, and returns the remainder modulo 97
+func ibanChecksum(iban string) int64 {
+	rearranged := iban[4:] + iban[:4]
+	digits := make([]byte, 0, 2*len(rearranged))
+	for i := 0; i < len(rearranged); i++ {
+		c := rearranged[i]
+		if c >= 'A' && c <= 'Z' {
+			digits = strconv.AppendInt(digits, int64(c-'A')+10, 10)
+			continue
+		}
+		digits = append(digits, c)
+	}
+	n, _ := new(big.Int).SetString(string(digits), 10)
+	return n.Mod(n, ninetySeven).Int64()
+}
@@ -0,0 +1,31 @@
+// +build !integration
+
+package validation
+
+import "testing"
+
+func TestIBAN(t *testing.T) {
+	tests := []struct {
+		name    string
+		iban    string
+		wantErr bool
+	}{
+		{name: "valid GB IBAN", iban: "GB29NWBK60161331926819"},
+		{name: "valid DE IBAN", iban: "DE89370400440532013000"},
+		{name: "valid shortest IBAN", iban: "NO9386011117947"},
+		{name: "invalid check digits", iban: "GB28NWBK60161331926819", wantErr: true},
+		{name: "transposed digits", iban: "GB29NWBK60161331926891", wantErr: true},
+		{name: "wrong length for the country", iban: "GB29NWBK6016133192681", wantErr: true},
+		{name: "unknown country", iban: "ZZ29NWBK60161331926819", wantErr: true},
+		{name: "print format with spaces", iban: "GB29 NWBK 6016 1331 9268 19", wantErr: true},
+		{name: "lower case", iban: "gb29nwbk60161331926819", wantErr: true},
+		{name: "empty", iban: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := IBAN(tt.iban); (err != nil) != tt.wantErr {
+				t.Errorf("IBAN() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}